@@ -0,0 +1,218 @@
+// archive_importer.go
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/pivolan/stats_analyzer/domain/models"
+)
+
+// csvFileGroup — CSV файлы архива с одинаковыми заголовками, они загружаются в одну таблицу
+type csvFileGroup struct {
+	paths    []string
+	analysis *models.HeaderAnalysis
+}
+
+// importArchiveMembers импортирует все файлы распакованного архива.
+// CSV файлы с одинаковой шапкой склеиваются в одну таблицу с колонкой source_file,
+// остальные файлы становятся отдельными таблицами
+func importArchiveMembers(paths []string, db DBInterface, opts importOptions) ([]models.ImportedTable, error) {
+	sort.Strings(paths)
+	var groups []*csvFileGroup
+	groupBySignature := map[string]*csvFileGroup{}
+	var others []string
+	// Файлы, которые не удалось загрузить, с причиной: о них сообщается в чате
+	var skipped []string
+	for _, path := range paths {
+		if detectFileFormat(path) != FORMAT_CSV {
+			others = append(others, path)
+			continue
+		}
+		analysis, err := readCSVHeader(path)
+		if err != nil {
+			log.Printf("skip archive member %s: %v", path, err)
+			skipped = append(skipped, fmt.Sprintf("%s: %v", filepath.Base(path), err))
+			continue
+		}
+		signature := strings.Join(analysis.Headers, "\x00")
+		if analysis.FirstRowIsData {
+			signature = fmt.Sprintf("data:%d", len(analysis.Headers))
+		}
+		group, ok := groupBySignature[signature]
+		if !ok {
+			group = &csvFileGroup{analysis: analysis}
+			groupBySignature[signature] = group
+			groups = append(groups, group)
+		}
+		group.paths = append(group.paths, path)
+	}
+
+	var tables []models.ImportedTable
+	for _, group := range groups {
+		if len(group.paths) == 1 {
+			others = append(others, group.paths[0])
+			continue
+		}
+		opts.Progress.SetStage(fmt.Sprintf("%d файлов с колонками %s", len(group.paths), strings.Join(group.analysis.Headers, ", ")))
+		tableName, err := importCSVFilesIntoClickHouse(group.paths, group.analysis, db, opts)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", filepath.Base(group.paths[0]), err)
+		}
+		tables = append(tables, models.ImportedTable{
+			Name:   tableName,
+			Source: fmt.Sprintf("%s … %s (%d файлов)", filepath.Base(group.paths[0]), filepath.Base(group.paths[len(group.paths)-1]), len(group.paths)),
+			Meta:   models.TableMeta{Encoding: detectFileEncoding(group.paths[0]).Name},
+		})
+	}
+
+	sort.Strings(others)
+	for i, path := range others {
+		opts.Progress.SetStage(fmt.Sprintf("%s (%d из %d)", filepath.Base(path), i+1, len(others)))
+		imported, err := importFileIntoClickHouse(path, db, opts)
+		if err != nil {
+			log.Printf("skip archive member %s: %v", path, err)
+			skipped = append(skipped, fmt.Sprintf("%s: %v", filepath.Base(path), err))
+			continue
+		}
+		tables = append(tables, imported...)
+	}
+	if len(tables) == 0 {
+		if len(skipped) > 0 {
+			return nil, fmt.Errorf("no data files imported from archive: %s", strings.Join(skipped, "; "))
+		}
+		return nil, fmt.Errorf("no data files found in archive")
+	}
+	tables[0].Meta.SkippedFiles = skipped
+	return tables, nil
+}
+
+// readCSVHeader читает и анализирует первую запись CSV файла
+func readCSVHeader(filePath string) (*models.HeaderAnalysis, error) {
+	dialect, _ := sniffCSVDialect(filePath)
+	f, _, err := openTextFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	firstRow, err := newDialectReader(f, dialect).Read()
+	if err != nil {
+		return nil, err
+	}
+	analysis := AnalyzeHeaders(removeBOM(firstRow))
+	if analysis == nil {
+		return nil, fmt.Errorf("empty CSV file")
+	}
+	return analysis, nil
+}
+
+// csvFilesRowReader читает несколько CSV файлов подряд и добавляет к каждой строке имя файла
+type csvFilesRowReader struct {
+	paths          []string
+	firstRowIsData bool
+	index          int
+	current        rowReader
+	file           *decodedFile
+	// Байты уже прочитанных файлов и общий счетчик для показа хода загрузки
+	doneBytes int64
+	bytesRead int64
+}
+
+func (r *csvFilesRowReader) Read() ([]string, error) {
+	for {
+		if r.current == nil {
+			if r.index >= len(r.paths) {
+				return nil, io.EOF
+			}
+			if err := r.open(r.paths[r.index]); err != nil {
+				return nil, err
+			}
+		}
+		row, err := r.current.Read()
+		if err == io.EOF {
+			r.doneBytes += r.file.BytesRead()
+			r.Close()
+			r.index++
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		atomic.StoreInt64(&r.bytesRead, r.doneBytes+r.file.BytesRead())
+		return append(row, filepath.Base(r.paths[r.index])), nil
+	}
+}
+
+// Position добавляет к строке файла его имя, номера строк в разных файлах повторяются
+func (r *csvFilesRowReader) Position() (int64, string) {
+	position, ok := r.current.(rowPosition)
+	if !ok {
+		return 0, ""
+	}
+	line, raw := position.Position()
+	return line, filepath.Base(r.paths[r.index]) + ": " + raw
+}
+
+func (r *csvFilesRowReader) open(path string) error {
+	// У каждого файла может быть своя кодировка и свой диалект
+	dialect, _ := sniffCSVDialect(path)
+	f, _, err := openTextFile(path)
+	if err != nil {
+		return err
+	}
+	reader := newDialectReader(f, dialect)
+	if !r.firstRowIsData {
+		if _, err := reader.Read(); err != nil && err != io.EOF {
+			f.Close()
+			return err
+		}
+	}
+	r.current, r.file = reader, f
+	return nil
+}
+
+// BytesRead можно вызывать из другой горутины, пока идет чтение
+func (r *csvFilesRowReader) BytesRead() int64 {
+	return atomic.LoadInt64(&r.bytesRead)
+}
+
+func (r *csvFilesRowReader) Close() {
+	if r.file != nil {
+		r.file.Close()
+	}
+	r.current, r.file = nil, nil
+}
+
+// importCSVFilesIntoClickHouse загружает CSV файлы с одинаковой шапкой в одну таблицу с колонкой source_file
+func importCSVFilesIntoClickHouse(paths []string, analysis *models.HeaderAnalysis, db DBInterface, opts importOptions) (models.ClickhouseTableName, error) {
+	headers := addNumberPrefix(ValidateHeaders(append(append([]string{}, analysis.Headers...), "source_file")))
+
+	typesReader := &csvFilesRowReader{paths: paths, firstRowIsData: analysis.FirstRowIsData}
+	types, nullables, formats := inferColumnTypes(typesReader, len(headers))
+	typesReader.Close()
+	// Имя файла всегда строка, даже если похоже на дату или число
+	types[len(types)-1] = "String"
+	nullables[len(nullables)-1] = ""
+	formats[len(formats)-1] = columnFormat{}
+
+	reader := &csvFilesRowReader{paths: paths, firstRowIsData: analysis.FirstRowIsData}
+	defer reader.Close()
+	var totalBytes int64
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil {
+			totalBytes += info.Size()
+		}
+	}
+	opts.Progress.Track(totalBytes, reader.BytesRead)
+	labels := append(append([]string{}, analysis.Labels...), "source_file")
+	if analysis.FirstRowIsData {
+		labels = nil
+	}
+	return importRows(db, paths[0]+"#merged", headers, labels, types, nullables, formats, opts.Progress.CountRows(reader), opts)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/gorm"
+)
+
+func TestImportArchiveMembers(t *testing.T) {
+	original := getMD5String
+	getMD5String = func(input string) string {
+		return "123456"
+	}
+	defer func() {
+		getMD5String = original
+	}()
+
+	archivePath := filepath.Join(t.TempDir(), "month.zip")
+	archive, err := os.Create(archivePath)
+	assert.NoError(t, err)
+	writer := zip.NewWriter(archive)
+	members := []struct {
+		name    string
+		content string
+	}{
+		{"daily/2024-01-02.csv", "date,amount\n2024-01-02,7\n"},
+		{"daily/2024-01-01.csv", "date;amount\n2024-01-01;5\n2024-01-01;6\n"},
+		{"users.csv", "name,age\nJohn,30\n"},
+		{"broken.parquet", "not a parquet file"},
+		{"__MACOSX/daily/._2024-01-01.csv", "junk"},
+		{"../evil.csv", "a,b\n1,2\n"},
+	}
+	for _, member := range members {
+		w, err := writer.Create(member.name)
+		assert.NoError(t, err)
+		w.Write([]byte(member.content))
+	}
+	assert.NoError(t, writer.Close())
+	archive.Close()
+
+	paths, err := unpackArchiveAll(archivePath)
+	assert.NoError(t, err)
+	assert.Len(t, paths, 4)
+	assert.NoFileExists(t, archivePath)
+
+	mockDB := NewMockDB()
+	mockDB.On("Exec", mock.Anything, mock.Anything).Return(&gorm.DB{})
+	tables, err := importArchiveMembers(paths, mockDB, importOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, tables, 2)
+	assert.Equal(t, "2024-01-01.csv … 2024-01-02.csv (2 файлов)", tables[0].Source)
+	assert.Equal(t, "users.csv", tables[1].Source)
+	// Файл, который не удалось загрузить, не прерывает импорт, но попадает в сообщение пользователю
+	if assert.Len(t, tables[0].Meta.SkippedFiles, 1) {
+		assert.True(t, strings.HasPrefix(tables[0].Meta.SkippedFiles[0], "broken.parquet: cannot open parquet file"))
+	}
+
+	var creates, inserts []string
+	for _, call := range mockDB.Calls {
+		query := call.Arguments.String(0)
+		if strings.HasPrefix(query, "CREATE TABLE") {
+			creates = append(creates, query)
+		}
+		if strings.HasPrefix(query, "INSERT INTO") {
+			inserts = append(inserts, query)
+		}
+	}
+	assert.Len(t, creates, 2)
+	assert.Contains(t, creates[0], "0001_date Date")
+	assert.Contains(t, creates[0], "0002_amount Int64")
+	assert.Contains(t, creates[0], "0003_source_file String")
+	assert.Contains(t, inserts[0], "1,2024-01-01,5,2024-01-01.csv\n"+
+		"2,2024-01-01,6,2024-01-01.csv\n"+
+		"3,2024-01-02,7,2024-01-02.csv\n")
+	assert.Contains(t, creates[1], "0002_age Int64")
+}
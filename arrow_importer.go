@@ -0,0 +1,256 @@
+// arrow_importer.go
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/apache/arrow/go/v14/arrow"
+	"github.com/apache/arrow/go/v14/arrow/array"
+	"github.com/apache/arrow/go/v14/arrow/ipc"
+	"github.com/apache/arrow/go/v14/arrow/memory"
+	"github.com/apache/arrow/go/v14/parquet/file"
+	"github.com/apache/arrow/go/v14/parquet/pqarrow"
+	"github.com/pivolan/stats_analyzer/domain/models"
+)
+
+var (
+	parquetMagic     = []byte("PAR1")
+	arrowFileMagic   = []byte("ARROW1")
+	arrowStreamMagic = []byte{0xFF, 0xFF, 0xFF, 0xFF}
+)
+
+// arrowRecordSource — общий интерфейс для пакетов записей из Parquet и Arrow IPC
+type arrowRecordSource interface {
+	Next() bool
+	Record() arrow.Record
+	Err() error
+}
+
+// ipcFileRecords перебирает пакеты записей Arrow IPC файла (Feather v2)
+type ipcFileRecords struct {
+	reader *ipc.FileReader
+	index  int
+	record arrow.Record
+	err    error
+}
+
+func (r *ipcFileRecords) Next() bool {
+	if r.err != nil || r.index >= r.reader.NumRecords() {
+		return false
+	}
+	r.record, r.err = r.reader.Record(r.index)
+	r.index++
+	return r.err == nil
+}
+
+func (r *ipcFileRecords) Record() arrow.Record {
+	return r.record
+}
+
+func (r *ipcFileRecords) Err() error {
+	return r.err
+}
+
+// arrowRowReader превращает колоночные пакеты записей в строки для importRows
+type arrowRowReader struct {
+	source arrowRecordSource
+	record arrow.Record
+	row    int
+}
+
+func (r *arrowRowReader) Read() ([]string, error) {
+	for r.record == nil || r.row >= int(r.record.NumRows()) {
+		if !r.source.Next() {
+			if err := r.source.Err(); err != nil && err != io.EOF {
+				return nil, err
+			}
+			return nil, io.EOF
+		}
+		r.record = r.source.Record()
+		r.row = 0
+	}
+	values := make([]string, r.record.NumCols())
+	for i, column := range r.record.Columns() {
+		values[i] = arrowValueString(column, r.row)
+	}
+	r.row++
+	return values, nil
+}
+
+// arrowTypeToClickHouse сопоставляет логический тип Arrow/Parquet с типом колонки ClickHouse
+func arrowTypeToClickHouse(dataType arrow.DataType) string {
+	switch dataType.ID() {
+	case arrow.INT8, arrow.INT16, arrow.INT32, arrow.INT64,
+		arrow.UINT8, arrow.UINT16, arrow.UINT32:
+		return "Int64"
+	case arrow.UINT64:
+		// Значения больше 2^63 не помещаются в Int64
+		return "UInt64"
+	case arrow.FLOAT16, arrow.FLOAT32, arrow.FLOAT64:
+		return "Float64"
+	case arrow.DECIMAL128:
+		decimal := dataType.(*arrow.Decimal128Type)
+		return fmt.Sprintf("Decimal(%d, %d)", decimal.Precision, decimal.Scale)
+	case arrow.DECIMAL256:
+		// ClickHouse хранит Decimal с точностью до 76 знаков, как и Decimal256
+		decimal := dataType.(*arrow.Decimal256Type)
+		return fmt.Sprintf("Decimal(%d, %d)", decimal.Precision, decimal.Scale)
+	case arrow.BOOL:
+		return "Bool"
+	case arrow.DATE32, arrow.DATE64:
+		return "Date"
+	case arrow.TIMESTAMP:
+		return "DateTime64"
+	case arrow.DICTIONARY:
+		valueType := arrowTypeToClickHouse(dataType.(*arrow.DictionaryType).ValueType)
+		if valueType == "String" {
+			return "LowCardinality(String)"
+		}
+		return valueType
+	default:
+		return "String"
+	}
+}
+
+// arrowValueString форматирует значение так же, как оно выглядело бы в CSV файле
+func arrowValueString(column arrow.Array, i int) string {
+	if column.IsNull(i) {
+		return ""
+	}
+	switch arr := column.(type) {
+	case *array.Date32:
+		return arr.Value(i).ToTime().Format("2006-01-02")
+	case *array.Date64:
+		return arr.Value(i).ToTime().Format("2006-01-02")
+	case *array.Timestamp:
+		unit := arr.DataType().(*arrow.TimestampType).Unit
+		return arr.Value(i).ToTime(unit).UTC().Format("2006-01-02 15:04:05.999999")
+	case *array.Float32:
+		return strconv.FormatFloat(float64(arr.Value(i)), 'f', -1, 32)
+	case *array.Float64:
+		return strconv.FormatFloat(arr.Value(i), 'f', -1, 64)
+	case *array.String:
+		return arr.Value(i)
+	case *array.LargeString:
+		return arr.Value(i)
+	case *array.Binary:
+		return string(arr.Value(i))
+	case *array.Decimal128:
+		return arr.Value(i).ToString(arr.DataType().(*arrow.Decimal128Type).Scale)
+	case *array.Decimal256:
+		return arr.Value(i).ToString(arr.DataType().(*arrow.Decimal256Type).Scale)
+	case *array.Dictionary:
+		return arrowValueString(arr.Dictionary(), arr.GetValueIndex(i))
+	default:
+		return column.ValueStr(i)
+	}
+}
+
+// schemaColumns строит заголовки и типы таблицы прямо по схеме файла, без угадывания типов
+func schemaColumns(schema *arrow.Schema) (headers, labels, types, nullables []string) {
+	fields := schema.Fields()
+	headers = make([]string, len(fields))
+	labels = make([]string, len(fields))
+	types = make([]string, len(fields))
+	nullables = make([]string, len(fields))
+	for i, field := range fields {
+		headers[i] = cleanHeaderName(field.Name, i)
+		labels[i] = field.Name
+		types[i] = arrowTypeToClickHouse(field.Type)
+		if field.Nullable {
+			nullables[i] = " NULL "
+		}
+	}
+	headers = addNumberPrefix(ValidateHeaders(headers))
+	return headers, labels, types, nullables
+}
+
+func importParquetIntoClickHouse(filePath string, db DBInterface, opts importOptions) (models.ClickhouseTableName, error) {
+	parquetFile, err := file.OpenParquetFile(filePath, false)
+	if err != nil {
+		return "", fmt.Errorf("cannot open parquet file: %v", err)
+	}
+	defer parquetFile.Close()
+
+	reader, err := pqarrow.NewFileReader(parquetFile, pqarrow.ArrowReadProperties{BatchSize: 10000}, memory.DefaultAllocator)
+	if err != nil {
+		return "", fmt.Errorf("cannot read parquet file: %v", err)
+	}
+	schema, err := reader.Schema()
+	if err != nil {
+		return "", fmt.Errorf("cannot read parquet schema: %v", err)
+	}
+	if len(schema.Fields()) == 0 {
+		return "", fmt.Errorf("empty parquet file")
+	}
+	records, err := reader.GetRecordReader(context.Background(), nil, nil)
+	if err != nil {
+		return "", fmt.Errorf("cannot read parquet records: %v", err)
+	}
+	defer records.Release()
+
+	headers, labels, types, nullables := schemaColumns(schema)
+	opts.Progress.Track(0, nil)
+	return importRows(db, filePath, headers, labels, types, nullables, nil, opts.Progress.CountRows(&arrowRowReader{source: records}), opts)
+}
+
+func importArrowIntoClickHouse(filePath string, db DBInterface, opts importOptions) (models.ClickhouseTableName, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	var schema *arrow.Schema
+	var source arrowRecordSource
+	if fileReader, err := ipc.NewFileReader(f); err == nil {
+		defer fileReader.Close()
+		schema = fileReader.Schema()
+		source = &ipcFileRecords{reader: fileReader}
+	} else {
+		// Не файл, а поток Arrow IPC
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return "", err
+		}
+		streamReader, err := ipc.NewReader(f)
+		if err != nil {
+			return "", fmt.Errorf("cannot read arrow file: %v", err)
+		}
+		defer streamReader.Release()
+		schema = streamReader.Schema()
+		source = streamReader
+	}
+	if len(schema.Fields()) == 0 {
+		return "", fmt.Errorf("empty arrow file")
+	}
+
+	headers, labels, types, nullables := schemaColumns(schema)
+	opts.Progress.Track(0, nil)
+	return importRows(db, filePath, headers, labels, types, nullables, nil, opts.Progress.CountRows(&arrowRowReader{source: source}), opts)
+}
+
+// readMagic читает первые байты файла для определения формата
+func readMagic(filePath string, n int) []byte {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	buffer := make([]byte, n)
+	read, _ := io.ReadFull(f, buffer)
+	return buffer[:read]
+}
+
+func isParquetFile(filePath string) bool {
+	return bytes.HasPrefix(readMagic(filePath, len(parquetMagic)), parquetMagic)
+}
+
+func isArrowFile(filePath string) bool {
+	magic := readMagic(filePath, len(arrowFileMagic))
+	return bytes.HasPrefix(magic, arrowFileMagic) || bytes.HasPrefix(magic, arrowStreamMagic)
+}
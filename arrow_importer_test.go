@@ -0,0 +1,130 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/apache/arrow/go/v14/arrow"
+	"github.com/apache/arrow/go/v14/arrow/array"
+	"github.com/apache/arrow/go/v14/arrow/ipc"
+	"github.com/apache/arrow/go/v14/arrow/memory"
+	"github.com/apache/arrow/go/v14/parquet/pqarrow"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/gorm"
+)
+
+// buildTestRecord собирает пакет записей со всеми основными логическими типами
+func buildTestRecord(t *testing.T) arrow.Record {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "user id", Type: arrow.PrimitiveTypes.Int32},
+		{Name: "amount", Type: arrow.PrimitiveTypes.Float64, Nullable: true},
+		{Name: "city", Type: arrow.BinaryTypes.String},
+		{Name: "birthday", Type: arrow.FixedWidthTypes.Date32},
+		{Name: "created_at", Type: &arrow.TimestampType{Unit: arrow.Millisecond}},
+	}, nil)
+
+	builder := array.NewRecordBuilder(memory.DefaultAllocator, schema)
+	defer builder.Release()
+	builder.Field(0).(*array.Int32Builder).AppendValues([]int32{1, 2}, nil)
+	builder.Field(1).(*array.Float64Builder).AppendValues([]float64{10.5, 0}, []bool{true, false})
+	builder.Field(2).(*array.StringBuilder).AppendValues([]string{"Moscow", "Kazan"}, nil)
+	builder.Field(3).(*array.Date32Builder).AppendValues([]arrow.Date32{19723, 19724}, nil)
+	builder.Field(4).(*array.TimestampBuilder).AppendValues([]arrow.Timestamp{1704103200000, 1704189600500}, nil)
+	return builder.NewRecord()
+}
+
+func TestImportColumnarFiles(t *testing.T) {
+	original := getMD5String
+	getMD5String = func(input string) string {
+		return "123456"
+	}
+	defer func() {
+		getMD5String = original
+	}()
+
+	record := buildTestRecord(t)
+	defer record.Release()
+
+	dir := t.TempDir()
+	// Parquet файл с нестандартным расширением — формат определяется по сигнатуре
+	parquetPath := filepath.Join(dir, "data.bin")
+	parquetFile, err := os.Create(parquetPath)
+	assert.NoError(t, err)
+	table := array.NewTableFromRecords(record.Schema(), []arrow.Record{record})
+	defer table.Release()
+	assert.NoError(t, pqarrow.WriteTable(table, parquetFile, 1024, nil, pqarrow.DefaultWriterProps()))
+	parquetFile.Close()
+
+	arrowPath := filepath.Join(dir, "data.feather")
+	arrowFile, err := os.Create(arrowPath)
+	assert.NoError(t, err)
+	writer, err := ipc.NewFileWriter(arrowFile, ipc.WithSchema(record.Schema()))
+	assert.NoError(t, err)
+	assert.NoError(t, writer.Write(record))
+	assert.NoError(t, writer.Close())
+	arrowFile.Close()
+
+	testCases := []struct {
+		name   string
+		path   string
+		format string
+	}{
+		{"parquet", parquetPath, FORMAT_PARQUET},
+		{"arrow ipc", arrowPath, FORMAT_ARROW},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.format, detectFileFormat(tc.path))
+
+			mockDB := NewMockDB()
+			mockDB.On("Exec", mock.Anything, mock.Anything).Return(&gorm.DB{})
+			tables, err := importFileIntoClickHouse(tc.path, mockDB, importOptions{})
+			assert.NoError(t, err)
+			assert.Len(t, tables, 1)
+
+			createSQL := ""
+			for _, call := range mockDB.Calls {
+				if query := call.Arguments.String(0); strings.HasPrefix(query, "CREATE TABLE") {
+					createSQL = query
+				}
+			}
+			assert.Contains(t, createSQL, "0001_user_id Int64")
+			assert.Contains(t, createSQL, "0002_amount Float64  NULL")
+			assert.Contains(t, createSQL, "0003_city String")
+			assert.Contains(t, createSQL, "0004_birthday Date")
+			assert.Contains(t, createSQL, "0005_created_at DateTime64")
+			assert.Equal(t, "INSERT INTO 0001_user_id_0002_amount_0003_city_123456 SETTINGS max_query_size = 5048576, max_insert_block_size = 5000000 FORMAT CSV \n"+
+				"1,1,10.5,Moscow,2024-01-01,2024-01-01 10:00:00\n"+
+				"2,2,,Kazan,2024-01-02,2024-01-02 10:00:00.5\n", mockDB.lastQuery)
+		})
+	}
+}
+
+func TestArrowTypeToClickHouse(t *testing.T) {
+	testCases := []struct {
+		dataType arrow.DataType
+		expected string
+	}{
+		{arrow.PrimitiveTypes.Int32, "Int64"},
+		{arrow.PrimitiveTypes.Uint32, "Int64"},
+		{arrow.PrimitiveTypes.Uint64, "UInt64"},
+		{arrow.PrimitiveTypes.Float32, "Float64"},
+		{&arrow.Decimal128Type{Precision: 18, Scale: 2}, "Decimal(18, 2)"},
+		{&arrow.Decimal256Type{Precision: 60, Scale: 10}, "Decimal(60, 10)"},
+		{&arrow.DictionaryType{IndexType: arrow.PrimitiveTypes.Int8, ValueType: arrow.BinaryTypes.String}, "LowCardinality(String)"},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.expected, arrowTypeToClickHouse(tc.dataType), tc.dataType.String())
+	}
+
+	builder := array.NewUint64Builder(memory.DefaultAllocator)
+	defer builder.Release()
+	builder.Append(18446744073709551615)
+	values := builder.NewArray()
+	defer values.Release()
+	assert.Equal(t, "18446744073709551615", arrowValueString(values, 0))
+	assert.True(t, IsNumericType("UInt64"))
+}
@@ -0,0 +1,371 @@
+// association.go
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"github.com/pivolan/stats_analyzer/domain/models"
+	"gorm.io/gorm"
+)
+
+// Связь категориальных колонок: таблица сопряженности, тест хи-квадрат и V Крамера.
+// V от 0 (колонки независимы) до 1 (значение одной колонки однозначно задает другую)
+const (
+	maxAssociationCategories = 50   // у колонок с большим числом значений таблица сопряженности слишком разреженная
+	maxAssociationColumns    = 12   // пар получается n*(n-1)/2, каждая строка таблицы при подсчете размножается на число пар
+	associationMinV          = 0.1  // более слабые связи в отчет не попадают
+	associationSignificance  = 0.05 // уровень значимости теста хи-квадрат
+	reportAssociationsLimit  = 5
+	maxCrosstabValues        = 12 // строк и столбцов в /crosstab, остальные значения собираются в CROSSTAB_OTHER
+	CROSSTAB_OTHER           = "(остальные)"
+)
+
+// crosstabCell — строка результата группировки по двум колонкам
+type crosstabCell struct {
+	ValueA string
+	ValueB string
+	Cnt    int64
+}
+
+// associationCell — строка группировки всех пар сразу: Pair — номер пары в порядке перебора колонок
+type associationCell struct {
+	Pair   int
+	ValueA string
+	ValueB string
+	Cnt    int64
+}
+
+// contingencyTable — таблица сопряженности: строки — значения первой колонки, столбцы — второй,
+// значения упорядочены по убыванию частоты
+type contingencyTable struct {
+	Rows    []string
+	Columns []string
+	Counts  [][]int64
+	Total   int64
+}
+
+// chiSquareResult — итог теста независимости
+type chiSquareResult struct {
+	ChiSquare float64
+	DF        int
+	PValue    float64
+	CramersV  float64
+	// Больше 20% ожидаемых частот меньше 5: приближение хи-квадрат неточное, p-значение ориентировочное
+	LowExpected bool
+}
+
+// associationPair — пара колонок с результатом теста
+type associationPair struct {
+	A, B   string
+	Result chiSquareResult
+}
+
+// buildContingencyTable собирает таблицу из строк группировки
+func buildContingencyTable(cells []crosstabCell) *contingencyTable {
+	rowTotals, columnTotals := map[string]int64{}, map[string]int64{}
+	for _, cell := range cells {
+		rowTotals[cell.ValueA] += cell.Cnt
+		columnTotals[cell.ValueB] += cell.Cnt
+	}
+	t := &contingencyTable{Rows: sortedByCount(rowTotals), Columns: sortedByCount(columnTotals)}
+	rowIndex, columnIndex := indexOf(t.Rows), indexOf(t.Columns)
+	t.Counts = make([][]int64, len(t.Rows))
+	for i := range t.Counts {
+		t.Counts[i] = make([]int64, len(t.Columns))
+	}
+	for _, cell := range cells {
+		t.Counts[rowIndex[cell.ValueA]][columnIndex[cell.ValueB]] += cell.Cnt
+		t.Total += cell.Cnt
+	}
+	return t
+}
+
+// sortedByCount — значения по убыванию частоты; CROSSTAB_OTHER всегда последним
+func sortedByCount(totals map[string]int64) []string {
+	values := make([]string, 0, len(totals))
+	for value := range totals {
+		values = append(values, value)
+	}
+	sort.Slice(values, func(i, j int) bool {
+		if (values[i] == CROSSTAB_OTHER) != (values[j] == CROSSTAB_OTHER) {
+			return values[j] == CROSSTAB_OTHER
+		}
+		if totals[values[i]] != totals[values[j]] {
+			return totals[values[i]] > totals[values[j]]
+		}
+		return values[i] < values[j]
+	})
+	return values
+}
+
+func indexOf(values []string) map[string]int {
+	index := make(map[string]int, len(values))
+	for i, value := range values {
+		index[value] = i
+	}
+	return index
+}
+
+func (t *contingencyTable) RowTotal(i int) int64 {
+	var total int64
+	for _, count := range t.Counts[i] {
+		total += count
+	}
+	return total
+}
+
+func (t *contingencyTable) ColumnTotal(j int) int64 {
+	var total int64
+	for i := range t.Counts {
+		total += t.Counts[i][j]
+	}
+	return total
+}
+
+// ChiSquare — тест хи-квадрат на независимость и V Крамера
+func (t *contingencyTable) ChiSquare() chiSquareResult {
+	r, c := len(t.Rows), len(t.Columns)
+	if r < 2 || c < 2 || t.Total == 0 {
+		return chiSquareResult{PValue: math.NaN(), CramersV: math.NaN()}
+	}
+	chi := 0.0
+	low := 0
+	for i := 0; i < r; i++ {
+		rowTotal := float64(t.RowTotal(i))
+		for j := 0; j < c; j++ {
+			expected := rowTotal * float64(t.ColumnTotal(j)) / float64(t.Total)
+			if expected < 5 {
+				low++
+			}
+			diff := float64(t.Counts[i][j]) - expected
+			chi += diff * diff / expected
+		}
+	}
+	result := chiSquareResult{ChiSquare: chi, DF: (r - 1) * (c - 1), LowExpected: low*5 > r*c}
+	result.PValue = chiSquareSurvival(chi, result.DF)
+	result.CramersV = math.Sqrt(chi / float64(t.Total) / float64(min(r, c)-1))
+	return result
+}
+
+// associationColumns — текстовые и булевы колонки с небольшим числом значений, по uniq из общей статистики
+func associationColumns(columns []models.ColumnInfo, uniqInfos map[string]CommonStat) []string {
+	result := []string{}
+	for _, column := range columns {
+		if isServiceColumn(column) || excludeColumn(column.Name) || !(IsCategoryType(column.Type) || IsBoolType(column.Type)) {
+			continue
+		}
+		if uniq := uniqInfos[column.Name].Uniq; uniq < 2 || uniq > maxAssociationCategories {
+			continue
+		}
+		result = append(result, column.Name)
+		if len(result) == maxAssociationColumns {
+			break
+		}
+	}
+	return result
+}
+
+// generateSqlForCrosstab группирует строки по двум колонкам. Значения за пределами maxValues самых частых
+// заменяются на CROSSTAB_OTHER, чтобы результат оставался небольшим при любом числе значений
+func generateSqlForCrosstab(columnA, columnB string, table models.ClickhouseTableName, maxValues int) string {
+	return fmt.Sprintf(`SELECT %s AS value_a, %s AS value_b, count() AS cnt
+        FROM %s
+        WHERE %s IS NOT NULL AND %s IS NOT NULL
+        GROUP BY value_a, value_b`,
+		crosstabValueSQL(columnA, table, maxValues), crosstabValueSQL(columnB, table, maxValues),
+		table, columnA, columnB)
+}
+
+func crosstabValueSQL(column string, table models.ClickhouseTableName, maxValues int) string {
+	return fmt.Sprintf("if(toString(%[1]s) IN (SELECT toString(%[1]s) FROM %[2]s WHERE %[1]s IS NOT NULL GROUP BY toString(%[1]s) ORDER BY count() DESC LIMIT %[3]d), toString(%[1]s), '%[4]s')",
+		column, table, maxValues, CROSSTAB_OTHER)
+}
+
+// loadContingencyTable читает таблицу сопряженности двух колонок
+func loadContingencyTable(db *gorm.DB, tableName models.ClickhouseTableName, columnA, columnB string, maxValues int) (*contingencyTable, error) {
+	var cells []crosstabCell
+	if err := db.Raw(generateSqlForCrosstab(columnA, columnB, tableName, maxValues)).Scan(&cells).Error; err != nil {
+		return nil, err
+	}
+	return buildContingencyTable(cells), nil
+}
+
+// generateSqlForAssociations собирает таблицы сопряженности всех пар за один проход по таблице: arrayJoin
+// превращает строку в кортеж (номер пары, значение, значение) для каждой пары, и группировка идет по кортежам.
+// У колонок не больше maxAssociationCategories значений, поэтому результат не больше пар × 50 × 50 строк
+// и редкие значения не нужно собирать в CROSSTAB_OTHER, как в /crosstab
+func generateSqlForAssociations(columns []string, table models.ClickhouseTableName) string {
+	tuples := []string{}
+	for i := range columns {
+		for j := i + 1; j < len(columns); j++ {
+			tuples = append(tuples, fmt.Sprintf("tuple(%d, toString(%s), toString(%s))", len(tuples), columns[i], columns[j]))
+		}
+	}
+	return fmt.Sprintf(`SELECT cell.1 AS pair, cell.2 AS value_a, cell.3 AS value_b, count() AS cnt
+        FROM (SELECT arrayJoin([%s]) AS cell FROM %s)
+        WHERE value_a IS NOT NULL AND value_b IS NOT NULL
+        GROUP BY pair, value_a, value_b`, strings.Join(tuples, ", "), table)
+}
+
+// associationPairsFromCells раскладывает строки группировки по парам и считает тест для каждой
+func associationPairsFromCells(columns []string, cells []associationCell) []associationPair {
+	byPair := map[int][]crosstabCell{}
+	for _, cell := range cells {
+		byPair[cell.Pair] = append(byPair[cell.Pair], crosstabCell{ValueA: cell.ValueA, ValueB: cell.ValueB, Cnt: cell.Cnt})
+	}
+	pairs := []associationPair{}
+	for i := range columns {
+		for j := i + 1; j < len(columns); j++ {
+			t := buildContingencyTable(byPair[len(pairs)])
+			pairs = append(pairs, associationPair{A: columns[i], B: columns[j], Result: t.ChiSquare()})
+		}
+	}
+	return pairs
+}
+
+// computeAssociations считает тест для каждой пары категориальных колонок одним запросом; сильные связи первыми
+func computeAssociations(db *gorm.DB, tableName models.ClickhouseTableName, columns []models.ColumnInfo, uniqInfos map[string]CommonStat) ([]associationPair, error) {
+	categorical := associationColumns(columns, uniqInfos)
+	if len(categorical) < 2 {
+		return []associationPair{}, nil
+	}
+	var cells []associationCell
+	if err := db.Raw(generateSqlForAssociations(categorical, tableName)).Scan(&cells).Error; err != nil {
+		return nil, err
+	}
+	pairs := associationPairsFromCells(categorical, cells)
+	rankAssociations(pairs)
+	return pairs, nil
+}
+
+// rankAssociations сортирует пары по V Крамера, пары без результата в конце
+func rankAssociations(pairs []associationPair) {
+	sort.SliceStable(pairs, func(i, j int) bool {
+		vi, vj := pairs[i].Result.CramersV, pairs[j].Result.CramersV
+		if math.IsNaN(vj) {
+			return !math.IsNaN(vi)
+		}
+		return vi > vj
+	})
+}
+
+// describeCramersV — сила связи словами
+func describeCramersV(v float64) string {
+	switch {
+	case v >= 0.5:
+		return "сильная"
+	case v >= 0.3:
+		return "заметная"
+	case v >= associationMinV:
+		return "слабая"
+	}
+	return "нет связи"
+}
+
+func formatPValue(p float64) string {
+	switch {
+	case math.IsNaN(p):
+		return "p = —"
+	case p < 0.001:
+		return "p < 0.001"
+	}
+	return fmt.Sprintf("p = %.3f", p)
+}
+
+// formatAssociations — значимые связи между категориальными колонками; пустая строка, если их нет
+func formatAssociations(tableName models.ClickhouseTableName, pairs []associationPair, limit int) string {
+	var result strings.Builder
+	count := 0
+	for _, pair := range pairs {
+		r := pair.Result
+		if math.IsNaN(r.CramersV) || r.CramersV < associationMinV || r.PValue >= associationSignificance {
+			continue
+		}
+		if limit > 0 && count == limit {
+			break
+		}
+		if count == 0 {
+			result.WriteString("🧩 Связи между категориальными колонками (V Крамера):\n")
+		}
+		count++
+		note := ""
+		if r.LowExpected {
+			note = ", мало данных для точного p"
+		}
+		result.WriteString(fmt.Sprintf("• %s ↔ %s: V = %.2f, χ² = %.1f, %s — %s%s\n",
+			columnLabel(tableName, pair.A), columnLabel(tableName, pair.B), r.CramersV, r.ChiSquare, formatPValue(r.PValue),
+			describeCramersV(r.CramersV), note))
+	}
+	return result.String()
+}
+
+// formatCrosstab — таблица сопряженности с процентами по строке и по столбцу в каждой ячейке
+func formatCrosstab(labelA, labelB string, t *contingencyTable) string {
+	tw := table.NewWriter()
+	header := table.Row{labelA + " \\ " + labelB}
+	for _, column := range t.Columns {
+		header = append(header, column)
+	}
+	tw.AppendHeader(append(header, "Всего"))
+	for i, row := range t.Rows {
+		rowTotal := t.RowTotal(i)
+		values := table.Row{row}
+		for j := range t.Columns {
+			count := t.Counts[i][j]
+			values = append(values, fmt.Sprintf("%d\n%s стр · %s стлб", count,
+				formatShare(count, rowTotal), formatShare(count, t.ColumnTotal(j))))
+		}
+		tw.AppendRows([]table.Row{append(values, fmt.Sprintf("%d\n%s", rowTotal, formatShare(rowTotal, t.Total)))})
+	}
+	footer := table.Row{"Всего"}
+	for j := range t.Columns {
+		footer = append(footer, fmt.Sprintf("%d\n%s", t.ColumnTotal(j), formatShare(t.ColumnTotal(j), t.Total)))
+	}
+	tw.AppendRows([]table.Row{append(footer, t.Total)})
+	tw.SetStyle(table.StyleDefault)
+	tw.Style().Options.SeparateRows = true
+	// Названия колонок и значения показываются как в файле, без перевода в верхний регистр
+	tw.Style().Format.Header = text.FormatDefault
+	return tw.Render()
+}
+
+func formatShare(part, total int64) string {
+	if total == 0 {
+		return "0%"
+	}
+	return fmt.Sprintf("%.1f%%", float64(part)*100/float64(total))
+}
+
+// formatChiSquare — итог теста для /crosstab
+func formatChiSquare(r chiSquareResult) string {
+	if math.IsNaN(r.CramersV) {
+		return "Тест хи-квадрат не применим: у одной из колонок меньше двух значений"
+	}
+	text := fmt.Sprintf("χ² = %.2f, степеней свободы %d, %s\nV Крамера = %.3f — %s",
+		r.ChiSquare, r.DF, formatPValue(r.PValue), r.CramersV, describeCramersV(r.CramersV))
+	if r.PValue >= associationSignificance {
+		text += "\nЗависимость статистически не значима"
+	}
+	if r.LowExpected {
+		text += "\n⚠️ Больше 20% ожидаемых частот меньше 5, p-значение ориентировочное"
+	}
+	return text
+}
+
+// findColumnPair разбирает аргументы /crosstab: названия колонок могут содержать пробелы,
+// поэтому пробуются все места разбиения, пока обе части не найдутся среди колонок
+func findColumnPair(tableName models.ClickhouseTableName, columns []models.ColumnInfo, args []string) (*models.ColumnInfo, *models.ColumnInfo) {
+	for i := 1; i < len(args); i++ {
+		a := findColumn(tableName, columns, strings.Join(args[:i], " "))
+		b := findColumn(tableName, columns, strings.Join(args[i:], " "))
+		if a != nil && b != nil {
+			return a, b
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/pivolan/stats_analyzer/domain/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChiSquareSurvival(t *testing.T) {
+	testCases := []struct {
+		x        float64
+		df       int
+		expected float64
+	}{
+		{3.841459, 1, 0.05},
+		{6.634897, 1, 0.01},
+		{18.307038, 10, 0.05},
+		{0, 3, 1},
+		{200, 4, 101 * math.Exp(-100)},
+	}
+	for _, tc := range testCases {
+		assert.InEpsilon(t, tc.expected, chiSquareSurvival(tc.x, tc.df), 1e-4, "x=%v df=%d", tc.x, tc.df)
+	}
+	assert.InDelta(t, 1-math.Exp(-2.5), regularizedGammaP(1, 2.5), 1e-12)
+	assert.True(t, math.IsNaN(chiSquareSurvival(1, 0)))
+}
+
+func TestContingencyTableChiSquare(t *testing.T) {
+	table := buildContingencyTable([]crosstabCell{
+		{"Москва", "карта", 40}, {"Москва", "наличные", 30},
+		{"Казань", "карта", 20}, {"Казань", "наличные", 10},
+	})
+	assert.Equal(t, []string{"Москва", "Казань"}, table.Rows)
+	assert.Equal(t, []string{"карта", "наличные"}, table.Columns)
+	assert.Equal(t, [][]int64{{40, 30}, {20, 10}}, table.Counts)
+	assert.Equal(t, int64(100), table.Total)
+	assert.Equal(t, int64(60), table.ColumnTotal(0))
+	assert.Equal(t, int64(30), table.RowTotal(1))
+
+	r := table.ChiSquare()
+	assert.InDelta(t, 0.79365, r.ChiSquare, 1e-5)
+	assert.Equal(t, 1, r.DF)
+	assert.InDelta(t, 0.373, r.PValue, 1e-3)
+	assert.InDelta(t, 0.0891, r.CramersV, 1e-4)
+	assert.False(t, r.LowExpected)
+
+	// Колонка B полностью определяется колонкой A
+	perfect := buildContingencyTable([]crosstabCell{{"a", "x", 50}, {"b", "y", 30}, {"c", "z", 20}})
+	assert.InDelta(t, 1, perfect.ChiSquare().CramersV, 1e-9)
+
+	small := buildContingencyTable([]crosstabCell{{"a", "x", 2}, {"a", "y", 1}, {"b", "x", 1}, {"b", "y", 3}})
+	assert.True(t, small.ChiSquare().LowExpected)
+
+	single := buildContingencyTable([]crosstabCell{{"a", "x", 2}, {"b", "x", 1}})
+	assert.True(t, math.IsNaN(single.ChiSquare().CramersV))
+}
+
+func TestSortedByCountKeepsOtherLast(t *testing.T) {
+	assert.Equal(t, []string{"b", "a", "c", CROSSTAB_OTHER}, sortedByCount(map[string]int64{"a": 5, CROSSTAB_OTHER: 100, "b": 10, "c": 5}))
+}
+
+func TestAssociationColumns(t *testing.T) {
+	columns := []models.ColumnInfo{
+		{Name: "id", Type: "Int64"},
+		{Name: LOAD_BATCH_COLUMN, Type: "LowCardinality(String)"},
+		{Name: "0001_city", Type: "LowCardinality(String)"},
+		{Name: "0002_email", Type: "String"},
+		{Name: "0003_paid", Type: "Bool"},
+		{Name: "0004_amount", Type: "Int64"},
+		{Name: "0005_status", Type: "Nullable(String)"},
+		{Name: "0006_country", Type: "String"},
+	}
+	uniq := map[string]CommonStat{
+		LOAD_BATCH_COLUMN: {Uniq: 3},
+		"0001_city":       {Uniq: 12},
+		"0002_email":      {Uniq: 5000},
+		"0003_paid":       {Uniq: 2},
+		"0004_amount":     {Uniq: 10},
+		"0005_status":     {Uniq: 4},
+		"0006_country":    {Uniq: 1},
+	}
+	assert.Equal(t, []string{"0001_city", "0003_paid", "0005_status"}, associationColumns(columns, uniq))
+}
+
+func TestGenerateSqlForCrosstab(t *testing.T) {
+	sql := generateSqlForCrosstab("0001_city", "0002_pay", "orders_123456", 12)
+	assert.Contains(t, sql, "if(toString(0001_city) IN (SELECT toString(0001_city) FROM orders_123456 WHERE 0001_city IS NOT NULL GROUP BY toString(0001_city) ORDER BY count() DESC LIMIT 12), toString(0001_city), '(остальные)') AS value_a")
+	assert.Contains(t, sql, "AS value_b, count() AS cnt")
+	assert.Contains(t, sql, "WHERE 0001_city IS NOT NULL AND 0002_pay IS NOT NULL")
+	assert.Contains(t, sql, "GROUP BY value_a, value_b")
+}
+
+func TestGenerateSqlForAssociations(t *testing.T) {
+	sql := generateSqlForAssociations([]string{"0001_city", "0002_pay", "0003_paid"}, "orders_123456")
+	assert.Contains(t, sql, "arrayJoin([tuple(0, toString(0001_city), toString(0002_pay)), "+
+		"tuple(1, toString(0001_city), toString(0003_paid)), tuple(2, toString(0002_pay), toString(0003_paid))]) AS cell FROM orders_123456")
+	assert.Contains(t, sql, "WHERE value_a IS NOT NULL AND value_b IS NOT NULL")
+	assert.Contains(t, sql, "GROUP BY pair, value_a, value_b")
+	assert.Equal(t, 1, strings.Count(sql, "FROM orders_123456"))
+}
+
+func TestAssociationPairsFromCells(t *testing.T) {
+	columns := []string{"0001_city", "0002_pay", "0003_paid"}
+	cells := []associationCell{
+		{0, "Москва", "карта", 50}, {0, "Казань", "наличные", 30},
+		{1, "Москва", "true", 40}, {1, "Москва", "false", 10}, {1, "Казань", "true", 24}, {1, "Казань", "false", 6},
+	}
+	pairs := associationPairsFromCells(columns, cells)
+	assert.Len(t, pairs, 3)
+	assert.Equal(t, associationPair{A: "0001_city", B: "0002_pay"}, associationPair{A: pairs[0].A, B: pairs[0].B})
+	assert.InDelta(t, 1.0, pairs[0].Result.CramersV, 1e-9)
+	assert.InDelta(t, 0.0, pairs[1].Result.CramersV, 1e-9)
+	assert.Equal(t, "0003_paid", pairs[2].B)
+	// Для пары без строк тест не применим
+	assert.True(t, math.IsNaN(pairs[2].Result.CramersV))
+}
+
+func TestFormatAssociations(t *testing.T) {
+	table := models.ClickhouseTableName("associations_table")
+	setColumnMeta(table, map[string]models.ColumnMeta{"0001_city": {Label: "Город"}, "0002_pay": {Label: "Оплата"}})
+	defer deleteColumnMeta(table)
+
+	pairs := []associationPair{
+		{A: "0001_city", B: "0003_status", Result: chiSquareResult{ChiSquare: 12.5, DF: 4, PValue: 0.014, CramersV: 0.12, LowExpected: true}},
+		{A: "0001_city", B: "0002_pay", Result: chiSquareResult{ChiSquare: 340.2, DF: 2, PValue: 1e-20, CramersV: 0.55}},
+		{A: "0002_pay", B: "0003_status", Result: chiSquareResult{ChiSquare: 1.1, DF: 2, PValue: 0.6, CramersV: 0.3}},
+		{A: "0002_pay", B: "0004_source", Result: chiSquareResult{PValue: math.NaN(), CramersV: math.NaN()}},
+	}
+	rankAssociations(pairs)
+	assert.Equal(t, "0002_pay", pairs[0].B)
+	assert.Equal(t, "0004_source", pairs[3].B)
+	assert.Equal(t, "🧩 Связи между категориальными колонками (V Крамера):\n"+
+		"• Город ↔ Оплата: V = 0.55, χ² = 340.2, p < 0.001 — сильная\n"+
+		"• Город ↔ status: V = 0.12, χ² = 12.5, p = 0.014 — слабая, мало данных для точного p\n",
+		formatAssociations(table, pairs, 0))
+	// Не значимая и не посчитанная пары в отчет не попадают
+	assert.Equal(t, "", formatAssociations(table, []associationPair{pairs[1], pairs[3]}, 0))
+}
+
+func TestFormatCrosstab(t *testing.T) {
+	table := buildContingencyTable([]crosstabCell{
+		{"Москва", "карта", 40}, {"Москва", "наличные", 30},
+		{"Казань", "карта", 20}, {"Казань", "наличные", 10},
+	})
+	text := formatCrosstab("Город", "Оплата", table)
+	assert.Contains(t, text, "Город \\ Оплата")
+	// Москва × карта: 40 из 70 строк Москвы и 40 из 60 оплат картой
+	assert.Contains(t, text, "57.1% стр · 66.7% стлб")
+	assert.Contains(t, text, "Всего")
+	assert.Contains(t, text, "100")
+
+	summary := formatChiSquare(table.ChiSquare())
+	assert.True(t, strings.HasPrefix(summary, "χ² = 0.79, степеней свободы 1, p = 0.373"))
+	assert.Contains(t, summary, "Зависимость статистически не значима")
+}
+
+func TestFindColumnPair(t *testing.T) {
+	table := models.ClickhouseTableName("crosstab_pair_table")
+	setColumnMeta(table, map[string]models.ColumnMeta{"0001_city": {Label: "Город"}, "0002_pay": {Label: "Способ оплаты"}})
+	defer deleteColumnMeta(table)
+	columns := []models.ColumnInfo{{Name: "id"}, {Name: "0001_city"}, {Name: "0002_pay"}}
+
+	a, b := findColumnPair(table, columns, strings.Fields("город способ оплаты"))
+	assert.Equal(t, "0001_city", a.Name)
+	assert.Equal(t, "0002_pay", b.Name)
+	a, b = findColumnPair(table, columns, []string{"pay", "city"})
+	assert.Equal(t, "0002_pay", a.Name)
+	assert.Equal(t, "0001_city", b.Name)
+	a, _ = findColumnPair(table, columns, []string{"город", "нет"})
+	assert.Nil(t, a)
+}
@@ -6,16 +6,15 @@ import (
 	"encoding/csv"
 	"encoding/hex"
 	"fmt"
-	"io"
 	"log"
 	"math"
-	"os"
 	"reflect"
 	"regexp"
 	"sort"
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/mozillazg/go-unidecode"
 	"github.com/pivolan/go_utils"
@@ -32,6 +31,11 @@ type CommonStat struct {
 	Groups                                                                  []map[string]interface{}
 	IsNumeric                                                               bool
 	Title                                                                   string
+	Sum                                                                     string  // точная сумма Decimal колонки, без потерь на float
+	Rate                                                                    float64 // доля true в булевой колонке
+	IsBool                                                                  bool
+	Unit                                                                    string // валюта или %, срезанные со значений при импорте
+	Label                                                                   string // исходное название колонки из файла
 }
 
 type DBInterface interface {
@@ -70,56 +74,6 @@ func replaceSpecialSymbols(input string) string {
 
 	return processedString
 }
-func detectDelimiter(filePath string) (rune, error) {
-	f, err := os.OpenFile(filePath, os.O_RDONLY, 0655)
-	if err != nil {
-		return 0, fmt.Errorf("cannot open file: %v", err)
-	}
-	defer f.Close()
-
-	// Читаем первые 1000 байт файла для анализа
-	buffer := make([]byte, 1000)
-	n, err := f.Read(buffer)
-	if err != nil && err != io.EOF {
-		return 0, fmt.Errorf("cannot read file: %v", err)
-	}
-	sample := string(buffer[:n])
-
-	// Популярные разделители для проверки
-	delimiters := []rune{',', ';', '\t', '|'}
-	maxCount := 0
-	bestDelimiter := rune(',') // По умолчанию запятая
-
-	// Проверяем первые несколько строк
-	lines := strings.Split(sample, "\n")
-	if len(lines) > 0 {
-		firstLine := lines[0]
-
-		for _, delimiter := range delimiters {
-			count := strings.Count(firstLine, string(delimiter))
-			// Проверяем последовательность для других строк
-			isConsistent := true
-			for i := 1; i < len(lines) && i < 5; i++ {
-				if strings.Count(lines[i], string(delimiter)) != count {
-					isConsistent = false
-					break
-				}
-			}
-
-			if count > maxCount && isConsistent {
-				maxCount = count
-				bestDelimiter = delimiter
-			}
-		}
-	}
-
-	if maxCount == 0 {
-		return 0, fmt.Errorf("cannot detect delimiter, no consistent pattern found")
-	}
-
-	return bestDelimiter, nil
-}
-
 func addNumberPrefix(headers []string) []string {
 	result := make([]string, len(headers))
 	for i, header := range headers {
@@ -189,26 +143,42 @@ func removeBOM(row []string) []string {
 	return row
 }
 
-func importDataIntoClickHouse(filePath string, db DBInterface) (models.ClickhouseTableName, error) {
-	delimiter, err := detectDelimiter(filePath)
+// rowReader — источник строк для импорта (CSV, JSON и т.д.), возвращает io.EOF в конце данных
+type rowReader interface {
+	Read() ([]string, error)
+}
+
+// prependRowReader сначала отдает уже прочитанную строку, затем продолжает чтение из reader
+type prependRowReader struct {
+	first  []string
+	reader rowReader
+}
+
+func (p *prependRowReader) Read() ([]string, error) {
+	if p.first != nil {
+		row := p.first
+		p.first = nil
+		return row, nil
+	}
+	return p.reader.Read()
+}
+
+func importDataIntoClickHouse(filePath string, db DBInterface, opts importOptions) (models.ClickhouseTableName, error) {
+	dialect, err := sniffCSVDialect(filePath)
 	if err != nil {
-		log.Println(fmt.Errorf("error detecting delimiter: %v", err))
-		delimiter = ','
+		log.Println(fmt.Errorf("error detecting csv dialect: %v", err))
 	}
+	log.Println("csv dialect:", dialect)
 
-	f, err := os.OpenFile(filePath, os.O_RDONLY, 0655)
+	// Файл перекодируется в UTF-8 на лету, если он в Windows-1251, UTF-16 и т.д.
+	f, _, err := openTextFile(filePath)
 	if err != nil {
 		return "", err
 	}
 	defer f.Close()
 
-	r := csv.NewReader(f)
-	r.Comma = delimiter // Устанавливаем обнаруженный разделитель
-
-	// Дополнительные настройки для более надежного парсинга
-	r.FieldsPerRecord = -1    // Разрешаем переменное количество полей
-	r.LazyQuotes = true       // Более гибкая обработка кавычек
-	r.TrimLeadingSpace = true // Убираем начальные пробелы
+	// Тот же диалект используется и для определения типов, и для вставки
+	r := newDialectReader(f, dialect)
 	// Читаем и анализируем первую строку
 	firstRow, err := r.Read()
 	if err != nil {
@@ -239,191 +209,231 @@ func importDataIntoClickHouse(filePath string, db DBInterface) (models.Clickhous
 		dataRow = removeBOM(dataRow)
 	}
 
-	// Определяем типы данных
-	typesWeight := []string{"", "DateTime64", "Date", "Int64", "Float64", "String"}
-	types := make([]string, len(dataRow))
-	nullables := make([]string, len(dataRow))
+	// Определяем типы данных, начиная с первой строки данных
+	types, nullables, formats := inferColumnTypes(&prependRowReader{first: dataRow, reader: r}, len(dataRow))
 
-	// Анализируем типы, начиная с первой строки данных
-	for i := 0; i < 50000; i++ {
-		var values []string
-		if i == 0 {
-			values = dataRow
-		} else {
-			var err error
-			values, err = r.Read()
-			if err != nil {
-				break
-			}
+	// Открываем файл заново для импорта: перекодированный поток нельзя перемотать
+	f2, _, err := openTextFile(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer f2.Close()
+	if info, err := f2.file.Stat(); err == nil {
+		opts.Progress.Track(info.Size(), f2.BytesRead)
+	}
+	r = newDialectReader(f2, dialect)
+	// Пропускаем заголовки, если они не являются данными
+	if !headerAnalysis.FirstRowIsData {
+		_, _ = r.Read()
+	}
+
+	return importRows(db, filePath, headers, headerAnalysis.Labels, types, nullables, formats, opts.Progress.CountRows(r), opts)
+}
+
+const (
+	maxBatchSize    = 1 * 1024 * 1024 // размер пакета вставки в байтах
+	maxColumnLength = 4000            // максимальная длина значения колонки
+)
+
+// truncateUTF8 обрезает строку до max байт, не разрывая многобайтовые символы
+func truncateUTF8(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	for max > 0 && !utf8.RuneStart(s[max]) {
+		max--
+	}
+	return s[:max]
+}
+
+// discardImport убирает строки неудавшейся загрузки: новая таблица и ее таблица отклоненных строк удаляются,
+// а из таблицы, в которую дописывали, удаляются строки с меткой этой загрузки
+func discardImport(db DBInterface, tableName string, plan *appendPlan) {
+	queries := []string{"DROP TABLE IF EXISTS " + tableName, "DROP TABLE IF EXISTS " + rejectedTableName(tableName)}
+	if plan != nil {
+		queries = []string{fmt.Sprintf("ALTER TABLE %s DELETE WHERE %s = '%s'", tableName, LOAD_BATCH_COLUMN, sqlStringEscaper.Replace(plan.Batch))}
+	}
+	for _, sql := range queries {
+		if tx := db.Exec(sql); tx.Error != nil {
+			log.Printf("Error discarding failed import of %s: %v", tableName, tx.Error)
 		}
-		if len(values) != len(types) {
-			continue
+	}
+}
+
+// importRows создает таблицу с заданными колонками и загружает в нее все строки из r
+// labels — исходные названия колонок из файла, по ним колонки показываются пользователю
+func importRows(db DBInterface, filePath string, headers, labels, types, nullables []string, formats []columnFormat, r rowReader, opts importOptions) (models.ClickhouseTableName, error) {
+	labels = columnLabels(headers, labels)
+	// Форматы чисел есть только у источников, типы которых угадывались по тексту
+	formats = append(formats, make([]columnFormat, len(headers)-min(len(formats), len(headers)))...)
+	// Типы, исправленные пользователем командой /cast для таблицы с такими же колонками
+	applySchema(opts.Schemas[headerFingerprint(headers)], headers, types, formats)
+	for i := range headers {
+		if types[i] == "" {
+			types[i] = "String"
 		}
-		for n, value := range values {
-			// Remove UTF-8 BOM (Byte Order Mark) if present. BOM is a sequence of bytes (0xEF,0xBB,0xBF)
-			// that some text editors (especially on Windows) add at the beginning of UTF-8 files
-			value = strings.TrimPrefix(value, "\uFEFF")
-			f := ""
-			var v interface{}
-			v, err = time.Parse("2006-01-02 15:04:05.999999", value)
-			if err == nil {
-				f = "DateTime"
+	}
+
+	tableName, insertInto, idExists := "", "", false
+	var plan *appendPlan
+	if opts.Append != nil {
+		// Дописываем в существующую таблицу: колонки сопоставляются по исходным названиям, типы расширяются
+		plan = planAppend(opts.Append, headers, labels, types, nullables, formats, filePath)
+		for _, sql := range plan.Alters {
+			fmt.Println("alter table", sql)
+			if tx := db.Exec(sql); tx.Error != nil {
+				return "", tx.Error
 			}
-			if err != nil {
-				v, f, _, err = tryParseDateTime(value)
-				if err != nil {
-					v, err = strconv.ParseUint(value, 10, 64)
-					if err != nil {
-						v, err = strconv.ParseInt(value, 10, 64)
-						if err != nil {
-							v, err = strconv.ParseFloat(value, 64)
-							if err != nil {
-								v = value
-							}
-						}
-					}
-				}
+		}
+		tableName, insertInto = string(opts.Append.Table), plan.InsertInto()
+	} else {
+		// Создаем таблицу
+		fields := []string{}
+		columns := []string{}
+		for i, header := range headers {
+			fields = append(fields, columnDefinition(header, types[i], nullables[i], columnComment(header, labels[i], formats[i].Unit)))
+			columns = append(columns, header)
+		}
+		// Для колонок с Unix временем добавляется вычисляемая дата, чтобы они попали в анализ по датам
+		for i, header := range headers {
+			if formats[i].Epoch != "" {
+				fields = append(fields, epochAliasDefinition(header, formats[i].Epoch))
 			}
+		}
 
-			t := ""
-			switch v.(type) {
-			case time.Time:
-				if f == "DateTime" {
-					t = "DateTime64"
-				} else {
-					t = "Date"
-				}
-			case uint64:
-				t = "Int64"
-			case int64:
-				t = "Int64"
-			case float64:
-				t = "Float64"
-			case string:
-				if v == "" || v == "\\N" {
-					nullables[n] = " NULL "
-					continue
-				}
-				t = "String"
-			}
-			currentTypeWeight := SearchStrings(typesWeight, t)
-			savedTypeWeight := SearchStrings(typesWeight, types[n])
-			if currentTypeWeight > savedTypeWeight {
-				types[n] = t
+		// Генерируем имя таблицы
+		tableName = strings.Join(columns[:min(3, len(columns))], "_") + "_" + getMD5String(filePath)[:6]
+
+		// Создаем SQL запрос
+		sql := `CREATE TABLE ` + tableName + ` (id UInt64,`
+		for _, v := range headers {
+			if v == "id" {
+				idExists = true
+				sql = `CREATE TABLE ` + tableName + ` (`
 			}
 		}
-	}
+		sql += strings.Join(fields, ",\n") + fmt.Sprintf(") ENGINE = MergeTree PRIMARY KEY (id) SETTINGS index_granularity = 8192")
 
-	// Создаем таблицу
-	fields := []string{}
-	columns := []string{}
-	for i, header := range headers {
-		if types[i] == "" {
-			types[i] = "String"
+		// Создаем таблицу
+		tx := db.Exec("DROP TABLE IF EXISTS " + tableName)
+		if tx.Error != nil {
+			return "", tx.Error
+		}
+		fmt.Println("create table", sql)
+		tx = db.Exec(sql)
+		if tx.Error != nil {
+			return "", tx.Error
 		}
-		fields = append(fields, fmt.Sprintf("%s %s %s", header, types[i], nullables[i]))
-		columns = append(columns, header)
+		insertInto = tableName
 	}
 
-	// Генерируем имя таблицы
-	tableName := strings.Join(columns[:min(3, len(columns))], "_") + "_" + getMD5String(filePath)[:6]
+	// Импортируем данные: строки кодируются csv.Writer и уходят пакетами параллельно
+	started := time.Now()
+	inserter := newBatchInserter(newRowInserter(db), insertInto, insertWorkers)
+	b := bytes.NewBuffer(make([]byte, 0, maxBatchSize+maxBatchSize/4))
+	csvWriter := csv.NewWriter(b)
+	var rowsCount, bytesCount int64
+	batchRows := 10000 / int(math.Max(1.0, float64(len(headers))/50))
 
-	// Создаем SQL запрос
-	sql := `CREATE TABLE ` + tableName + ` (id UInt64,`
-	idExists := false
-	for _, v := range headers {
-		if v == "id" {
-			idExists = true
-			sql = `CREATE TABLE ` + tableName + ` (`
+	flush := func() error {
+		csvWriter.Flush()
+		if b.Len() == 0 {
+			return nil
 		}
+		bytesCount += int64(b.Len())
+		batch := append([]byte(nil), b.Bytes()...)
+		b.Reset()
+		return inserter.Send(batch)
 	}
-	sql += strings.Join(fields, ",\n") + fmt.Sprintf(") ENGINE = MergeTree PRIMARY KEY (id) SETTINGS index_granularity = 8192")
 
-	// Создаем таблицу
-	tx := db.Exec("DROP TABLE IF EXISTS " + tableName)
-	if tx.Error != nil {
-		return "", tx.Error
-	}
-	fmt.Println("create table", sql)
-	tx = db.Exec(sql)
-	if tx.Error != nil {
-		return "", tx.Error
-	}
+	// Строки, которые ClickHouse не примет, откладываются в отдельную таблицу и не ломают импорт
+	quarantine := newRowQuarantine(db, tableName, opts.Append != nil)
+	position, _ := r.(rowPosition)
 
-	// Возвращаемся к началу файла для импорта
-	f.Seek(0, 0)
-	r = csv.NewReader(f)
-	r.Comma = delimiter
-	// Пропускаем заголовки, если они не являются данными
-	if !headerAnalysis.FirstRowIsData {
-		_, _ = r.Read()
+	// fail останавливает вставку и убирает то, что успело записаться, чтобы в базе не осталось половины файла
+	fail := func(err error) (models.ClickhouseTableName, error) {
+		inserter.Wait()
+		quarantine.Close()
+		discardImport(db, tableName, plan)
+		return "", err
 	}
 
-	// Импортируем данные
-	b := bytes.NewBufferString("")
-	csvWriter := csv.NewWriter(b)
-	i := 1
-	tx = db.Exec("SET max_query_size = 5048576")
-	tx = tx.Exec("SET max_insert_block_size = 5000000")
-	const maxQuerySize = 1 * 1024 * 1024 // 1MB в байтах
-	const maxColumnLength = 4000         // максимальная длина значения колонки
-
-	for ; ; i++ {
+	for i := 1; ; i++ {
 		values, err := r.Read()
 		if err != nil {
 			break
 		}
 		values = removeBOM(values)
+		// Исходные значения остаются нетронутыми для таблицы отклоненных строк
+		row := make([]string, 0, len(values)+2)
+		if plan != nil {
+			row = append(row, strconv.FormatInt(opts.Append.NextID+int64(i), 10))
+		} else if !idExists {
+			row = append(row, strconv.Itoa(i))
+		}
 		for k, v := range values {
-			// Обрезаем значение до 4000 символов
-			if len(v) > maxColumnLength {
-				v = v[:maxColumnLength]
-			}
 			if v == "\\N" {
-				values[k] = ""
+				v = ""
 			}
-
-			if types[k] == "String" || types[k] == "Date" || types[k] == "DateTime" {
-				values[k] = "'" + v + "'"
+			// Даты, булевы значения и IP приводятся к формату, который ClickHouse разбирает без настроек
+			if k < len(types) {
+				v = normalizeValue(types[k], formats[k], v)
 			}
-			t, _, v, _ := tryParseDateTime(v)
-			if types[k] == "DateTime" {
-				values[k] = "'" + v + "'"
-			} else if types[k] == "Date" {
-				values[k] = "'" + t.Format("2006-01-02") + "'"
+			row = append(row, truncateUTF8(v, maxColumnLength))
+		}
+		if reason := rowRejectReason(labels, types, row[len(row)-len(values):]); reason != "" {
+			line, raw := int64(i), ""
+			if position != nil {
+				if known, text := position.Position(); known > 0 {
+					line, raw = known, text
+				}
 			}
-
-			// После форматирования снова проверяем длину
-			if len(values[k]) > maxColumnLength {
-				values[k] = values[k][:maxColumnLength-1] + "'"
+			if raw == "" {
+				raw = csvLine(values)
+			}
+			if err := quarantine.Reject(line, reason, raw); err != nil {
+				return fail(err)
 			}
+			continue
 		}
 
-		if !idExists {
-			values = append([]string{strconv.Itoa(i)}, values...)
+		if plan != nil {
+			row = append(row, plan.Batch)
 		}
+		csvWriter.Write(row)
+		rowsCount++
 
-		csvWriter.Write(values)
-
-		if b.Len() > maxQuerySize || i%(10000/int(math.Max(1.0, float64(len(headers))/50))) == 0 {
-			csvWriter.Flush()
-			sql := fmt.Sprintf("INSERT INTO "+tableName+" FORMAT CSV \n%s", b.String())
-			b.Reset()
-			tx = tx.Exec(sql)
-			if tx.Error != nil {
-				return "", tx.Error
+		if b.Len() > maxBatchSize || i%batchRows == 0 {
+			if err := flush(); err != nil {
+				return fail(err)
 			}
 		}
 	}
-	csvWriter.Flush()
-	if b.Len() > 0 {
-		sql := fmt.Sprintf("INSERT INTO "+tableName+" FORMAT CSV \n%s", b.String())
-		tx = tx.Exec(sql)
-		if tx.Error != nil {
-			return "", tx.Error
-		}
+	if err := flush(); err != nil {
+		return fail(err)
+	}
+	if err := inserter.Wait(); err != nil {
+		return fail(err)
+	}
+	if err := quarantine.Close(); err != nil {
+		return fail(err)
+	}
+	if plan != nil {
+		plan.Commit(opts.Append, rowsCount+quarantine.total)
+		setColumnMeta(opts.Append.Table, buildColumnMeta(plan.Columns, labels, types, formats))
+	} else {
+		setColumnMeta(models.ClickhouseTableName(tableName), buildColumnMeta(headers, labels, types, formats))
+	}
+	if summary := formatRejectedSummary(quarantine.Reasons()); summary != "" {
+		log.Printf("%s: %s", tableName, summary)
 	}
 
+	elapsed := time.Since(started)
+	seconds := math.Max(elapsed.Seconds(), 0.001)
+	log.Printf("imported %s into %s: %d rows, %.1f MB in %s (%.0f rows/s, %.1f MB/s)",
+		filePath, tableName, rowsCount, float64(bytesCount)/1024/1024, elapsed.Round(time.Millisecond),
+		float64(rowsCount)/seconds, float64(bytesCount)/1024/1024/seconds)
+
 	return models.ClickhouseTableName(tableName), nil
 }
 
@@ -444,6 +454,8 @@ func getColumnAndTypeList(db *gorm.DB, tableName models.ClickhouseTableName) ([]
 
 	var columns []models.ColumnInfo
 	tx.Scan(&columns)
+	// После перезапуска бота исходные названия колонок известны только из комментариев
+	restoreColumnMeta(tableName, columns)
 
 	// Sort columns by Name
 	sort.Slice(columns, func(i, j int) bool {
@@ -457,7 +469,7 @@ const RESULT_MANY models.StatsQueryResultType = "many"
 const RESULT_SINGLE models.StatsQueryResultType = "single"
 
 func IsNumericType(_type string) bool {
-	return go_utils.InArray(_type, []string{"Int64", "Float64", "Nullable(Int64)", "Nullable(Float64)"})
+	return go_utils.InArray(_type, []string{"Int64", "UInt64", "Float64", "Nullable(Int64)", "Nullable(UInt64)", "Nullable(Float64)"}) || IsDecimalType(_type)
 }
 func RemoveSpecialChars(s string) string {
 	// Initialize a new buffer to hold the cleaned string
@@ -517,6 +529,12 @@ func (c *CommonStat) Set(key string, value interface{}) error {
 			result = v
 		case int64:
 			result = float64(v)
+		case []byte:
+			if val, err := strconv.ParseFloat(string(v), 64); err == nil {
+				result = val
+			} else {
+				fmt.Println("Unable to convert bytes to float64")
+			}
 		case string:
 			// Convert x to float64
 			if val, err := strconv.ParseFloat(v, 64); err == nil {
@@ -528,6 +546,15 @@ func (c *CommonStat) Set(key string, value interface{}) error {
 			fmt.Println("x is not a number or string")
 		}
 		fieldValue.SetFloat(result)
+	case reflect.String:
+		switch v := value.(type) {
+		case string:
+			fieldValue.SetString(v)
+		case []byte:
+			fieldValue.SetString(string(v))
+		default:
+			fieldValue.SetString(fmt.Sprint(v))
+		}
 	default:
 		return fmt.Errorf("field %s is not of type int64 or float64", fieldName)
 	}
@@ -535,6 +562,26 @@ func (c *CommonStat) Set(key string, value interface{}) error {
 	return nil
 }
 
+// toFloat64 приводит значение из результата запроса к числу: суммы Int64 приходят как int64,
+// Float64 как float64, Decimal как строка
+func toFloat64(value interface{}) float64 {
+	switch v := value.(type) {
+	case int64:
+		return float64(v)
+	case uint64:
+		return float64(v)
+	case float64:
+		return v
+	case string:
+		f, _ := strconv.ParseFloat(v, 64)
+		return f
+	case []byte:
+		f, _ := strconv.ParseFloat(string(v), 64)
+		return f
+	}
+	return 0
+}
+
 func parseUniqResults(uniqResults map[string]interface{}) map[string]CommonStat {
 	result := make(map[string]CommonStat)
 	for field, value := range uniqResults {
@@ -569,7 +616,11 @@ func parseNumericResults(param map[string]interface{}) (result map[string]Common
 		}
 		stat := result[field]
 		stat.Set(method, value)
-		stat.IsNumeric = true
+		if method == "rate" {
+			stat.IsBool = true
+		} else {
+			stat.IsNumeric = true
+		}
 		result[field] = stat
 		fmt.Println("is numeric", result[field])
 	}
@@ -618,6 +669,12 @@ func setZeroFields(a *CommonStat, b CommonStat) {
 				fieldValue.SetBool(true)
 			}
 
+		case reflect.String:
+			if fieldValue.String() == "" {
+				bFieldValue := reflect.ValueOf(&b).Elem().FieldByName(field.Name)
+				fieldValue.SetString(bFieldValue.String())
+			}
+
 		case reflect.Float64:
 			if fieldValue.Float() == 0 {
 				// Get corresponding field in struct b using reflection
@@ -656,6 +713,18 @@ func generateSqlForCount(columns []models.ColumnInfo, table models.ClickhouseTab
 func generateSqlForNumericColumnsStats(columns []models.ColumnInfo, table models.ClickhouseTableName) (sql string) {
 	statMethods := []string{"quantile(0.01)", "quantile(0.99)", "quantile(0.1)", "quantile(0.9)", "median", "avg", "max", "min"}
 	fields := columnAggregatesSelectSqlGenerator(columns, statMethods)
+	for _, column := range columns {
+		if excludeColumn(column.Name) {
+			continue
+		}
+		// Сумма Decimal считается в Decimal128 и передается строкой, чтобы не терять копейки
+		if IsDecimalType(column.Type) {
+			fields = append(fields, fmt.Sprintf("toString(sum(%s)) as sum__%s", column.Name, column.Name))
+		}
+		if IsBoolType(column.Type) {
+			fields = append(fields, fmt.Sprintf("avg(toUInt8(%s)) as rate__%s", column.Name, column.Name))
+		}
+	}
 	return "SELECT " + strings.Join(fields, ",") + " FROM " + string(table)
 }
 func columnAggregatesSelectSqlGenerator(columns []models.ColumnInfo, aggregatesMethods []string) []string {
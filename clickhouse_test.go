@@ -57,8 +57,8 @@ func TestImportDataIntoClickHouse(t *testing.T) {
 1,John Doe,30,2024-01-01
 2,Jane Smith,25,2024-01-02
 3,Bob Johnson,35,2024-01-03`,
-			expectedTable:   "id_name_age_123456",
-			expectedLastSQL: "INSERT INTO id_name_age_123456 FORMAT CSV \n1,'John Doe',30,'2024-01-01'\n2,'Jane Smith',25,'2024-01-02'\n3,'Bob Johnson',35,'2024-01-03'\n",
+			expectedTable:   "0001_id_0002_name_0003_age_123456",
+			expectedLastSQL: "INSERT INTO 0001_id_0002_name_0003_age_123456 SETTINGS max_query_size = 5048576, max_insert_block_size = 5000000 FORMAT CSV \n1,1,John Doe,30,2024-01-01\n2,2,Jane Smith,25,2024-01-02\n3,3,Bob Johnson,35,2024-01-03\n",
 			expectedError:   false,
 			setupMock: func(db *MockDB) {
 				db.On("Exec", mock.Anything, mock.Anything).Return(&gorm.DB{})
@@ -70,8 +70,8 @@ func TestImportDataIntoClickHouse(t *testing.T) {
 Apple,1.99,100,2024-01-01
 Orange,2.50,150,2024-01-02
 Banana,1.75,200,2024-01-03`,
-			expectedTable:   "product_price_quantity_123456",
-			expectedLastSQL: "INSERT INTO product_price_quantity_123456 FORMAT CSV \n1,'Apple',1.99,100,'2024-01-01'\n2,'Orange',2.50,150,'2024-01-02'\n3,'Banana',1.75,200,'2024-01-03'\n",
+			expectedTable:   "0001_product_0002_price_0003_quantity_123456",
+			expectedLastSQL: "INSERT INTO 0001_product_0002_price_0003_quantity_123456 SETTINGS max_query_size = 5048576, max_insert_block_size = 5000000 FORMAT CSV \n1,Apple,1.99,100,2024-01-01\n2,Orange,2.50,150,2024-01-02\n3,Banana,1.75,200,2024-01-03\n",
 			expectedError:   false,
 			setupMock: func(db *MockDB) {
 				db.On("Exec", mock.Anything, mock.Anything).Return(&gorm.DB{})
@@ -82,8 +82,8 @@ Banana,1.75,200,2024-01-03`,
 			csvContent: `Apple,1.99,100,2024-01-01
 Orange,2.50,150,2024-01-02
 Banana,1.75,200,2024-01-03`,
-			expectedTable:   "column_1_column_2_column_3_123456",
-			expectedLastSQL: "INSERT INTO column_1_column_2_column_3_123456 FORMAT CSV \n1,'Apple',1.99,100,'2024-01-01'\n2,'Orange',2.50,150,'2024-01-02'\n3,'Banana',1.75,200,'2024-01-03'\n",
+			expectedTable:   "0001_column_1_0002_column_2_0003_column_3_123456",
+			expectedLastSQL: "INSERT INTO 0001_column_1_0002_column_2_0003_column_3_123456 SETTINGS max_query_size = 5048576, max_insert_block_size = 5000000 FORMAT CSV \n1,Apple,1.99,100,2024-01-01\n2,Orange,2.50,150,2024-01-02\n3,Banana,1.75,200,2024-01-03\n",
 			expectedError:   false,
 			setupMock: func(db *MockDB) {
 				db.On("Exec", mock.Anything, mock.Anything).Return(&gorm.DB{})
@@ -95,8 +95,8 @@ Banana,1.75,200,2024-01-03`,
 Apple
 Orange
 Banana`,
-			expectedTable:   "name_123456",
-			expectedLastSQL: "INSERT INTO name_123456 FORMAT CSV \n1,'Apple'\n2,'Orange'\n3,'Banana'\n",
+			expectedTable:   "0001_name_123456",
+			expectedLastSQL: "INSERT INTO 0001_name_123456 SETTINGS max_query_size = 5048576, max_insert_block_size = 5000000 FORMAT CSV \n1,Apple\n2,Orange\n3,Banana\n",
 			expectedError:   false,
 			setupMock: func(db *MockDB) {
 				db.On("Exec", mock.Anything, mock.Anything).Return(&gorm.DB{})
@@ -112,8 +112,8 @@ Banana`,
 23454;123;234
 23;1675;124
 `,
-			expectedTable:   "column_1_column_2_column_3_123456",
-			expectedLastSQL: "INSERT INTO column_1_column_2_column_3_123456 FORMAT CSV \n1,123,123,123,123,123,123,123,123,123,123,123,123,123,123,123,123,123,123,123,123,123,123,123,123,123,123,123,123,123,123\n2,1235,1235,1235,1235,1235,1235,1235,1235,1235,1235,1235,1235,1235,1235,1235,1235,1235,1235,1235,1235,1235,1235,1235,1235,1235,1235,1235,1235,1235,1235\n3,123,123,123,123,123,123,123,123,123,123,123,123,123,123,123,123,123,123,123,123,123,123,123,123,123,123,123,123,123,123\n4,5234,5234,5234,5234,5234,5234,5234,5234,5234,5234,5234,5234,5234,5234,5234,5234,5234,5234,5234,5234,5234,5234,5234,5234,5234,5234,5234,5234,5234,5234\n5,1432,1432,1432,1432,1432,1432,1432,1432,1432,1432,1432,1432,1432,1432,1432,1432,1432,1432,1432,1432,1432,1432,1432,1432,1432,1432,1432,1432,1432,1432\n6,123,123,123,123,123,123,123,123,123,123,123,123,123,123,123,123,123,123,123,123,123,123,123,123,123,123,123,123,123,123\n7,23454,23454,23454,23454,23454,23454,23454,23454,23454,23454,23454,23454,23454,23454,23454,23454,23454,23454,23454,23454,23454,23454,23454,23454,23454,23454,23454,23454,23454,23454\n8,23,23,23,23,23,23,23,23,23,23,23,23,23,23,23,23,23,23,23,23,23,23,23,23,23,23,23,23,23,23\n",
+			expectedTable:   "0001_task1_0002_task2_0003_task0_123456",
+			expectedLastSQL: "INSERT INTO 0001_task1_0002_task2_0003_task0_123456 SETTINGS max_query_size = 5048576, max_insert_block_size = 5000000 FORMAT CSV \n1,123,321,4235\n2,5234,234,3\n3,1432,342,123\n4,123,23423,532\n5,23454,123,234\n6,23,1675,124\n",
 			expectedError:   false,
 			setupMock: func(db *MockDB) {
 				db.On("Exec", mock.Anything, mock.Anything).Return(&gorm.DB{})
@@ -129,8 +129,8 @@ Banana`,
 23454;123;234
 23;1675;124
 `,
-			expectedTable:   "task1_task2_task0_123456",
-			expectedLastSQL: "INSERT INTO task1_task2_task0_123456 FORMAT CSV \n1,123,321,4235\n2,5234,234,3\n3,1432,342,123\n4,123,23423,532\n5,23454,123,234\n6,23,1675,124\n",
+			expectedTable:   "0001_task1_0002_task2_0003_task0_123456",
+			expectedLastSQL: "INSERT INTO 0001_task1_0002_task2_0003_task0_123456 SETTINGS max_query_size = 5048576, max_insert_block_size = 5000000 FORMAT CSV \n1,123,321,4235\n2,5234,234,3\n3,1432,342,123\n4,123,23423,532\n5,23454,123,234\n6,23,1675,124\n",
 			expectedError:   false,
 			setupMock: func(db *MockDB) {
 				db.On("Exec", mock.Anything, mock.Anything).Return(&gorm.DB{})
@@ -163,7 +163,7 @@ Banana`,
 			tc.setupMock(mockDB)
 
 			// Выполняем тестируемую функцию
-			tableName, err := importDataIntoClickHouse(tmpFile.Name(), mockDB)
+			tableName, err := importDataIntoClickHouse(tmpFile.Name(), mockDB, importOptions{})
 
 			// Проверяем результаты
 			if tc.expectedError {
@@ -403,7 +403,7 @@ func TestImportDataIntoClickHouseEnv(t *testing.T) {
 	db, err := gorm.Open(mysql.Open(cfg.DatabaseDSN), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
 	assert.NoError(t, err)
 
-	table, err := importDataIntoClickHouse("/Users/igorpecenikin/Downloads/hr_data.csv", db)
+	table, err := importDataIntoClickHouse("/Users/igorpecenikin/Downloads/hr_data.csv", db, importOptions{})
 	assert.NoError(t, err)
 	fmt.Println(table)
 	stat := analyzeStatistics(table)
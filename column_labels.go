@@ -0,0 +1,201 @@
+// column_labels.go
+package main
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pivolan/stats_analyzer/domain/models"
+)
+
+// SQL имя колонки — транслит с номером ("0003_Summa_zakaza"), его нельзя показывать пользователю.
+// Исходное название, позиция и смысл значений хранятся отдельно для каждой таблицы
+
+const (
+	SEMANTIC_NUMBER     = "число"
+	SEMANTIC_MONEY      = "деньги"
+	SEMANTIC_PERCENT    = "проценты"
+	SEMANTIC_DATE       = "дата"
+	SEMANTIC_DATETIME   = "дата и время"
+	SEMANTIC_TIMESTAMP  = "Unix время"
+	SEMANTIC_BOOLEAN    = "да/нет"
+	SEMANTIC_IDENTIFIER = "идентификатор"
+	SEMANTIC_IP         = "IP адрес"
+	SEMANTIC_CATEGORY   = "категория"
+	SEMANTIC_TEXT       = "текст"
+)
+
+// columnMetaStore — сведения о колонках таблиц; импорт идет в отдельных горутинах, поэтому под мьютексом
+var columnMetaStore = struct {
+	sync.RWMutex
+	tables map[models.ClickhouseTableName]map[string]models.ColumnMeta
+}{tables: map[models.ClickhouseTableName]map[string]models.ColumnMeta{}}
+
+// setColumnMeta добавляет сведения о колонках таблицы; при дописывании новые колонки дополняют старые
+func setColumnMeta(tableName models.ClickhouseTableName, columns map[string]models.ColumnMeta) {
+	columnMetaStore.Lock()
+	defer columnMetaStore.Unlock()
+	if columnMetaStore.tables[tableName] == nil {
+		columnMetaStore.tables[tableName] = map[string]models.ColumnMeta{}
+	}
+	for name, meta := range columns {
+		columnMetaStore.tables[tableName][name] = meta
+	}
+}
+
+func getColumnMeta(tableName models.ClickhouseTableName, column string) (models.ColumnMeta, bool) {
+	columnMetaStore.RLock()
+	defer columnMetaStore.RUnlock()
+	meta, ok := columnMetaStore.tables[tableName][column]
+	return meta, ok
+}
+
+func deleteColumnMeta(tableName models.ClickhouseTableName) {
+	columnMetaStore.Lock()
+	defer columnMetaStore.Unlock()
+	delete(columnMetaStore.tables, tableName)
+}
+
+// sqlStringEscaper экранирует строку для литерала в одинарных кавычках
+var sqlStringEscaper = strings.NewReplacer(`\`, `\\`, `'`, `\'`, "\n", `\n`)
+
+// columnComment — комментарий колонки ClickHouse: исходное название и срезанная единица измерения,
+// по одному "ключ:значение" на строку. Так они переживают перезапуск бота. Название, которое
+// и так получается из SQL имени, не хранится
+func columnComment(column, label, unit string) string {
+	var lines []string
+	if label = strings.Join(strings.Fields(label), " "); label != "" && label != displayColumnName(column) {
+		lines = append(lines, "label:"+label)
+	}
+	if unit != "" {
+		lines = append(lines, "unit:"+unit)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// commentValue достает значение по ключу из комментария колонки
+func commentValue(comment, key string) string {
+	for _, line := range strings.Split(comment, "\n") {
+		if strings.HasPrefix(line, key+":") {
+			return strings.TrimPrefix(line, key+":")
+		}
+	}
+	return ""
+}
+
+// restoreColumnMeta заполняет сведения о колонках, которых нет в памяти, по колонкам из DESCRIBE:
+// исходное название из комментария, номер из SQL имени, смысл значений по типу и единице
+func restoreColumnMeta(tableName models.ClickhouseTableName, columns []models.ColumnInfo) {
+	restored := map[string]models.ColumnMeta{}
+	for _, column := range columns {
+		if isServiceColumn(column) {
+			continue
+		}
+		if _, ok := getColumnMeta(tableName, column.Name); ok {
+			continue
+		}
+		label := commentValue(column.Comment, "label")
+		if label == "" {
+			label = displayColumnName(column.Name)
+		}
+		position, _ := strconv.Atoi(strings.SplitN(column.Name, "_", 2)[0])
+		restored[column.Name] = models.ColumnMeta{Label: label, Position: position, Semantics: columnSemantics(column.Type, columnFormat{Unit: columnUnit(column.Comment)})}
+	}
+	if len(restored) > 0 {
+		setColumnMeta(tableName, restored)
+	}
+}
+
+// columnLabel — название колонки для сообщений, подписей графиков и выгрузок
+func columnLabel(tableName models.ClickhouseTableName, column string) string {
+	if meta, ok := getColumnMeta(tableName, column); ok && meta.Label != "" {
+		return meta.Label
+	}
+	return displayColumnName(column)
+}
+
+// displayColumnName — название без номера и служебных суффиксов, когда исходное неизвестно
+// (таблица загружена до перезапуска бота): "0003_created__month" → "created"
+func displayColumnName(column string) string {
+	return strings.Split(originalName(column), "__")[0]
+}
+
+// columnLabels — исходные названия для заголовков, пустые и отсутствующие берутся из SQL имени
+func columnLabels(headers, labels []string) []string {
+	result := make([]string, len(headers))
+	for i, header := range headers {
+		if i < len(labels) && strings.TrimSpace(labels[i]) != "" {
+			result[i] = strings.TrimSpace(labels[i])
+		} else {
+			result[i] = displayColumnName(header)
+		}
+	}
+	return result
+}
+
+// buildColumnMeta собирает сведения о колонках загрузки: columns — SQL имена, labels — исходные названия
+func buildColumnMeta(columns, labels, types []string, formats []columnFormat) map[string]models.ColumnMeta {
+	result := make(map[string]models.ColumnMeta, len(columns))
+	for i, column := range columns {
+		position, _ := strconv.Atoi(strings.SplitN(column, "_", 2)[0])
+		result[column] = models.ColumnMeta{Label: labels[i], Position: position, Semantics: columnSemantics(types[i], formats[i])}
+	}
+	return result
+}
+
+// columnSemantics определяет смысл значений по типу колонки и записи значений в файле
+func columnSemantics(columnType string, format columnFormat) string {
+	t := unwrapNullable(columnType)
+	switch {
+	case format.Epoch != "":
+		return SEMANTIC_TIMESTAMP
+	case format.Unit == "%":
+		return SEMANTIC_PERCENT
+	case format.Unit != "":
+		return SEMANTIC_MONEY
+	case IsNumericType(t):
+		return SEMANTIC_NUMBER
+	case t == "Date":
+		return SEMANTIC_DATE
+	case strings.HasPrefix(t, "DateTime"):
+		return SEMANTIC_DATETIME
+	case t == "Bool":
+		return SEMANTIC_BOOLEAN
+	case t == "UUID":
+		return SEMANTIC_IDENTIFIER
+	case IsIPType(t):
+		return SEMANTIC_IP
+	case strings.HasPrefix(t, "LowCardinality(") || strings.HasPrefix(t, "Enum"):
+		return SEMANTIC_CATEGORY
+	}
+	return SEMANTIC_TEXT
+}
+
+// updateColumnSemantics обновляет смысл значений после смены типа колонки на месте
+func updateColumnSemantics(tableName models.ClickhouseTableName, column, columnType string) {
+	meta, ok := getColumnMeta(tableName, column)
+	if !ok {
+		meta = models.ColumnMeta{Label: displayColumnName(column)}
+	}
+	meta.Semantics = columnSemantics(columnType, columnFormat{})
+	setColumnMeta(tableName, map[string]models.ColumnMeta{column: meta})
+}
+
+// findColumn ищет колонку по SQL имени, исходному названию или названию без номера, без учета регистра
+func findColumn(tableName models.ClickhouseTableName, columns []models.ColumnInfo, name string) *models.ColumnInfo {
+	for i := range columns {
+		if columns[i].Name == name && !isServiceColumn(columns[i]) {
+			return &columns[i]
+		}
+	}
+	for i := range columns {
+		if isServiceColumn(columns[i]) {
+			continue
+		}
+		if strings.EqualFold(columnLabel(tableName, columns[i].Name), name) || strings.EqualFold(originalName(columns[i].Name), name) {
+			return &columns[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pivolan/stats_analyzer/domain/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/gorm"
+)
+
+func TestColumnSemantics(t *testing.T) {
+	testCases := []struct {
+		columnType string
+		format     columnFormat
+		expected   string
+	}{
+		{"Int64", columnFormat{}, SEMANTIC_NUMBER},
+		{"Nullable(Decimal(18, 2))", columnFormat{Unit: "₽"}, SEMANTIC_MONEY},
+		{"Float64", columnFormat{Unit: "%"}, SEMANTIC_PERCENT},
+		{"Int64", columnFormat{Epoch: EPOCH_SECONDS}, SEMANTIC_TIMESTAMP},
+		{"Date", columnFormat{}, SEMANTIC_DATE},
+		{"DateTime64", columnFormat{}, SEMANTIC_DATETIME},
+		{"Bool", columnFormat{}, SEMANTIC_BOOLEAN},
+		{"UUID", columnFormat{}, SEMANTIC_IDENTIFIER},
+		{"IPv6", columnFormat{}, SEMANTIC_IP},
+		{"LowCardinality(String)", columnFormat{}, SEMANTIC_CATEGORY},
+		{"Enum8('a' = 1, 'b' = 2)", columnFormat{}, SEMANTIC_CATEGORY},
+		{"String", columnFormat{}, SEMANTIC_TEXT},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.expected, columnSemantics(tc.columnType, tc.format), tc.columnType)
+	}
+}
+
+func TestColumnLabelFallback(t *testing.T) {
+	table := models.ClickhouseTableName("labels_fallback_table")
+	assert.Equal(t, "created", columnLabel(table, "0003_created__month"))
+	assert.Equal(t, "amount", columnLabel(table, "0002_amount"))
+	assert.Equal(t, []string{"Сумма заказа", "b"}, columnLabels([]string{"0001_summa_zakaza", "0002_b"}, []string{" Сумма заказа ", ""}))
+
+	setColumnMeta(table, map[string]models.ColumnMeta{"0002_amount": {Label: "Сумма", Position: 2}})
+	defer deleteColumnMeta(table)
+	assert.Equal(t, "Сумма", columnLabel(table, "0002_amount"))
+	assert.Equal(t, "avg Сумма", aggregateLabel(table, "avg__0002_amount"))
+	assert.Equal(t, "cnt", aggregateLabel(table, "cnt"))
+
+	columns := []models.ColumnInfo{{Name: "id"}, {Name: "0001_zip"}, {Name: "0002_amount"}}
+	assert.Equal(t, "0002_amount", findColumn(table, columns, "сумма").Name)
+	assert.Equal(t, "0001_zip", findColumn(table, columns, "ZIP").Name)
+	assert.Equal(t, "0001_zip", findColumn(table, columns, "0001_zip").Name)
+	assert.Nil(t, findColumn(table, columns, "id"))
+}
+
+func TestImportKeepsOriginalLabels(t *testing.T) {
+	original := getMD5String
+	getMD5String = func(input string) string {
+		return "123456"
+	}
+	defer func() {
+		getMD5String = original
+	}()
+
+	var content strings.Builder
+	content.WriteString("Город,Сумма заказа,Дата\n")
+	for i := 0; i < 150; i++ {
+		content.WriteString(fmt.Sprintf("Москва,%d,2024-01-02\n", i))
+	}
+	content.WriteString("Казань,n/a,2024-01-03\n")
+	filePath := filepath.Join(t.TempDir(), "orders.csv")
+	assert.NoError(t, os.WriteFile(filePath, []byte(content.String()), 0644))
+
+	mockDB := NewMockDB()
+	mockDB.On("Exec", mock.Anything, mock.Anything).Return(&gorm.DB{})
+	tables, err := importFileIntoClickHouse(filePath, mockDB, importOptions{})
+	assert.NoError(t, err)
+	table := tables[0].Name
+	defer deleteColumnMeta(table)
+
+	meta, ok := getColumnMeta(table, "0002_summa_zakaza")
+	assert.True(t, ok)
+	assert.Equal(t, models.ColumnMeta{Label: "Сумма заказа", Position: 2, Semantics: SEMANTIC_NUMBER}, meta)
+	assert.Equal(t, "Город", columnLabel(table, "0001_gorod"))
+	assert.Equal(t, SEMANTIC_DATE, mustColumnMeta(t, table, "0003_data").Semantics)
+
+	var queries []string
+	for _, call := range mockDB.Calls {
+		queries = append(queries, call.Arguments.String(0))
+	}
+	assert.Contains(t, strings.Join(queries, "\n"), "non-numeric in Сумма заказа")
+	assert.Contains(t, strings.Join(queries, "\n"), "0002_summa_zakaza Int64 COMMENT 'label:Сумма заказа'")
+}
+
+func TestColumnComment(t *testing.T) {
+	testCases := []struct {
+		column   string
+		label    string
+		unit     string
+		expected string
+	}{
+		{"0002_summa_zakaza", "Сумма заказа", "₽", "label:Сумма заказа\nunit:₽"},
+		{"0002_amount", "amount", "%", "unit:%"},
+		{"0001_name", "name", "", ""},
+		{"0003_o_brien", "O'Brien\nnotes", "", "label:O'Brien notes"},
+	}
+	for _, tc := range testCases {
+		comment := columnComment(tc.column, tc.label, tc.unit)
+		assert.Equal(t, tc.expected, comment, tc.column)
+		assert.Equal(t, tc.unit, columnUnit(comment), tc.column)
+	}
+	assert.Equal(t, "0003_o_brien String COMMENT 'label:O\\'Brien notes'", columnDefinition("0003_o_brien", "String", "", "label:O'Brien notes"))
+}
+
+func TestRestoreColumnMetaFromComments(t *testing.T) {
+	// Таблица загружена до перезапуска бота: сведений о колонках в памяти нет
+	table := models.ClickhouseTableName("labels_restored_table")
+	defer deleteColumnMeta(table)
+	restoreColumnMeta(table, []models.ColumnInfo{
+		{Name: "id", Type: "UInt64"},
+		{Name: "0001_gorod", Type: "LowCardinality(String)", Comment: "label:Город"},
+		{Name: "0002_summa", Type: "Decimal(18, 2)", Comment: "label:Сумма заказа\nunit:₽"},
+		{Name: "0003_zip", Type: "String"},
+	})
+	assert.Equal(t, models.ColumnMeta{Label: "Город", Position: 1, Semantics: SEMANTIC_CATEGORY}, mustColumnMeta(t, table, "0001_gorod"))
+	assert.Equal(t, models.ColumnMeta{Label: "Сумма заказа", Position: 2, Semantics: SEMANTIC_MONEY}, mustColumnMeta(t, table, "0002_summa"))
+	assert.Equal(t, "zip", columnLabel(table, "0003_zip"))
+	_, ok := getColumnMeta(table, "id")
+	assert.False(t, ok)
+
+	// Сведения, уже известные из импорта, не перезаписываются
+	setColumnMeta(table, map[string]models.ColumnMeta{"0001_gorod": {Label: "Город доставки", Position: 1}})
+	restoreColumnMeta(table, []models.ColumnInfo{{Name: "0001_gorod", Type: "String", Comment: "label:Город"}})
+	assert.Equal(t, "Город доставки", columnLabel(table, "0001_gorod"))
+}
+
+func mustColumnMeta(t *testing.T, table models.ClickhouseTableName, column string) models.ColumnMeta {
+	meta, ok := getColumnMeta(table, column)
+	assert.True(t, ok, column)
+	return meta
+}
@@ -0,0 +1,220 @@
+// correlation.go
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/pivolan/stats_analyzer/domain/models"
+	"gorm.io/gorm"
+)
+
+// Корреляции считаются в ClickHouse: corr — коэффициент Пирсона, rankCorr — Спирмена по рангам.
+// Спирмен ловит монотонные нелинейные связи и меньше реагирует на выбросы
+const (
+	maxCorrelationColumns = 20 // больше колонок не помещается на тепловую карту и в одно сообщение
+	// rankCorr держит значения каждой пары в памяти: 190 пар по 10000 строк — около 30 MB.
+	// Для оценки коэффициента до сотых этого хватает
+	spearmanSampleRows      = 10_000
+	correlationMinStrength  = 0.3 // более слабые связи в отчет не попадают
+	reportCorrelationsLimit = 5
+)
+
+// correlationMatrix — коэффициенты для каждой пары колонок, NaN если посчитать нельзя
+// (колонка постоянная или у пары нет строк без NULL)
+type correlationMatrix struct {
+	Columns  []string
+	Pearson  [][]float64
+	Spearman [][]float64
+}
+
+// correlationPair — пара колонок с коэффициентами, индексы указывают на Columns
+type correlationPair struct {
+	A, B     int
+	Pearson  float64
+	Spearman float64
+}
+
+// Strength — сила связи по модулю большего из двух коэффициентов
+func (p correlationPair) Strength() float64 {
+	return math.Max(absOrZero(p.Pearson), absOrZero(p.Spearman))
+}
+
+func absOrZero(v float64) float64 {
+	if math.IsNaN(v) {
+		return 0
+	}
+	return math.Abs(v)
+}
+
+// correlationColumns — числовые колонки из файла; служебные и id в корреляции не участвуют
+func correlationColumns(columns []models.ColumnInfo) []string {
+	result := []string{}
+	for _, column := range columns {
+		if isServiceColumn(column) || excludeColumn(column.Name) || !IsNumericType(column.Type) {
+			continue
+		}
+		result = append(result, column.Name)
+		if len(result) == maxCorrelationColumns {
+			break
+		}
+	}
+	return result
+}
+
+// generateSqlForCorrelations считает коэффициенты Пирсона для всех пар за один проход по всей таблице:
+// corr копит только суммы, память от числа строк не зависит. Значения приводятся к Float64, чтобы
+// Decimal и Int64 сравнивались одинаково; строки с NULL в одной из колонок пары агрегатные функции пропускают сами
+func generateSqlForCorrelations(columns []string, table models.ClickhouseTableName) string {
+	fields := []string{}
+	for i := range columns {
+		for j := i + 1; j < len(columns); j++ {
+			fields = append(fields, fmt.Sprintf("corr(toFloat64(%s), toFloat64(%s)) AS pearson__%d__%d", columns[i], columns[j], i, j))
+		}
+	}
+	return fmt.Sprintf("SELECT %s FROM %s", strings.Join(fields, ", "), table)
+}
+
+// generateSqlForRankCorrelations считает коэффициенты Спирмена по случайной выборке примерно из
+// spearmanSampleRows строк: каждая строка берется с вероятностью 1/k, k — во сколько раз таблица больше выборки.
+// Первые строки таблицы выборкой не являются: файлы часто отсортированы по дате или id
+func generateSqlForRankCorrelations(columns []string, table models.ClickhouseTableName) string {
+	fields := []string{}
+	sample := make([]string, len(columns))
+	for i, column := range columns {
+		sample[i] = fmt.Sprintf("toFloat64(%s) AS c%d", column, i)
+		for j := i + 1; j < len(columns); j++ {
+			fields = append(fields, fmt.Sprintf("rankCorr(c%d, c%d) AS spearman__%d__%d", i, j, i, j))
+		}
+	}
+	return fmt.Sprintf("SELECT %s FROM (SELECT %s FROM %s WHERE rand() %% greatest(1, toUInt64(ceil((SELECT count() FROM %s) / %d))) = 0 LIMIT %d)",
+		strings.Join(fields, ", "), strings.Join(sample, ", "), table, table, spearmanSampleRows, spearmanSampleRows)
+}
+
+// parseCorrelationResults раскладывает строку результата по матрицам; на диагонали единицы
+func parseCorrelationResults(columns []string, row map[string]interface{}) *correlationMatrix {
+	n := len(columns)
+	matrix := &correlationMatrix{Columns: columns, Pearson: make([][]float64, n), Spearman: make([][]float64, n)}
+	for i := 0; i < n; i++ {
+		matrix.Pearson[i] = make([]float64, n)
+		matrix.Spearman[i] = make([]float64, n)
+		matrix.Pearson[i][i], matrix.Spearman[i][i] = 1, 1
+	}
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			pearson := correlationValue(row[fmt.Sprintf("pearson__%d__%d", i, j)])
+			spearman := correlationValue(row[fmt.Sprintf("spearman__%d__%d", i, j)])
+			matrix.Pearson[i][j], matrix.Pearson[j][i] = pearson, pearson
+			matrix.Spearman[i][j], matrix.Spearman[j][i] = spearman, spearman
+		}
+	}
+	return matrix
+}
+
+// correlationValue — коэффициент из результата запроса; у постоянной колонки ClickHouse возвращает nan
+func correlationValue(value interface{}) float64 {
+	if value == nil {
+		return math.NaN()
+	}
+	v := toFloat64(value)
+	if math.IsInf(v, 0) {
+		return math.NaN()
+	}
+	return v
+}
+
+// Strongest — пары со связью не слабее correlationMinStrength, сильные первыми
+func (m *correlationMatrix) Strongest(limit int) []correlationPair {
+	pairs := []correlationPair{}
+	for i := range m.Columns {
+		for j := i + 1; j < len(m.Columns); j++ {
+			pair := correlationPair{A: i, B: j, Pearson: m.Pearson[i][j], Spearman: m.Spearman[i][j]}
+			if pair.Strength() >= correlationMinStrength {
+				pairs = append(pairs, pair)
+			}
+		}
+	}
+	sort.SliceStable(pairs, func(i, j int) bool {
+		return pairs[i].Strength() > pairs[j].Strength()
+	})
+	if limit > 0 && len(pairs) > limit {
+		pairs = pairs[:limit]
+	}
+	return pairs
+}
+
+// Labels — названия колонок матрицы для подписей
+func (m *correlationMatrix) Labels(tableName models.ClickhouseTableName) []string {
+	labels := make([]string, len(m.Columns))
+	for i, column := range m.Columns {
+		labels[i] = columnLabel(tableName, column)
+	}
+	return labels
+}
+
+// describeCorrelation — сила и направление связи словами
+func describeCorrelation(pair correlationPair) string {
+	strength := pair.Strength()
+	words := "умеренная"
+	switch {
+	case strength >= 0.7:
+		words = "сильная"
+	case strength >= 0.5:
+		words = "заметная"
+	}
+	sign := pair.Pearson
+	if absOrZero(pair.Spearman) > absOrZero(pair.Pearson) {
+		sign = pair.Spearman
+	}
+	if sign < 0 {
+		words += " обратная"
+	} else {
+		words += " прямая"
+	}
+	// Ранговая связь заметно сильнее линейной: значения растут вместе, но не по прямой
+	if absOrZero(pair.Spearman)-absOrZero(pair.Pearson) >= 0.2 {
+		words += ", нелинейная"
+	}
+	return words
+}
+
+func formatCoefficient(v float64) string {
+	if math.IsNaN(v) {
+		return "—"
+	}
+	return fmt.Sprintf("%.2f", v)
+}
+
+// formatCorrelations — список самых сильных связей; пустая строка, если сильных связей нет
+func formatCorrelations(tableName models.ClickhouseTableName, matrix *correlationMatrix, limit int) string {
+	pairs := matrix.Strongest(limit)
+	if len(pairs) == 0 {
+		return ""
+	}
+	labels := matrix.Labels(tableName)
+	var result strings.Builder
+	result.WriteString("🔗 Самые сильные связи между числовыми колонками:\n")
+	for _, pair := range pairs {
+		result.WriteString(fmt.Sprintf("• %s ↔ %s: Пирсон %s, Спирмен %s — %s\n",
+			labels[pair.A], labels[pair.B], formatCoefficient(pair.Pearson), formatCoefficient(pair.Spearman), describeCorrelation(pair)))
+	}
+	return result.String()
+}
+
+// computeCorrelations считает матрицы корреляций; nil, если числовых колонок меньше двух
+func computeCorrelations(db *gorm.DB, tableName models.ClickhouseTableName, columns []models.ColumnInfo) (*correlationMatrix, error) {
+	numeric := correlationColumns(columns)
+	if len(numeric) < 2 {
+		return nil, nil
+	}
+	row := map[string]interface{}{}
+	if err := db.Raw(generateSqlForCorrelations(numeric, tableName)).Scan(row).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Raw(generateSqlForRankCorrelations(numeric, tableName)).Scan(row).Error; err != nil {
+		return nil, err
+	}
+	return parseCorrelationResults(numeric, row), nil
+}
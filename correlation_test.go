@@ -0,0 +1,102 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/pivolan/stats_analyzer/domain/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCorrelationColumns(t *testing.T) {
+	columns := []models.ColumnInfo{
+		{Name: "id", Type: "Int64"},
+		{Name: LOAD_BATCH_COLUMN, Type: "LowCardinality(String)"},
+		{Name: "0001_price", Type: "Decimal(18, 2)"},
+		{Name: "0002_city", Type: "String"},
+		{Name: "0003_qty", Type: "Nullable(Int64)"},
+		{Name: "0004_rate", Type: "Float64"},
+		{Name: "0005_created", Type: "DateTime64(3)"},
+		{Name: "0006_total", Type: "Float64", DefaultType: "ALIAS"},
+	}
+	assert.Equal(t, []string{"0001_price", "0003_qty", "0004_rate"}, correlationColumns(columns))
+
+	many := []models.ColumnInfo{}
+	for i := 0; i < maxCorrelationColumns+5; i++ {
+		many = append(many, models.ColumnInfo{Name: strings.Repeat("x", i+1), Type: "Int64"})
+	}
+	assert.Len(t, correlationColumns(many), maxCorrelationColumns)
+}
+
+func TestGenerateSqlForCorrelations(t *testing.T) {
+	columns := []string{"0001_price", "0002_qty", "0003_rate"}
+	assert.Equal(t, "SELECT corr(toFloat64(0001_price), toFloat64(0002_qty)) AS pearson__0__1, "+
+		"corr(toFloat64(0001_price), toFloat64(0003_rate)) AS pearson__0__2, "+
+		"corr(toFloat64(0002_qty), toFloat64(0003_rate)) AS pearson__1__2 FROM orders_123456",
+		generateSqlForCorrelations(columns, "orders_123456"))
+	assert.Equal(t, "SELECT rankCorr(c0, c1) AS spearman__0__1, rankCorr(c0, c2) AS spearman__0__2, rankCorr(c1, c2) AS spearman__1__2 "+
+		"FROM (SELECT toFloat64(0001_price) AS c0, toFloat64(0002_qty) AS c1, toFloat64(0003_rate) AS c2 FROM orders_123456 "+
+		"WHERE rand() % greatest(1, toUInt64(ceil((SELECT count() FROM orders_123456) / 10000))) = 0 LIMIT 10000)",
+		generateSqlForRankCorrelations(columns, "orders_123456"))
+}
+
+func TestParseCorrelationResults(t *testing.T) {
+	columns := []string{"0001_price", "0002_qty", "0003_rate"}
+	row := map[string]interface{}{
+		"pearson__0__1":  0.91,
+		"spearman__0__1": "0.87",
+		"pearson__0__2":  "nan",
+		"spearman__0__2": nil,
+		"pearson__1__2":  -0.2,
+		"spearman__1__2": -0.55,
+	}
+	matrix := parseCorrelationResults(columns, row)
+	assert.Equal(t, 1.0, matrix.Pearson[1][1])
+	assert.Equal(t, 0.91, matrix.Pearson[0][1])
+	assert.Equal(t, 0.91, matrix.Pearson[1][0])
+	assert.Equal(t, 0.87, matrix.Spearman[1][0])
+	assert.True(t, math.IsNaN(matrix.Pearson[2][0]))
+	assert.True(t, math.IsNaN(matrix.Spearman[0][2]))
+
+	pairs := matrix.Strongest(0)
+	assert.Equal(t, []correlationPair{
+		{A: 0, B: 1, Pearson: 0.91, Spearman: 0.87},
+		{A: 1, B: 2, Pearson: -0.2, Spearman: -0.55},
+	}, pairs)
+	assert.Len(t, matrix.Strongest(1), 1)
+}
+
+func TestDescribeCorrelation(t *testing.T) {
+	testCases := []struct {
+		pair     correlationPair
+		expected string
+	}{
+		{correlationPair{Pearson: 0.91, Spearman: 0.87}, "сильная прямая"},
+		{correlationPair{Pearson: -0.6, Spearman: -0.5}, "заметная обратная"},
+		{correlationPair{Pearson: 0.1, Spearman: 0.45}, "умеренная прямая, нелинейная"},
+		{correlationPair{Pearson: math.NaN(), Spearman: -0.35}, "умеренная обратная, нелинейная"},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.expected, describeCorrelation(tc.pair))
+	}
+}
+
+func TestFormatCorrelations(t *testing.T) {
+	table := models.ClickhouseTableName("correlations_table")
+	setColumnMeta(table, map[string]models.ColumnMeta{"0001_price": {Label: "Цена"}, "0002_qty": {Label: "Количество"}})
+	defer deleteColumnMeta(table)
+
+	matrix := parseCorrelationResults([]string{"0001_price", "0002_qty", "0003_rate"}, map[string]interface{}{
+		"pearson__0__1": 0.91, "spearman__0__1": 0.87,
+		"pearson__0__2": 0.05, "spearman__0__2": 0.1,
+		"pearson__1__2": -0.2, "spearman__1__2": -0.55,
+	})
+	assert.Equal(t, "🔗 Самые сильные связи между числовыми колонками:\n"+
+		"• Цена ↔ Количество: Пирсон 0.91, Спирмен 0.87 — сильная прямая\n"+
+		"• Количество ↔ rate: Пирсон -0.20, Спирмен -0.55 — заметная обратная, нелинейная\n",
+		formatCorrelations(table, matrix, 0))
+
+	weak := parseCorrelationResults([]string{"0001_price", "0002_qty"}, map[string]interface{}{"pearson__0__1": 0.1, "spearman__0__1": 0.2})
+	assert.Equal(t, "", formatCorrelations(table, weak, 0))
+}
@@ -0,0 +1,358 @@
+// csv_dialect.go
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// Сколько текста (уже в UTF-8) и строк просматриваем при определении диалекта
+const (
+	dialectSampleSize  = 512 * 1024
+	dialectSampleLines = 2000
+)
+
+var (
+	dialectDelimiters = []rune{',', ';', '\t', '|'}
+	dialectQuotes     = []rune{'"', '\''}
+	dialectComments   = []string{"#", "//"}
+)
+
+// csvDialect описывает, как записан CSV файл
+type csvDialect struct {
+	Delimiter       rune
+	Quote           rune
+	BackslashEscape bool   // \" внутри кавычек вместо ""
+	SkipLines       int    // Строки заголовка отчета и прочий мусор перед шапкой таблицы
+	Comment         string // Префикс строк-комментариев, пустой если их нет
+}
+
+var defaultCSVDialect = csvDialect{Delimiter: ',', Quote: '"'}
+
+func (d csvDialect) String() string {
+	escape := `""`
+	if d.BackslashEscape {
+		escape = `\"`
+	}
+	return fmt.Sprintf("delimiter=%q quote=%q escape=%s skip=%d comment=%q", d.Delimiter, d.Quote, escape, d.SkipLines, d.Comment)
+}
+
+// sniffedRecord — запись из выборки вместе с исходной первой строкой и номером строки в файле
+type sniffedRecord struct {
+	line   int
+	raw    string
+	fields int
+}
+
+// detectDelimiter оставлен для совместимости: возвращает только разделитель найденного диалекта
+func detectDelimiter(filePath string) (rune, error) {
+	dialect, err := sniffCSVDialect(filePath)
+	return dialect.Delimiter, err
+}
+
+// sniffCSVDialect определяет разделитель, кавычки, экранирование, число мусорных строк
+// в начале файла и префикс комментариев по выборке из начала файла
+func sniffCSVDialect(filePath string) (csvDialect, error) {
+	f, _, err := openTextFile(filePath)
+	if err != nil {
+		return defaultCSVDialect, fmt.Errorf("cannot open file: %v", err)
+	}
+	defer f.Close()
+
+	buffer := make([]byte, dialectSampleSize)
+	n, err := io.ReadFull(f, buffer)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return defaultCSVDialect, fmt.Errorf("cannot read file: %v", err)
+	}
+	sample := strings.TrimPrefix(string(buffer[:n]), "\uFEFF")
+	lines := strings.Split(strings.ReplaceAll(sample, "\r\n", "\n"), "\n")
+	if n == len(buffer) && len(lines) > 1 {
+		// Последняя строка выборки обрезана
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) > dialectSampleLines {
+		lines = lines[:dialectSampleLines]
+	}
+
+	quote := detectQuoteChar(lines)
+	backslash := detectBackslashEscape(lines, quote)
+	best := defaultCSVDialect
+	bestScore := 0
+	for _, delimiter := range dialectDelimiters {
+		candidate := csvDialect{Delimiter: delimiter, Quote: quote, BackslashEscape: backslash}
+		score := scoreDialect(&candidate, lines)
+		if score > bestScore {
+			best, bestScore = candidate, score
+		}
+	}
+	if bestScore == 0 {
+		return defaultCSVDialect, fmt.Errorf("cannot detect delimiter, no consistent pattern found")
+	}
+	return best, nil
+}
+
+// detectQuoteChar выбирает кавычку, которой чаще всего открываются и закрываются поля
+func detectQuoteChar(lines []string) rune {
+	best, bestCount := dialectQuotes[0], 0
+	for _, quote := range dialectQuotes {
+		opened, closed := 0, 0
+		for _, line := range lines {
+			for i, ch := range line {
+				if ch != quote {
+					continue
+				}
+				if previous, size := utf8.DecodeLastRuneInString(line[:i]); size == 0 || isFieldBoundary(previous) {
+					opened++
+				}
+				if next, size := utf8.DecodeRuneInString(line[i+utf8.RuneLen(ch):]); size == 0 || isFieldBoundary(next) {
+					closed++
+				}
+			}
+		}
+		if count := min(opened, closed); count > bestCount {
+			best, bestCount = quote, count
+		}
+	}
+	return best
+}
+
+func isFieldBoundary(ch rune) bool {
+	for _, delimiter := range dialectDelimiters {
+		if ch == delimiter {
+			return true
+		}
+	}
+	return ch == ' '
+}
+
+// detectBackslashEscape сравнивает, как чаще экранируются кавычки внутри значений: \" или ""
+func detectBackslashEscape(lines []string, quote rune) bool {
+	backslashed, doubled := 0, 0
+	q := string(quote)
+	for _, line := range lines {
+		backslashed += strings.Count(line, `\`+q)
+		// Пустые поля "" между разделителями не считаются экранированием
+		for i := strings.Index(line, q+q); i >= 0; {
+			previous, size := utf8.DecodeLastRuneInString(line[:i])
+			emptyField := size == 0 || isFieldBoundary(previous)
+			if !emptyField {
+				doubled++
+			}
+			next := strings.Index(line[i+2:], q+q)
+			if next < 0 {
+				break
+			}
+			i += 2 + next
+		}
+	}
+	return backslashed > doubled
+}
+
+// scoreDialect разбирает выборку кандидатом, заполняет SkipLines и Comment
+// и возвращает число записей с типичным количеством полей (0 — диалект не подходит)
+func scoreDialect(dialect *csvDialect, lines []string) int {
+	records := sniffRecords(*dialect, lines)
+
+	modal, _ := modalFieldCount(records, "")
+	if modal < 2 {
+		return 0
+	}
+	// Префикс считается комментарием, если ни одна начинающаяся с него строка не похожа на запись таблицы
+	for _, prefix := range dialectComments {
+		found, looksLikeData := false, false
+		for _, record := range records {
+			if strings.HasPrefix(strings.TrimLeft(record.raw, " \t"), prefix) {
+				found = true
+				looksLikeData = looksLikeData || record.fields == modal
+			}
+		}
+		if found && !looksLikeData {
+			dialect.Comment = prefix
+			break
+		}
+	}
+	modal, score := modalFieldCount(records, dialect.Comment)
+	if modal < 2 {
+		return 0
+	}
+
+	// Шапка — первая запись, с которой начинается серия записей с типичным числом полей
+	var data []sniffedRecord
+	for _, record := range records {
+		if !isCommentLine(record.raw, dialect.Comment) {
+			data = append(data, record)
+		}
+	}
+	for i := range data {
+		run := 5
+		if len(data)-i < run {
+			run = len(data) - i
+		}
+		consistent := true
+		for _, record := range data[i : i+run] {
+			if record.fields != modal {
+				consistent = false
+				break
+			}
+		}
+		if consistent {
+			dialect.SkipLines = data[i].line
+			break
+		}
+	}
+	return score
+}
+
+// sniffRecords разбирает строки выборки на записи с учетом кавычек и переносов внутри них
+func sniffRecords(dialect csvDialect, lines []string) []sniffedRecord {
+	var records []sniffedRecord
+	reader := &dialectReader{dialect: dialect}
+	for i := 0; i < len(lines); {
+		start := i
+		if strings.TrimSpace(lines[i]) == "" {
+			i++
+			continue
+		}
+		next := func() (string, bool) {
+			i++
+			if i >= len(lines) {
+				return "", false
+			}
+			return lines[i], true
+		}
+		fields := reader.parseRecord(lines[i], next)
+		i++
+		records = append(records, sniffedRecord{line: start, raw: lines[start], fields: len(fields)})
+	}
+	return records
+}
+
+// modalFieldCount возвращает самое частое число полей и количество таких записей
+func modalFieldCount(records []sniffedRecord, comment string) (int, int) {
+	counts := map[int]int{}
+	modal, modalCount := 0, 0
+	for _, record := range records {
+		if isCommentLine(record.raw, comment) {
+			continue
+		}
+		counts[record.fields]++
+		if c := counts[record.fields]; c > modalCount || (c == modalCount && record.fields > modal) {
+			modal, modalCount = record.fields, c
+		}
+	}
+	return modal, modalCount
+}
+
+func isCommentLine(line, comment string) bool {
+	return comment != "" && strings.HasPrefix(strings.TrimLeft(line, " \t"), comment)
+}
+
+// dialectReader читает CSV по найденному диалекту, пропуская мусорные строки, комментарии и пустые строки
+type dialectReader struct {
+	reader  *bufio.Reader
+	dialect csvDialect
+	skipped bool
+	line    int64    // номер последней прочитанной строки файла
+	start   int64    // строка, с которой началась последняя запись
+	raw     []string // строки файла последней записи
+}
+
+func newDialectReader(r io.Reader, dialect csvDialect) *dialectReader {
+	return &dialectReader{reader: bufio.NewReaderSize(r, 64*1024), dialect: dialect}
+}
+
+func (d *dialectReader) readLine() (string, bool) {
+	line, err := d.reader.ReadString('\n')
+	if err != nil && line == "" {
+		return "", false
+	}
+	d.line++
+	return strings.TrimPrefix(strings.TrimRight(line, "\r\n"), "\uFEFF"), true
+}
+
+func (d *dialectReader) Read() ([]string, error) {
+	if !d.skipped {
+		d.skipped = true
+		for i := 0; i < d.dialect.SkipLines; i++ {
+			if _, ok := d.readLine(); !ok {
+				return nil, io.EOF
+			}
+		}
+	}
+	for {
+		line, ok := d.readLine()
+		if !ok {
+			return nil, io.EOF
+		}
+		if strings.TrimSpace(line) == "" || isCommentLine(line, d.dialect.Comment) {
+			continue
+		}
+		d.start, d.raw = d.line, append(d.raw[:0], line)
+		return d.parseRecord(line, func() (string, bool) {
+			more, ok := d.readLine()
+			if ok {
+				d.raw = append(d.raw, more)
+			}
+			return more, ok
+		}), nil
+	}
+}
+
+// Position возвращает номер строки файла, с которой началась последняя запись, и ее исходный текст
+func (d *dialectReader) Position() (int64, string) {
+	return d.start, strings.Join(d.raw, "\n")
+}
+
+// parseRecord разбирает одну запись; если кавычка не закрыта до конца строки, дочитывает следующие строки через next.
+// Как и encoding/csv с LazyQuotes и TrimLeadingSpace, кавычки внутри неэкранированного поля остаются как есть.
+// Строка читается по байтам без копирования в []rune: файлы бывают в несколько гигабайт
+func (d *dialectReader) parseRecord(line string, next func() (string, bool)) []string {
+	var fields []string
+	var field strings.Builder
+	quoted, atStart, closed := false, true, false
+	for i := 0; ; {
+		if i >= len(line) {
+			if quoted {
+				more, ok := next()
+				if ok {
+					field.WriteRune('\n')
+					line, i = more, 0
+					continue
+				}
+			}
+			break
+		}
+		ch, size := utf8.DecodeRuneInString(line[i:])
+		i += size
+		following, followingSize := utf8.DecodeRuneInString(line[i:])
+		switch {
+		case quoted && d.dialect.BackslashEscape && ch == '\\' && followingSize > 0:
+			i += followingSize
+			field.WriteRune(following)
+		case quoted && ch == d.dialect.Quote:
+			if !d.dialect.BackslashEscape && followingSize > 0 && following == d.dialect.Quote {
+				i += followingSize
+				field.WriteRune(ch)
+			} else {
+				quoted, closed = false, true
+			}
+		case quoted:
+			field.WriteRune(ch)
+		case ch == d.dialect.Delimiter:
+			fields = append(fields, field.String())
+			field.Reset()
+			atStart, closed = true, false
+		case atStart && (ch == ' ' || ch == '\t'):
+		case atStart && ch == d.dialect.Quote:
+			quoted, atStart = true, false
+		case closed && (ch == ' ' || ch == '\t'):
+		default:
+			atStart = false
+			field.WriteRune(ch)
+		}
+	}
+	return append(fields, field.String())
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/gorm"
+)
+
+func TestSniffCSVDialect(t *testing.T) {
+	testCases := []struct {
+		name     string
+		content  string
+		expected csvDialect
+	}{
+		{
+			name:     "quoted delimiters",
+			content:  "name,address,age\n\"Smith, John\",\"Moscow, Tverskaya 1\",30\n\"Doe, Jane\",\"Kazan, Baumana 2\",25\n",
+			expected: csvDialect{Delimiter: ',', Quote: '"'},
+		},
+		{
+			name:     "report title before header",
+			content:  "Отчет о продажах\nПериод: январь 2024; сформирован 01.02.2024\n\nproduct;price;qty\napple;10;1\npear;12;2\nplum;8;3\n",
+			expected: csvDialect{Delimiter: ';', Quote: '"', SkipLines: 3},
+		},
+		{
+			name:     "comment lines",
+			content:  "# exported by tool\n# version 2\nid|value\n1|a\n# inline note\n2|b\n3|c\n",
+			expected: csvDialect{Delimiter: '|', Quote: '"', SkipLines: 2, Comment: "#"},
+		},
+		{
+			name:     "header starting with hash is not a comment",
+			content:  "#,name\n1,a\n2,b\n",
+			expected: csvDialect{Delimiter: ',', Quote: '"'},
+		},
+		{
+			name:     "backslash escaping",
+			content:  "id,quote\n1,\"he said \\\"hi, there\\\"\"\n2,\"she said \\\"bye\\\"\"\n",
+			expected: csvDialect{Delimiter: ',', Quote: '"', BackslashEscape: true},
+		},
+		{
+			name:     "single quotes",
+			content:  "id\tcity\n1\t'New York\tNY'\n2\t'Boston'\n",
+			expected: csvDialect{Delimiter: '\t', Quote: '\''},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			filePath := filepath.Join(t.TempDir(), "data.csv")
+			assert.NoError(t, os.WriteFile(filePath, []byte(tc.content), 0644))
+			dialect, err := sniffCSVDialect(filePath)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, dialect)
+		})
+	}
+}
+
+func TestDialectReader(t *testing.T) {
+	testCases := []struct {
+		name     string
+		dialect  csvDialect
+		content  string
+		expected [][]string
+	}{
+		{
+			name:     "doubled quotes and multiline field",
+			dialect:  csvDialect{Delimiter: ',', Quote: '"'},
+			content:  "a,b\n\"x \"\"y\"\"\",\"line1\nline2\"\n",
+			expected: [][]string{{"a", "b"}, {`x "y"`, "line1\nline2"}},
+		},
+		{
+			name:     "backslash escape",
+			dialect:  csvDialect{Delimiter: ';', Quote: '"', BackslashEscape: true},
+			content:  "\"a\\\"b\"; c\r\n",
+			expected: [][]string{{`a"b`, "c"}},
+		},
+		{
+			name:     "multibyte text",
+			dialect:  csvDialect{Delimiter: ';', Quote: '"', BackslashEscape: true},
+			content:  "Город;Комментарий\n\"Санкт-Петербург\";\"сказал \\\"привет\\\" — ок\"\n",
+			expected: [][]string{{"Город", "Комментарий"}, {"Санкт-Петербург", `сказал "привет" — ок`}},
+		},
+		{
+			name:     "skip lines and comments",
+			dialect:  csvDialect{Delimiter: ',', Quote: '"', SkipLines: 1, Comment: "//"},
+			content:  "title\n// note\nx,y\n\n1,2\n",
+			expected: [][]string{{"x", "y"}, {"1", "2"}},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := newDialectReader(strings.NewReader(tc.content), tc.dialect)
+			var rows [][]string
+			for {
+				row, err := r.Read()
+				if err == io.EOF {
+					break
+				}
+				assert.NoError(t, err)
+				rows = append(rows, row)
+			}
+			assert.Equal(t, tc.expected, rows)
+		})
+	}
+}
+
+func TestImportCSVWithPreamble(t *testing.T) {
+	original := getMD5String
+	getMD5String = func(input string) string {
+		return "123456"
+	}
+	defer func() {
+		getMD5String = original
+	}()
+
+	content := "Sales report\n# generated automatically\nproduct;comment;price\n\"Apple\";\"red; sweet\";10\n\"Pear\";\"green\";12.5\n"
+	filePath := filepath.Join(t.TempDir(), "report.csv")
+	assert.NoError(t, os.WriteFile(filePath, []byte(content), 0644))
+
+	mockDB := NewMockDB()
+	mockDB.On("Exec", mock.Anything, mock.Anything).Return(&gorm.DB{})
+	tableName, err := importDataIntoClickHouse(filePath, mockDB, importOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "0001_product_0002_comment_0003_price_123456", string(tableName))
+	assert.Equal(t, "INSERT INTO 0001_product_0002_comment_0003_price_123456 SETTINGS max_query_size = 5048576, max_insert_block_size = 5000000 FORMAT CSV \n"+
+		"1,Apple,red; sweet,10\n2,Pear,green,12.5\n", mockDB.lastQuery)
+}
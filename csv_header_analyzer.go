@@ -34,10 +34,12 @@ func AnalyzeHeaders(firstRow []string) *models.HeaderAnalysis {
 	// Если большинство полей похожи на заголовки
 	if float64(headerLikeCount)/float64(len(firstRow)) >= 0.5 {
 		result.FirstRowIsData = false
+		result.Labels = make([]string, len(firstRow))
 		// Очищаем существующие заголовки
 		for i, header := range firstRow {
 
 			result.Headers[i] = cleanHeaderName(header, i)
+			result.Labels[i] = strings.TrimSpace(header)
 
 		}
 	} else {
@@ -0,0 +1,180 @@
+// date_detection.go
+package main
+
+import (
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// dateLayouts — форматы дат, которые распознаются при импорте. Формат колонки выбирается голосованием
+// по всем значениям выборки; при равенстве голосов побеждает формат, стоящий раньше (день перед месяцем)
+var dateLayouts = []string{
+	"2006-01-02",
+	"02-01-2006",
+	"01-02-2006",
+	"02/01/2006",
+	"01/02/2006",
+	"02.01.2006",
+	"2006.01.02",
+	"2006/01/02",
+	"2006-01-02 15:04:05.999999",
+	"2006-01-02T15:04:05.999999",
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999Z07:00",
+	"2006-01-02 15:04:05.999999 -0700",
+	"2006/01/02 15:04:05",
+	"02-01-2006 15:04:05",
+	"01-02-2006 15:04:05",
+	"02/01/2006 15:04:05",
+	"01/02/2006 15:04:05",
+	"02.01.2006 15:04:05",
+	"02.01.2006 15:04",
+	"2006.01.02 15:04:05",
+	time.RFC1123,
+	time.RFC1123Z,
+	"2 Jan 2006",
+	"2 January 2006",
+	"Jan 2, 2006",
+	"January 2, 2006",
+	"2 Jan 2006 15:04",
+	"2 Jan 2006 15:04:05",
+	"Jan 2006",
+}
+
+// Unix время в секундах и миллисекундах считается датой, только если попадает в 2000–2100 годы:
+// иначе за даты сойдут идентификаторы и суммы
+const (
+	epochMinSeconds = 946684800  // 2000-01-01
+	epochMaxSeconds = 4102444800 // 2100-01-01
+
+	EPOCH_SECONDS      = "seconds"
+	EPOCH_MILLISECONDS = "milliseconds"
+)
+
+// Русские названия месяцев во всех падежах и сокращениях переводятся в английские для time.Parse
+var russianMonths = map[string]string{}
+
+func init() {
+	forms := map[string][]string{
+		"Jan": {"январь", "января", "янв"},
+		"Feb": {"февраль", "февраля", "фев", "февр"},
+		"Mar": {"март", "марта", "мар"},
+		"Apr": {"апрель", "апреля", "апр"},
+		"May": {"май", "мая"},
+		"Jun": {"июнь", "июня", "июн"},
+		"Jul": {"июль", "июля", "июл"},
+		"Aug": {"август", "августа", "авг"},
+		"Sep": {"сентябрь", "сентября", "сен", "сент"},
+		"Oct": {"октябрь", "октября", "окт"},
+		"Nov": {"ноябрь", "ноября", "ноя", "нояб"},
+		"Dec": {"декабрь", "декабря", "дек"},
+	}
+	for month, names := range forms {
+		for _, name := range names {
+			russianMonths[name] = month
+		}
+	}
+}
+
+// translateRussianMonths заменяет "12 марта 2023 г." на "12 Mar 2023"
+func translateRussianMonths(value string) string {
+	fields := strings.Fields(strings.ToLower(value))
+	result := make([]string, 0, len(fields))
+	for i, field := range fields {
+		word := strings.TrimRight(field, ".,")
+		if month, ok := russianMonths[word]; ok {
+			field = month
+		} else if i == len(fields)-1 && (word == "г" || word == "года") {
+			continue
+		}
+		result = append(result, field)
+	}
+	return strings.Join(result, " ")
+}
+
+func hasCyrillic(value string) bool {
+	for _, r := range value {
+		if unicode.Is(unicode.Cyrillic, r) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseDateLayout разбирает значение по одному формату, русские месяцы понимаются в любом формате с названием месяца
+func parseDateLayout(value, layout string) (time.Time, error) {
+	if hasCyrillic(value) {
+		value = translateRussianMonths(value)
+	}
+	return time.Parse(layout, value)
+}
+
+// matchDateLayouts возвращает все форматы, которым соответствует значение: "03/04/2024" подходит и дню,
+// и месяцу первым, "12/31/2024" — только месяцу
+func matchDateLayouts(value string) []string {
+	value = strings.TrimSpace(value)
+	if len(value) < 6 || len(value) > 64 || !strings.ContainsAny(value, "0123456789") || digitsPattern.MatchString(value) {
+		return nil
+	}
+	var layouts []string
+	for _, layout := range dateLayouts {
+		if _, err := parseDateLayout(value, layout); err == nil {
+			layouts = append(layouts, layout)
+		}
+	}
+	return layouts
+}
+
+func isDateTimeLayout(layout string) bool {
+	return strings.Contains(layout, "15:04")
+}
+
+// rankDateLayouts упорядочивает форматы по числу голосов, при равенстве — по порядку в dateLayouts
+func rankDateLayouts(votes map[string]int) []string {
+	var layouts []string
+	for _, layout := range dateLayouts {
+		if votes[layout] > 0 {
+			layouts = append(layouts, layout)
+		}
+	}
+	sort.SliceStable(layouts, func(i, j int) bool {
+		return votes[layouts[i]] > votes[layouts[j]]
+	})
+	return layouts
+}
+
+// parseColumnDate разбирает значение по форматам колонки в порядке голосов, затем по общему списку
+func parseColumnDate(value string, layouts []string) (time.Time, bool) {
+	value = strings.TrimSpace(value)
+	for _, layout := range layouts {
+		if t, err := parseDateLayout(value, layout); err == nil {
+			return t, true
+		}
+	}
+	if t, _, _, err := tryParseDateTime(value); err == nil {
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+// epochKind определяет, похоже ли целое число на Unix время в секундах или миллисекундах
+func epochKind(value int64) string {
+	switch {
+	case value >= epochMinSeconds && value < epochMaxSeconds:
+		return EPOCH_SECONDS
+	case value >= epochMinSeconds*1000 && value < epochMaxSeconds*1000:
+		return EPOCH_MILLISECONDS
+	}
+	return ""
+}
+
+// epochAliasDefinition — вычисляемая колонка с датой для целочисленной колонки с Unix временем.
+// Исходные числа остаются как есть, а анализ по датам видит новую колонку
+func epochAliasDefinition(name, epoch string) string {
+	if epoch == EPOCH_MILLISECONDS {
+		return name + "_datetime DateTime64(3) ALIAS fromUnixTimestamp64Milli(" + name + ")"
+	}
+	return name + "_datetime DateTime ALIAS toDateTime(" + name + ")"
+}
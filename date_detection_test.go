@@ -0,0 +1,105 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/gorm"
+)
+
+func TestInferDateColumns(t *testing.T) {
+	testCases := []struct {
+		name       string
+		values     []string
+		expected   string
+		normalized []string
+	}{
+		{"us order resolved by unambiguous row", []string{"03/04/2024", "12/31/2024"}, "Date", []string{"2024-03-04", "2024-12-31"}},
+		{"day first resolved by unambiguous row", []string{"03/04/2024", "31/12/2024"}, "Date", []string{"2024-04-03", "2024-12-31"}},
+		{"ambiguous defaults to day first", []string{"03/04/2024", "05/06/2024"}, "Date", []string{"2024-04-03", "2024-06-05"}},
+		{"iso with offset", []string{"2024-01-02T15:04:05+03:00", "2024-01-02T10:00:00.5Z"}, "DateTime64", []string{"2024-01-02 12:04:05", "2024-01-02 10:00:00.5"}},
+		{"rfc 1123", []string{"Mon, 02 Jan 2006 15:04:05 GMT", "Tue, 03 Jan 2006 08:00:00 GMT"}, "DateTime64", []string{"2006-01-02 15:04:05", "2006-01-03 08:00:00"}},
+		{"russian month names", []string{"12 марта 2023", "1 января 2024 г."}, "Date", []string{"2023-03-12", "2024-01-01"}},
+		{"mostly datetimes", []string{"2024-01-02 10:00:00", "2024-01-03 11:30:00", "2024-01-04"}, "DateTime64", []string{"2024-01-02 10:00:00", "2024-01-03 11:30:00", "2024-01-04 00:00:00"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rows := make([][]string, len(tc.values))
+			for i, value := range tc.values {
+				rows[i] = []string{value}
+			}
+			types, _, formats := inferColumnTypes(&sliceRowReader{rows: rows}, 1)
+			assert.Equal(t, tc.expected, types[0])
+			for i, value := range tc.values {
+				assert.Equal(t, tc.normalized[i], normalizeValue(types[0], formats[0], value))
+			}
+		})
+	}
+}
+
+func TestInferEpochColumns(t *testing.T) {
+	testCases := []struct {
+		name   string
+		values []string
+		epoch  string
+	}{
+		{"seconds", []string{"1700000000", "1700003600"}, EPOCH_SECONDS},
+		{"milliseconds", []string{"1700000000000", "1700003600123"}, EPOCH_MILLISECONDS},
+		{"ids", []string{"1", "1700003600"}, ""},
+		{"mixed units", []string{"1700000000", "1700003600123"}, ""},
+		{"same value", []string{"1700000000", "1700000000"}, ""},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rows := make([][]string, len(tc.values))
+			for i, value := range tc.values {
+				rows[i] = []string{value}
+			}
+			types, _, formats := inferColumnTypes(&sliceRowReader{rows: rows}, 1)
+			assert.Equal(t, "Int64", types[0])
+			assert.Equal(t, tc.epoch, formats[0].Epoch)
+		})
+	}
+}
+
+func TestImportEpochColumnAddsDate(t *testing.T) {
+	original := getMD5String
+	getMD5String = func(input string) string {
+		return "123456"
+	}
+	defer func() {
+		getMD5String = original
+	}()
+
+	filePath := filepath.Join(t.TempDir(), "events.csv")
+	assert.NoError(t, os.WriteFile(filePath, []byte("event,ts\nlogin,1700000000\nlogout,1700003600\n"), 0644))
+
+	mockDB := NewMockDB()
+	mockDB.On("Exec", mock.Anything, mock.Anything).Return(&gorm.DB{})
+	_, err := importFileIntoClickHouse(filePath, mockDB, importOptions{})
+	assert.NoError(t, err)
+
+	createSQL := ""
+	for _, call := range mockDB.Calls {
+		if query := call.Arguments.String(0); strings.HasPrefix(query, "CREATE TABLE") {
+			createSQL = query
+		}
+	}
+	assert.Contains(t, createSQL, "0002_ts Int64")
+	assert.Contains(t, createSQL, "0002_ts_datetime DateTime ALIAS toDateTime(0002_ts)")
+	assert.Contains(t, mockDB.lastQuery, "1,login,1700000000\n2,logout,1700003600\n")
+}
+
+func TestResolveFormatWithoutDateVotes(t *testing.T) {
+	// Тип даты без голосов за формат: брать первый формат не из чего
+	column := newColumnInference()
+	column.kind = "Date"
+	assert.NotPanics(t, func() {
+		assert.Equal(t, columnFormat{}, column.resolveFormat())
+	})
+	assert.Equal(t, "String", column.columnType(true))
+}
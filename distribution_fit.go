@@ -0,0 +1,476 @@
+// distribution_fit.go
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/pivolan/stats_analyzer/domain/models"
+	"gorm.io/gorm"
+)
+
+// Форма распределения числовой колонки: асимметрия, эксцесс, тест нормальности и распределения,
+// которые лучше всего описывают значения. Параметры подбираются по случайной выборке,
+// а распределения сравниваются по статистике Колмогорова–Смирнова: чем она меньше, тем ближе кривая к данным
+
+const (
+	distributionSampleRows = 10000
+	// Тяжелыми считаются хвосты тяжелее, чем у экспоненциального распределения, у которого эксцесс 6
+	heavyTailKurtosis     = 7.0
+	symmetricSkewness     = 0.5
+	normalitySignificance = 0.05
+	fittedCurvePoints     = 200
+)
+
+// fittedDistribution — распределение с подобранными параметрами
+type fittedDistribution interface {
+	Name() string
+	// Params — параметры для подписи, например "μ=1.2, σ=0.3"
+	Params() string
+	// NumParams — число подобранных параметров, штраф в AIC
+	NumParams() int
+	PDF(x float64) float64
+	CDF(x float64) float64
+}
+
+type normalDistribution struct {
+	Mu, Sigma float64
+}
+
+func (d normalDistribution) Name() string   { return "нормальное" }
+func (d normalDistribution) NumParams() int { return 2 }
+func (d normalDistribution) Params() string {
+	return fmt.Sprintf("μ=%s, σ=%s", formatParam(d.Mu), formatParam(d.Sigma))
+}
+func (d normalDistribution) PDF(x float64) float64 {
+	z := (x - d.Mu) / d.Sigma
+	return math.Exp(-z*z/2) / (d.Sigma * math.Sqrt(2*math.Pi))
+}
+func (d normalDistribution) CDF(x float64) float64 {
+	return normalCDF((x - d.Mu) / d.Sigma)
+}
+
+// lognormalDistribution — логарифм значений распределен нормально с параметрами Mu и Sigma
+type lognormalDistribution struct {
+	Mu, Sigma float64
+}
+
+func (d lognormalDistribution) Name() string   { return "логнормальное" }
+func (d lognormalDistribution) NumParams() int { return 2 }
+func (d lognormalDistribution) Params() string {
+	return fmt.Sprintf("μ=%s, σ=%s", formatParam(d.Mu), formatParam(d.Sigma))
+}
+func (d lognormalDistribution) PDF(x float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+	return normalDistribution{d.Mu, d.Sigma}.PDF(math.Log(x)) / x
+}
+func (d lognormalDistribution) CDF(x float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+	return normalCDF((math.Log(x) - d.Mu) / d.Sigma)
+}
+
+type exponentialDistribution struct {
+	Lambda float64
+}
+
+func (d exponentialDistribution) Name() string   { return "экспоненциальное" }
+func (d exponentialDistribution) NumParams() int { return 1 }
+func (d exponentialDistribution) Params() string {
+	return fmt.Sprintf("λ=%s", formatParam(d.Lambda))
+}
+func (d exponentialDistribution) PDF(x float64) float64 {
+	if x < 0 {
+		return 0
+	}
+	return d.Lambda * math.Exp(-d.Lambda*x)
+}
+func (d exponentialDistribution) CDF(x float64) float64 {
+	if x < 0 {
+		return 0
+	}
+	return 1 - math.Exp(-d.Lambda*x)
+}
+
+// gammaDistribution — форма K и масштаб Theta
+type gammaDistribution struct {
+	K, Theta float64
+}
+
+func (d gammaDistribution) Name() string   { return "гамма" }
+func (d gammaDistribution) NumParams() int { return 2 }
+func (d gammaDistribution) Params() string {
+	return fmt.Sprintf("k=%s, θ=%s", formatParam(d.K), formatParam(d.Theta))
+}
+func (d gammaDistribution) PDF(x float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+	lgamma, _ := math.Lgamma(d.K)
+	return math.Exp((d.K-1)*math.Log(x) - x/d.Theta - d.K*math.Log(d.Theta) - lgamma)
+}
+func (d gammaDistribution) CDF(x float64) float64 {
+	return regularizedGammaP(d.K, x/d.Theta)
+}
+
+// paretoDistribution — степенной закон: значения от Xm, хвост убывает как x^-(Alpha+1)
+type paretoDistribution struct {
+	Xm, Alpha float64
+}
+
+func (d paretoDistribution) Name() string   { return "Парето (степенное)" }
+func (d paretoDistribution) NumParams() int { return 2 }
+func (d paretoDistribution) Params() string {
+	return fmt.Sprintf("xm=%s, α=%s", formatParam(d.Xm), formatParam(d.Alpha))
+}
+func (d paretoDistribution) PDF(x float64) float64 {
+	if x < d.Xm {
+		return 0
+	}
+	return d.Alpha * math.Pow(d.Xm, d.Alpha) / math.Pow(x, d.Alpha+1)
+}
+func (d paretoDistribution) CDF(x float64) float64 {
+	if x < d.Xm {
+		return 0
+	}
+	return 1 - math.Pow(d.Xm/x, d.Alpha)
+}
+
+type uniformDistribution struct {
+	A, B float64
+}
+
+func (d uniformDistribution) Name() string   { return "равномерное" }
+func (d uniformDistribution) NumParams() int { return 2 }
+func (d uniformDistribution) Params() string {
+	return fmt.Sprintf("от %s до %s", formatParam(d.A), formatParam(d.B))
+}
+func (d uniformDistribution) PDF(x float64) float64 {
+	if x < d.A || x > d.B {
+		return 0
+	}
+	return 1 / (d.B - d.A)
+}
+func (d uniformDistribution) CDF(x float64) float64 {
+	switch {
+	case x <= d.A:
+		return 0
+	case x >= d.B:
+		return 1
+	}
+	return (x - d.A) / (d.B - d.A)
+}
+
+func formatParam(v float64) string {
+	return fmt.Sprintf("%.4g", v)
+}
+
+// sampleMoments — описательные статистики выборки для формы распределения
+type sampleMoments struct {
+	N        int
+	Mean     float64
+	StdDev   float64
+	Skewness float64
+	Kurtosis float64 // избыточный эксцесс: у нормального распределения 0
+	// Тест Жарка–Бера: асимметрия и эксцесс вместе, у нормальных данных статистика распределена как хи-квадрат с 2 степенями свободы
+	JarqueBera float64
+	PValue     float64
+}
+
+func computeMoments(values []float64) sampleMoments {
+	n := float64(len(values))
+	moments := sampleMoments{N: len(values), Skewness: math.NaN(), Kurtosis: math.NaN(), JarqueBera: math.NaN(), PValue: math.NaN()}
+	if len(values) == 0 {
+		return moments
+	}
+	for _, v := range values {
+		moments.Mean += v
+	}
+	moments.Mean /= n
+	var m2, m3, m4 float64
+	for _, v := range values {
+		d := v - moments.Mean
+		m2 += d * d
+		m3 += d * d * d
+		m4 += d * d * d * d
+	}
+	m2, m3, m4 = m2/n, m3/n, m4/n
+	moments.StdDev = math.Sqrt(m2)
+	if m2 == 0 {
+		return moments
+	}
+	moments.Skewness = m3 / math.Pow(m2, 1.5)
+	moments.Kurtosis = m4/(m2*m2) - 3
+	moments.JarqueBera = n / 6 * (moments.Skewness*moments.Skewness + moments.Kurtosis*moments.Kurtosis/4)
+	moments.PValue = chiSquareSurvival(moments.JarqueBera, 2)
+	return moments
+}
+
+// IsNormal — тест Жарка–Бера не отвергает нормальность
+func (m sampleMoments) IsNormal() bool {
+	return !math.IsNaN(m.PValue) && m.PValue >= normalitySignificance
+}
+
+func (m sampleMoments) HeavyTailed() bool {
+	return m.Kurtosis > heavyTailKurtosis
+}
+
+// fitCandidates подбирает параметры всех распределений, которые допускают такие значения:
+// логнормальное, гамма и Парето — только для положительных, экспоненциальное — для неотрицательных
+func fitCandidates(values []float64, moments sampleMoments) []fittedDistribution {
+	if len(values) < 2 || moments.StdDev == 0 {
+		return nil
+	}
+	minValue, maxValue := values[0], values[0]
+	for _, v := range values {
+		minValue = math.Min(minValue, v)
+		maxValue = math.Max(maxValue, v)
+	}
+	candidates := []fittedDistribution{
+		normalDistribution{Mu: moments.Mean, Sigma: moments.StdDev},
+		uniformDistribution{A: minValue, B: maxValue},
+	}
+	if minValue >= 0 && moments.Mean > 0 {
+		candidates = append(candidates, exponentialDistribution{Lambda: 1 / moments.Mean})
+	}
+	if minValue <= 0 {
+		return candidates
+	}
+
+	n := float64(len(values))
+	var sumLog, sumLogRatio float64
+	for _, v := range values {
+		sumLog += math.Log(v)
+		sumLogRatio += math.Log(v / minValue)
+	}
+	meanLog := sumLog / n
+	var sqLog float64
+	for _, v := range values {
+		d := math.Log(v) - meanLog
+		sqLog += d * d
+	}
+	if sigma := math.Sqrt(sqLog / n); sigma > 0 {
+		candidates = append(candidates, lognormalDistribution{Mu: meanLog, Sigma: sigma})
+	}
+	// Приближение Минки к оценке максимального правдоподобия формы гамма-распределения, ошибка меньше 1.5%
+	if s := math.Log(moments.Mean) - meanLog; s > 0 {
+		k := (3 - s + math.Sqrt((s-3)*(s-3)+24*s)) / (12 * s)
+		candidates = append(candidates, gammaDistribution{K: k, Theta: moments.Mean / k})
+	}
+	if sumLogRatio > 0 {
+		candidates = append(candidates, paretoDistribution{Xm: minValue, Alpha: n / sumLogRatio})
+	}
+	return candidates
+}
+
+// distributionFit — насколько распределение подходит к выборке
+type distributionFit struct {
+	Distribution fittedDistribution
+	KS           float64 // наибольшее расхождение функций распределения
+	// PValue теста Колмогорова–Смирнова. Параметры подобраны по той же выборке, поэтому p-значение завышено
+	// и годится для сравнения распределений, а не как строгий тест
+	PValue float64
+	AIC    float64
+}
+
+// kolmogorovSmirnov — статистика KS для отсортированных значений
+func kolmogorovSmirnov(sorted []float64, distribution fittedDistribution) float64 {
+	n := float64(len(sorted))
+	d := 0.0
+	for i, v := range sorted {
+		cdf := distribution.CDF(v)
+		d = math.Max(d, math.Max(cdf-float64(i)/n, float64(i+1)/n-cdf))
+	}
+	return d
+}
+
+// akaike — AIC = 2k - 2·ln L; значение вне области распределения дает +Inf
+func akaike(values []float64, distribution fittedDistribution) float64 {
+	logLikelihood := 0.0
+	for _, v := range values {
+		logLikelihood += math.Log(distribution.PDF(v))
+	}
+	return 2*float64(distribution.NumParams()) - 2*logLikelihood
+}
+
+// fitDistributions подбирает распределения и сортирует их по статистике KS, лучшее — первое
+func fitDistributions(values []float64, moments sampleMoments) []distributionFit {
+	sorted := make([]float64, len(values))
+	copy(sorted, values)
+	sort.Float64s(sorted)
+
+	fits := []distributionFit{}
+	for _, distribution := range fitCandidates(sorted, moments) {
+		ks := kolmogorovSmirnov(sorted, distribution)
+		fits = append(fits, distributionFit{
+			Distribution: distribution,
+			KS:           ks,
+			PValue:       kolmogorovSurvival(ks, len(sorted)),
+			AIC:          akaike(sorted, distribution),
+		})
+	}
+	sort.SliceStable(fits, func(i, j int) bool {
+		return fits[i].KS < fits[j].KS
+	})
+	return fits
+}
+
+// distributionShape — форма распределения колонки по выборке
+type distributionShape struct {
+	Moments sampleMoments
+	Fits    []distributionFit
+}
+
+// Best — лучше всего подходящее распределение, nil если подобрать не удалось
+func (s *distributionShape) Best() *distributionFit {
+	if s == nil || len(s.Fits) == 0 {
+		return nil
+	}
+	return &s.Fits[0]
+}
+
+func analyzeDistribution(values []float64) *distributionShape {
+	moments := computeMoments(values)
+	return &distributionShape{Moments: moments, Fits: fitDistributions(values, moments)}
+}
+
+// FittedCurve — плотность лучшего распределения в points точках от from до to для наложения на гистограмму
+func (f *distributionFit) FittedCurve(from, to float64, points int) ([]float64, []float64) {
+	if points < 2 || to <= from {
+		return nil, nil
+	}
+	xValues := make([]float64, points)
+	yValues := make([]float64, points)
+	step := (to - from) / float64(points-1)
+	for i := range xValues {
+		xValues[i] = from + step*float64(i)
+		yValues[i] = f.Distribution.PDF(xValues[i])
+		if math.IsInf(yValues[i], 0) || math.IsNaN(yValues[i]) {
+			yValues[i] = 0
+		}
+	}
+	return xValues, yValues
+}
+
+// generateSqlForDistributionSample — случайная выборка конечных значений колонки. groupArraySample
+// держит в памяти только limit значений, а не сортирует всю таблицу, как ORDER BY rand()
+func generateSqlForDistributionSample(column string, table models.ClickhouseTableName, limit int) string {
+	return fmt.Sprintf("SELECT groupArraySample(%[3]d)(toFloat64(%[1]s)) AS sample FROM %[2]s WHERE isFinite(toFloat64(%[1]s))",
+		column, table, limit)
+}
+
+// computeDistributionShape подбирает распределения по выборке из колонки; nil, если значений меньше двух
+func computeDistributionShape(db *gorm.DB, tableName models.ClickhouseTableName, column string) (*distributionShape, error) {
+	var result struct {
+		Sample string
+	}
+	if err := db.Raw(generateSqlForDistributionSample(column, tableName, distributionSampleRows)).Scan(&result).Error; err != nil {
+		return nil, err
+	}
+	values := parseFloatArray(result.Sample)
+	if len(values) < 2 {
+		return nil, nil
+	}
+	return analyzeDistribution(values), nil
+}
+
+func describeSkewness(skewness float64) string {
+	switch {
+	case math.IsNaN(skewness):
+		return "—"
+	case math.Abs(skewness) < symmetricSkewness:
+		return "почти симметрично"
+	case skewness > 0:
+		return "длинный хвост больших значений"
+	}
+	return "длинный хвост малых значений"
+}
+
+func describeKurtosis(kurtosis float64) string {
+	switch {
+	case math.IsNaN(kurtosis):
+		return "—"
+	case kurtosis > heavyTailKurtosis:
+		return "тяжелые хвосты"
+	case kurtosis > 1:
+		return "хвосты тяжелее, чем у нормального распределения"
+	case kurtosis < -1:
+		return "легкие хвосты, значения сосредоточены в диапазоне"
+	}
+	return "хвосты как у нормального распределения"
+}
+
+// formatDistributionShape — подробный разбор формы распределения колонки
+func formatDistributionShape(tableName models.ClickhouseTableName, column string, shape *distributionShape) string {
+	m := shape.Moments
+	var result strings.Builder
+	result.WriteString(fmt.Sprintf("📐 Форма распределения %s (выборка %d значений):\n", columnLabel(tableName, column), m.N))
+	result.WriteString(fmt.Sprintf("• Асимметрия: %.2f — %s\n", m.Skewness, describeSkewness(m.Skewness)))
+	result.WriteString(fmt.Sprintf("• Эксцесс: %.2f — %s\n", m.Kurtosis, describeKurtosis(m.Kurtosis)))
+	verdict := "нормальность не отвергается"
+	if !m.IsNormal() {
+		verdict = "распределение не нормальное"
+	}
+	result.WriteString(fmt.Sprintf("• Тест Жарка–Бера: JB = %.1f, %s — %s\n", m.JarqueBera, formatPValue(m.PValue), verdict))
+
+	if len(shape.Fits) > 0 {
+		result.WriteString("\nПодходящие распределения (статистика Колмогорова–Смирнова, меньше — лучше):\n")
+		for i, fit := range shape.Fits {
+			result.WriteString(fmt.Sprintf("%d. %s (%s): KS %.3f (%s), AIC %s\n",
+				i+1, fit.Distribution.Name(), fit.Distribution.Params(), fit.KS, formatPValue(fit.PValue), formatAIC(fit.AIC)))
+		}
+	}
+	if m.HeavyTailed() {
+		result.WriteString("\n⚠️ Тяжелые хвосты: экстремальные значения встречаются намного чаще, чем у нормального распределения. " +
+			"Среднее и стандартное отклонение ненадежны, смотрите на медиану и квантили\n")
+	}
+	return result.String()
+}
+
+func formatAIC(aic float64) string {
+	if math.IsInf(aic, 1) {
+		return "∞"
+	}
+	return fmt.Sprintf("%.1f", aic)
+}
+
+// formatDistributionShapes — раздел отчета: лучшее распределение и форма каждой числовой колонки
+func formatDistributionShapes(tableName models.ClickhouseTableName, columns []string, shapes map[string]*distributionShape) string {
+	var result strings.Builder
+	for _, column := range columns {
+		shape := shapes[column]
+		if shape == nil || shape.Best() == nil {
+			continue
+		}
+		m := shape.Moments
+		line := fmt.Sprintf("• %s: %s, асимметрия %.2f, эксцесс %.2f", columnLabel(tableName, column),
+			shape.Best().Distribution.Name(), m.Skewness, m.Kurtosis)
+		if m.HeavyTailed() {
+			line += " ⚠️ тяжелые хвосты"
+		}
+		result.WriteString(line + fmt.Sprintf(" /graph_%s\n", column))
+	}
+	if result.Len() == 0 {
+		return ""
+	}
+	return "📐 Форма распределений числовых колонок (лучше всего подходящее распределение):\n" + result.String()
+}
+
+// computeDistributionShapes подбирает распределения для тех же числовых колонок, что и корреляции
+func computeDistributionShapes(db *gorm.DB, tableName models.ClickhouseTableName, columns []models.ColumnInfo) ([]string, map[string]*distributionShape, error) {
+	numeric := correlationColumns(columns)
+	shapes := map[string]*distributionShape{}
+	for _, column := range numeric {
+		shape, err := computeDistributionShape(db, tableName, column)
+		if err != nil {
+			return nil, nil, err
+		}
+		shapes[column] = shape
+	}
+	return numeric, shapes, nil
+}
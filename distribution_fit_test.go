@@ -0,0 +1,161 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/pivolan/stats_analyzer/domain/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func distributionSample(n int, generate func(r *rand.Rand) float64) []float64 {
+	r := rand.New(rand.NewSource(42))
+	values := make([]float64, n)
+	for i := range values {
+		values[i] = generate(r)
+	}
+	return values
+}
+
+func TestFitDistributions(t *testing.T) {
+	testCases := []struct {
+		name      string
+		values    []float64
+		best      []string
+		normal    bool
+		heavyTail bool
+	}{
+		{"normal", distributionSample(5000, func(r *rand.Rand) float64 { return 100 + 15*r.NormFloat64() }),
+			[]string{"нормальное"}, true, false},
+		{"lognormal", distributionSample(5000, func(r *rand.Rand) float64 { return math.Exp(3 + r.NormFloat64()) }),
+			[]string{"логнормальное"}, false, true},
+		{"exponential", distributionSample(5000, func(r *rand.Rand) float64 { return r.ExpFloat64() / 0.2 }),
+			[]string{"экспоненциальное", "гамма"}, false, false},
+		{"uniform", distributionSample(5000, func(r *rand.Rand) float64 { return 10 + 5*r.Float64() }),
+			[]string{"равномерное"}, false, false},
+		{"pareto", distributionSample(5000, func(r *rand.Rand) float64 { return 2 / math.Pow(1-r.Float64(), 1/1.5) }),
+			[]string{"Парето (степенное)"}, false, true},
+	}
+	for _, tc := range testCases {
+		shape := analyzeDistribution(tc.values)
+		if assert.NotNil(t, shape.Best(), tc.name) {
+			assert.Contains(t, tc.best, shape.Best().Distribution.Name(), tc.name)
+		}
+		assert.Equal(t, tc.normal, shape.Moments.IsNormal(), tc.name)
+		assert.Equal(t, tc.heavyTail, shape.Moments.HeavyTailed(), tc.name)
+		for i := 1; i < len(shape.Fits); i++ {
+			assert.LessOrEqual(t, shape.Fits[i-1].KS, shape.Fits[i].KS, tc.name)
+		}
+	}
+}
+
+func TestFitCandidates(t *testing.T) {
+	names := func(values []float64) []string {
+		result := []string{}
+		for _, d := range fitCandidates(values, computeMoments(values)) {
+			result = append(result, d.Name())
+		}
+		return result
+	}
+	assert.Equal(t, []string{"нормальное", "равномерное"}, names([]float64{-1, 2, 3}))
+	assert.Equal(t, []string{"нормальное", "равномерное", "экспоненциальное"}, names([]float64{0, 2, 3}))
+	assert.Equal(t, []string{"нормальное", "равномерное", "экспоненциальное", "логнормальное", "гамма", "Парето (степенное)"},
+		names([]float64{1, 2, 3}))
+	assert.Nil(t, fitCandidates([]float64{5, 5, 5}, computeMoments([]float64{5, 5, 5})))
+	assert.Nil(t, analyzeDistribution([]float64{5, 5, 5}).Best())
+}
+
+func TestComputeMoments(t *testing.T) {
+	m := computeMoments([]float64{1, 2, 3, 4, 10})
+	assert.InDelta(t, 4, m.Mean, 1e-12)
+	assert.InDelta(t, math.Sqrt(10), m.StdDev, 1e-12)
+	// m3 = 36, m4 = 278.8
+	assert.InDelta(t, 36/math.Pow(10, 1.5), m.Skewness, 1e-12)
+	assert.InDelta(t, 278.8/100-3, m.Kurtosis, 1e-12)
+	assert.InDelta(t, 5.0/6*(m.Skewness*m.Skewness+m.Kurtosis*m.Kurtosis/4), m.JarqueBera, 1e-12)
+	assert.InDelta(t, math.Exp(-m.JarqueBera/2), m.PValue, 1e-9)
+
+	m = computeMoments([]float64{5, 5})
+	assert.True(t, math.IsNaN(m.Skewness))
+	assert.False(t, m.IsNormal())
+}
+
+func TestDistributionFunctions(t *testing.T) {
+	assert.InDelta(t, 0.975, normalCDF(1.959964), 1e-6)
+	assert.InDelta(t, 0.05, kolmogorovSurvival(1.3581/1000, 1000000), 1e-3)
+	assert.Equal(t, 1.0, kolmogorovSurvival(0, 100))
+
+	distributions := []fittedDistribution{
+		normalDistribution{Mu: 1, Sigma: 2},
+		lognormalDistribution{Mu: 0.5, Sigma: 0.8},
+		exponentialDistribution{Lambda: 0.5},
+		gammaDistribution{K: 2.5, Theta: 1.5},
+		paretoDistribution{Xm: 1, Alpha: 2},
+		uniformDistribution{A: -1, B: 3},
+	}
+	// Плотность — производная функции распределения
+	for _, d := range distributions {
+		for _, x := range []float64{0.5, 1.5, 2.5} {
+			derivative := (d.CDF(x+1e-6) - d.CDF(x-1e-6)) / 2e-6
+			assert.InDelta(t, d.PDF(x), derivative, 1e-5, d.Name())
+		}
+	}
+	assert.Equal(t, 0.0, paretoDistribution{Xm: 1, Alpha: 2}.PDF(0.5))
+	assert.True(t, math.IsInf(akaike([]float64{-1, 1}, exponentialDistribution{Lambda: 1}), 1))
+
+	fit := distributionFit{Distribution: uniformDistribution{A: 0, B: 4}}
+	x, y := fit.FittedCurve(0, 4, 5)
+	assert.Equal(t, []float64{0, 1, 2, 3, 4}, x)
+	assert.Equal(t, []float64{0.25, 0.25, 0.25, 0.25, 0.25}, y)
+}
+
+func TestFormatDistributionShape(t *testing.T) {
+	table := models.ClickhouseTableName("shape_table")
+	setColumnMeta(table, map[string]models.ColumnMeta{"0001_amount": {Label: "Сумма"}})
+	defer deleteColumnMeta(table)
+
+	shape := &distributionShape{
+		Moments: sampleMoments{N: 1000, Skewness: 2.5, Kurtosis: 9.1, JarqueBera: 4500, PValue: 0},
+		Fits: []distributionFit{
+			{Distribution: lognormalDistribution{Mu: 3, Sigma: 1}, KS: 0.012, PValue: 0.2, AIC: 8123.25},
+			{Distribution: exponentialDistribution{Lambda: 0.05}, KS: 0.15, PValue: 0, AIC: math.Inf(1)},
+		},
+	}
+	assert.Equal(t, "📐 Форма распределения Сумма (выборка 1000 значений):\n"+
+		"• Асимметрия: 2.50 — длинный хвост больших значений\n"+
+		"• Эксцесс: 9.10 — тяжелые хвосты\n"+
+		"• Тест Жарка–Бера: JB = 4500.0, p < 0.001 — распределение не нормальное\n"+
+		"\nПодходящие распределения (статистика Колмогорова–Смирнова, меньше — лучше):\n"+
+		"1. логнормальное (μ=3, σ=1): KS 0.012 (p = 0.200), AIC 8123.2\n"+
+		"2. экспоненциальное (λ=0.05): KS 0.150 (p < 0.001), AIC ∞\n"+
+		"\n⚠️ Тяжелые хвосты: экстремальные значения встречаются намного чаще, чем у нормального распределения. "+
+		"Среднее и стандартное отклонение ненадежны, смотрите на медиану и квантили\n",
+		formatDistributionShape(table, "0001_amount", shape))
+
+	assert.Equal(t, "📐 Форма распределений числовых колонок (лучше всего подходящее распределение):\n"+
+		"• Сумма: логнормальное, асимметрия 2.50, эксцесс 9.10 ⚠️ тяжелые хвосты /graph_0001_amount\n",
+		formatDistributionShapes(table, []string{"0001_amount", "0002_empty"}, map[string]*distributionShape{"0001_amount": shape, "0002_empty": nil}))
+	assert.Equal(t, "", formatDistributionShapes(table, []string{"0002_empty"}, map[string]*distributionShape{}))
+}
+
+func TestGenerateSqlForDistributionSample(t *testing.T) {
+	assert.Equal(t, "SELECT groupArraySample(10000)(toFloat64(0001_amount)) AS sample FROM orders WHERE isFinite(toFloat64(0001_amount))",
+		generateSqlForDistributionSample("0001_amount", "orders", distributionSampleRows))
+}
+
+func TestDescribeKurtosis(t *testing.T) {
+	testCases := []struct {
+		kurtosis float64
+		expected string
+	}{
+		{math.NaN(), "—"},
+		{heavyTailKurtosis + 1, "тяжелые хвосты"},
+		{1.5, "хвосты тяжелее, чем у нормального распределения"},
+		{0, "хвосты как у нормального распределения"},
+		{-1.2, "легкие хвосты, значения сосредоточены в диапазоне"},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.expected, describeKurtosis(tc.kurtosis))
+	}
+}
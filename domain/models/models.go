@@ -9,8 +9,10 @@ type HistogramData struct {
 	Count      int     `db:"count"`
 }
 type ColumnInfo struct {
-	Name string
-	Type string //Date DateTime64 Int64 Float64
+	Name        string
+	Type        string //Date DateTime64 Int64 Float64
+	Comment     string // Комментарий колонки, например срезанная при импорте единица измерения
+	DefaultType string // ALIAS у вычисляемых колонок, которых нет в исходном файле
 }
 type QueryResult struct {
 	Sql          string
@@ -19,6 +21,7 @@ type QueryResult struct {
 
 type HeaderAnalysis struct {
 	Headers        []string // Итоговые заголовки
+	Labels         []string // Исходные названия колонок для показа пользователю, пусто если шапки нет
 	FirstRowIsData bool     // Является ли первая строка данными
 	FirstDataRow   []string // Первая строка с данными
 }
@@ -70,3 +73,27 @@ type DateCount struct {
 	Count    int64
 	SumValue float64
 }
+
+// ImportedTable — таблица, созданная из одной части загруженного файла (лист книги, таблица базы и т.д.)
+type ImportedTable struct {
+	Name   ClickhouseTableName
+	Source string // Название источника внутри файла, например имя листа
+	Meta   TableMeta
+}
+
+// TableMeta — сведения об исходном файле таблицы, которые показываются вместе со статистикой
+type TableMeta struct {
+	Encoding     string   // Исходная кодировка текстового файла
+	SourcePath   string   // Загруженный файл, из которого таблицу можно пересобрать
+	SQLiteTable  string   // Таблица базы SQLite, из которой загружена таблица
+	SkippedFiles []string // Файлы архива, которые не удалось загрузить, с причиной
+	// Колонки базы SQLite, значения которых не подошли под объявленный тип и тип которых определен по значениям
+	InferredColumns []string
+}
+
+// ColumnMeta — сведения о колонке, которых нет в ее SQL имени
+type ColumnMeta struct {
+	Label     string // Исходное название из файла, например "Сумма заказа"
+	Position  int    // Номер колонки в файле, начиная с 1
+	Semantics string // Смысл значений: число, деньги, дата, категория и т.д.
+}
@@ -0,0 +1,110 @@
+// file_format.go
+package main
+
+import (
+	"archive/zip"
+	"path/filepath"
+	"strings"
+
+	"github.com/pivolan/stats_analyzer/domain/models"
+)
+
+const (
+	FORMAT_CSV     = "csv"
+	FORMAT_JSON    = "json"
+	FORMAT_XLSX    = "xlsx"
+	FORMAT_PARQUET = "parquet"
+	FORMAT_ARROW   = "arrow"
+	FORMAT_SQLITE  = "sqlite"
+	FORMAT_LOG     = "log"
+)
+
+// importOptions — настройки импорта, выбранные пользователем
+type importOptions struct {
+	AllArchiveMembers bool                    // Импортировать все файлы архива, а не только самый большой
+	Progress          *importProgress         // Куда сообщать о ходе импорта, может быть nil
+	Schemas           map[string]columnSchema // Типы колонок, исправленные пользователем, по отпечатку заголовков
+	Append            *appendTarget           // Таблица, в которую дописывается загрузка, nil — создать новую
+	SQLiteTables      []string                // Выбранные таблицы базы SQLite, nil — спросить, если таблиц несколько
+}
+
+// detectFileFormat определяет формат загруженного файла по расширению и содержимому
+func detectFileFormat(filePath string) string {
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".xlsx", ".xlsm":
+		return FORMAT_XLSX
+	case ".parquet":
+		return FORMAT_PARQUET
+	case ".arrow", ".feather", ".ipc":
+		return FORMAT_ARROW
+	}
+	if isSQLiteFile(filePath) {
+		return FORMAT_SQLITE
+	}
+	if isParquetFile(filePath) {
+		return FORMAT_PARQUET
+	}
+	if isArrowFile(filePath) {
+		return FORMAT_ARROW
+	}
+	if isXLSXFile(filePath) {
+		return FORMAT_XLSX
+	}
+	if isJSONFile(filePath) {
+		return FORMAT_JSON
+	}
+	// Логи приходят с любым расширением: .log, .txt, access.log.1
+	if lines, err := sampleLogLines(filePath); err == nil {
+		if isJSONLines(lines) {
+			return FORMAT_JSON
+		}
+		if matchLogFormat(lines) != nil {
+			return FORMAT_LOG
+		}
+	}
+	return FORMAT_CSV
+}
+
+// isXLSXFile проверяет, что файл — zip контейнер с книгой Excel внутри
+func isXLSXFile(filePath string) bool {
+	r, err := zip.OpenReader(filePath)
+	if err != nil {
+		return false
+	}
+	defer r.Close()
+	for _, f := range r.File {
+		if f.Name == "xl/workbook.xml" {
+			return true
+		}
+	}
+	return false
+}
+
+// importFileIntoClickHouse выбирает импортер по формату файла, один файл может дать несколько таблиц
+func importFileIntoClickHouse(filePath string, db DBInterface, opts importOptions) ([]models.ImportedTable, error) {
+	var tableName models.ClickhouseTableName
+	var meta models.TableMeta
+	var err error
+	switch detectFileFormat(filePath) {
+	case FORMAT_XLSX:
+		return importXLSXIntoClickHouse(filePath, db, opts)
+	case FORMAT_SQLITE:
+		return importSQLiteIntoClickHouse(filePath, db, opts)
+	case FORMAT_PARQUET:
+		tableName, err = importParquetIntoClickHouse(filePath, db, opts)
+	case FORMAT_ARROW:
+		tableName, err = importArrowIntoClickHouse(filePath, db, opts)
+	case FORMAT_JSON:
+		tableName, err = importJSONIntoClickHouse(filePath, db, opts)
+	case FORMAT_LOG:
+		meta.Encoding = detectFileEncoding(filePath).Name
+		tableName, err = importLogIntoClickHouse(filePath, db, opts)
+	default:
+		meta.Encoding = detectFileEncoding(filePath).Name
+		tableName, err = importDataIntoClickHouse(filePath, db, opts)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return []models.ImportedTable{{Name: tableName, Source: filepath.Base(filePath), Meta: meta}}, nil
+}
@@ -0,0 +1,168 @@
+// import_progress.go
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// importProgress — ход загрузки файла: этап, прочитанные байты и строки.
+// Импорт обновляет его из своей горутины, бот читает снимки из другой; методы безопасны для nil
+type importProgress struct {
+	mu         sync.Mutex
+	stage      string
+	totalBytes int64
+	bytesRead  func() int64
+	started    time.Time
+	rows       int64
+}
+
+// progressSnapshot — состояние импорта на момент показа пользователю
+type progressSnapshot struct {
+	Stage      string
+	Bytes      int64
+	TotalBytes int64
+	Rows       int64
+	Elapsed    time.Duration
+}
+
+func newImportProgress() *importProgress {
+	return &importProgress{started: time.Now()}
+}
+
+// SetStage задает название этапа, например распаковку архива или имя файла из архива
+func (p *importProgress) SetStage(stage string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stage = stage
+}
+
+// Track начинает отсчет по новому файлу: размер и функция, возвращающая прочитанные байты.
+// Если байты посчитать нельзя (книга Excel, таблица SQLite), передается 0 и nil: считаются только строки
+func (p *importProgress) Track(totalBytes int64, bytesRead func() int64) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.totalBytes, p.bytesRead, p.started = totalBytes, bytesRead, time.Now()
+	atomic.StoreInt64(&p.rows, 0)
+}
+
+// CountRows оборачивает источник строк, чтобы считать прочитанные строки
+func (p *importProgress) CountRows(r rowReader) rowReader {
+	if p == nil {
+		return r
+	}
+	return &countingRowReader{reader: r, rows: &p.rows}
+}
+
+func (p *importProgress) Snapshot() progressSnapshot {
+	if p == nil {
+		return progressSnapshot{}
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	snapshot := progressSnapshot{
+		Stage:      p.stage,
+		TotalBytes: p.totalBytes,
+		Rows:       atomic.LoadInt64(&p.rows),
+		Elapsed:    time.Since(p.started),
+	}
+	if p.bytesRead != nil {
+		snapshot.Bytes = p.bytesRead()
+	}
+	return snapshot
+}
+
+func (s progressSnapshot) Percent() float64 {
+	if s.TotalBytes <= 0 {
+		return 0
+	}
+	return minFloat(100, float64(s.Bytes)*100/float64(s.TotalBytes))
+}
+
+func (s progressSnapshot) RowsPerSecond() float64 {
+	if s.Elapsed <= 0 {
+		return 0
+	}
+	return float64(s.Rows) / s.Elapsed.Seconds()
+}
+
+// ETA оценивает оставшееся время по скорости чтения файла; 0, если оценить пока нельзя
+func (s progressSnapshot) ETA() time.Duration {
+	if s.Bytes <= 0 || s.TotalBytes <= s.Bytes {
+		return 0
+	}
+	return time.Duration(float64(s.Elapsed) * float64(s.TotalBytes-s.Bytes) / float64(s.Bytes))
+}
+
+// formatProgress формирует текст сообщения о ходе импорта
+func formatProgress(s progressSnapshot) string {
+	var result strings.Builder
+	result.WriteString("⏳ Импорт файла")
+	if s.Stage != "" {
+		result.WriteString(": " + s.Stage)
+	}
+	result.WriteString("\n")
+	if s.TotalBytes > 0 {
+		result.WriteString(fmt.Sprintf("%.0f%% (%.1f из %.1f MB)\n", s.Percent(), float64(s.Bytes)/1024/1024, float64(s.TotalBytes)/1024/1024))
+	}
+	if s.Rows > 0 {
+		result.WriteString(fmt.Sprintf("Строк: %d (%.0f строк/с)\n", s.Rows, s.RowsPerSecond()))
+	}
+	if eta := s.ETA(); eta > 0 {
+		result.WriteString(fmt.Sprintf("Осталось примерно: %s\n", eta.Round(time.Second)))
+	}
+	return strings.TrimSpace(result.String())
+}
+
+func minFloat(a, b float64) float64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+type countingRowReader struct {
+	reader rowReader
+	rows   *int64
+}
+
+func (c *countingRowReader) Read() ([]string, error) {
+	row, err := c.reader.Read()
+	if err == nil {
+		atomic.AddInt64(c.rows, 1)
+	}
+	return row, err
+}
+
+func (c *countingRowReader) Position() (int64, string) {
+	if position, ok := c.reader.(rowPosition); ok {
+		return position.Position()
+	}
+	return 0, ""
+}
+
+// countingReader считает байты, прочитанные из файла до перекодировки
+type countingReader struct {
+	reader io.Reader
+	count  int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.reader.Read(p)
+	atomic.AddInt64(&c.count, int64(n))
+	return n, err
+}
+
+func (c *countingReader) BytesRead() int64 {
+	return atomic.LoadInt64(&c.count)
+}
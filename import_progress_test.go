@@ -0,0 +1,86 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/gorm"
+)
+
+func TestFormatProgress(t *testing.T) {
+	snapshot := progressSnapshot{
+		Stage:      "sales.csv",
+		Bytes:      25 * 1024 * 1024,
+		TotalBytes: 100 * 1024 * 1024,
+		Rows:       200000,
+		Elapsed:    10 * time.Second,
+	}
+	assert.Equal(t, 25.0, snapshot.Percent())
+	assert.Equal(t, 20000.0, snapshot.RowsPerSecond())
+	assert.Equal(t, 30*time.Second, snapshot.ETA())
+	assert.Equal(t, "⏳ Импорт файла: sales.csv\n25% (25.0 из 100.0 MB)\nСтрок: 200000 (20000 строк/с)\nОсталось примерно: 30s", formatProgress(snapshot))
+
+	assert.Equal(t, "⏳ Импорт файла: распаковка архива", formatProgress(progressSnapshot{Stage: "распаковка архива"}))
+}
+
+func TestImportDataReportsProgress(t *testing.T) {
+	content := "name,amount\napple,1\npear,2\nplum,3\n"
+	filePath := filepath.Join(t.TempDir(), "data.csv")
+	assert.NoError(t, os.WriteFile(filePath, []byte(content), 0644))
+
+	mockDB := NewMockDB()
+	mockDB.On("Exec", mock.Anything, mock.Anything).Return(&gorm.DB{})
+	progress := newImportProgress()
+	_, err := importDataIntoClickHouse(filePath, mockDB, importOptions{Progress: progress})
+	assert.NoError(t, err)
+
+	snapshot := progress.Snapshot()
+	assert.Equal(t, int64(3), snapshot.Rows)
+	assert.Equal(t, int64(len(content)), snapshot.Bytes)
+	assert.Equal(t, int64(len(content)), snapshot.TotalBytes)
+	assert.Equal(t, 100.0, snapshot.Percent())
+}
+
+func TestImportFormatsReportProgress(t *testing.T) {
+	dir := t.TempDir()
+	jsonContent := "{\"name\":\"apple\",\"amount\":1}\n{\"name\":\"pear\",\"amount\":2}\n"
+	jsonPath := filepath.Join(dir, "data.json")
+	assert.NoError(t, os.WriteFile(jsonPath, []byte(jsonContent), 0644))
+	day1 := "name,amount\napple,1\npear,2\n"
+	day2 := "name,amount\nplum,3\n"
+	day1Path, day2Path := filepath.Join(dir, "day1.csv"), filepath.Join(dir, "day2.csv")
+	assert.NoError(t, os.WriteFile(day1Path, []byte(day1), 0644))
+	assert.NoError(t, os.WriteFile(day2Path, []byte(day2), 0644))
+
+	mockDB := NewMockDB()
+	mockDB.On("Exec", mock.Anything, mock.Anything).Return(&gorm.DB{})
+	testCases := []struct {
+		name          string
+		run           func(opts importOptions) error
+		expectedRows  int64
+		expectedBytes int64
+	}{
+		{"json", func(opts importOptions) error {
+			_, err := importFileIntoClickHouse(jsonPath, mockDB, opts)
+			return err
+		}, 2, int64(len(jsonContent))},
+		{"merged archive members", func(opts importOptions) error {
+			_, err := importArchiveMembers([]string{day1Path, day2Path}, mockDB, opts)
+			return err
+		}, 3, int64(len(day1) + len(day2))},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			progress := newImportProgress()
+			assert.NoError(t, tc.run(importOptions{Progress: progress}))
+			snapshot := progress.Snapshot()
+			assert.Equal(t, tc.expectedRows, snapshot.Rows)
+			assert.Equal(t, tc.expectedBytes, snapshot.Bytes)
+			assert.Equal(t, tc.expectedBytes, snapshot.TotalBytes)
+		})
+	}
+}
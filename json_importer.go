@@ -0,0 +1,244 @@
+// json_importer.go
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pivolan/stats_analyzer/domain/models"
+)
+
+// jsonRecordReader читает записи из NDJSON (по объекту на строку) или из JSON массива верхнего уровня
+type jsonRecordReader struct {
+	file    *os.File
+	counter *countingReader
+	decoder *json.Decoder
+	isArray bool
+}
+
+func newJSONRecordReader(filePath string) (*jsonRecordReader, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	counter := &countingReader{reader: f}
+	br := bufio.NewReader(counter)
+	first, err := firstNonSpaceByte(br)
+	if err != nil {
+		f.Close()
+		if err == io.EOF {
+			return nil, fmt.Errorf("empty JSON file")
+		}
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(br)
+	decoder.UseNumber()
+	r := &jsonRecordReader{file: f, counter: counter, decoder: decoder, isArray: first == '['}
+	if r.isArray {
+		// Пропускаем открывающую скобку массива
+		if _, err := decoder.Token(); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// Next возвращает следующую запись, уже развернутую в плоский вид
+func (r *jsonRecordReader) Next() (map[string]string, error) {
+	for {
+		if r.isArray && !r.decoder.More() {
+			return nil, io.EOF
+		}
+		var value interface{}
+		if err := r.decoder.Decode(&value); err != nil {
+			return nil, err
+		}
+		record := map[string]string{}
+		switch v := value.(type) {
+		case map[string]interface{}:
+			flattenJSON("", v, record)
+		case nil:
+			continue
+		default:
+			// Массив скаляров — каждое значение становится строкой с одной колонкой
+			flattenJSONValue("value", v, record)
+		}
+		return record, nil
+	}
+}
+
+// BytesRead возвращает, сколько байт файла уже прочитано, для показа хода загрузки
+func (r *jsonRecordReader) BytesRead() int64 {
+	return r.counter.BytesRead()
+}
+
+func (r *jsonRecordReader) Close() error {
+	return r.file.Close()
+}
+
+// jsonRowReader превращает записи JSON в строки по фиксированному списку ключей
+type jsonRowReader struct {
+	records *jsonRecordReader
+	keys    []string
+}
+
+func (r *jsonRowReader) Read() ([]string, error) {
+	record, err := r.records.Next()
+	if err != nil {
+		return nil, err
+	}
+	row := make([]string, len(r.keys))
+	for i, key := range r.keys {
+		row[i] = record[key]
+	}
+	return row, nil
+}
+
+func firstNonSpaceByte(r *bufio.Reader) (byte, error) {
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		// Пропускаем пробелы и UTF-8 BOM
+		if b == ' ' || b == '\n' || b == '\r' || b == '\t' || b == 0xEF || b == 0xBB || b == 0xBF {
+			continue
+		}
+		return b, r.UnreadByte()
+	}
+}
+
+// flattenJSON разворачивает вложенные объекты в колонки вида parent.child
+func flattenJSON(prefix string, object map[string]interface{}, result map[string]string) {
+	for key, value := range object {
+		name := key
+		if prefix != "" {
+			name = prefix + "." + key
+		}
+		flattenJSONValue(name, value, result)
+	}
+}
+
+func flattenJSONValue(name string, value interface{}, result map[string]string) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if len(v) == 0 {
+			result[name] = ""
+			return
+		}
+		flattenJSON(name, v, result)
+	case []interface{}:
+		// Массивы сохраняем как JSON строку, чтобы не плодить колонки
+		b, _ := json.Marshal(v)
+		result[name] = string(b)
+	case nil:
+		result[name] = ""
+	case bool:
+		if v {
+			result[name] = "true"
+		} else {
+			result[name] = "false"
+		}
+	case json.Number:
+		result[name] = v.String()
+	case string:
+		result[name] = v
+	default:
+		result[name] = fmt.Sprint(v)
+	}
+}
+
+// collectJSONKeys собирает имена колонок по первым 50000 записям в порядке появления
+func collectJSONKeys(filePath string) ([]string, error) {
+	records, err := newJSONRecordReader(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer records.Close()
+
+	keys := []string{}
+	seen := map[string]bool{}
+	for i := 0; i < 50000; i++ {
+		record, err := records.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse JSON record %d: %v", i+1, err)
+		}
+		// Внутри одной записи порядок ключей в map случайный, сортируем новые ключи
+		newKeys := []string{}
+		for key := range record {
+			if !seen[key] {
+				seen[key] = true
+				newKeys = append(newKeys, key)
+			}
+		}
+		sort.Strings(newKeys)
+		keys = append(keys, newKeys...)
+	}
+	return keys, nil
+}
+
+func importJSONIntoClickHouse(filePath string, db DBInterface, opts importOptions) (models.ClickhouseTableName, error) {
+	keys, err := collectJSONKeys(filePath)
+	if err != nil {
+		return "", err
+	}
+	if len(keys) == 0 {
+		return "", fmt.Errorf("empty JSON file")
+	}
+
+	headers := make([]string, len(keys))
+	for i, key := range keys {
+		headers[i] = cleanHeaderName(key, i)
+	}
+	headers = addNumberPrefix(ValidateHeaders(headers))
+
+	// Первый проход — определение типов
+	records, err := newJSONRecordReader(filePath)
+	if err != nil {
+		return "", err
+	}
+	types, nullables, formats := inferColumnTypes(&jsonRowReader{records: records, keys: keys}, len(keys))
+	records.Close()
+
+	// Второй проход — загрузка данных
+	records, err = newJSONRecordReader(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer records.Close()
+	if info, err := records.file.Stat(); err == nil {
+		opts.Progress.Track(info.Size(), records.BytesRead)
+	}
+	return importRows(db, filePath, headers, keys, types, nullables, formats, opts.Progress.CountRows(&jsonRowReader{records: records, keys: keys}), opts)
+}
+
+// isJSONFile определяет JSON по расширению или по первому значимому символу
+func isJSONFile(filePath string) bool {
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".json", ".ndjson", ".jsonl":
+		return true
+	case ".csv", ".tsv", ".txt":
+		return false
+	}
+	f, err := os.Open(filePath)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	b, err := firstNonSpaceByte(bufio.NewReader(f))
+	if err != nil {
+		return false
+	}
+	return b == '{' || b == '['
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/gorm"
+)
+
+func TestFlattenJSON(t *testing.T) {
+	record := map[string]interface{}{
+		"id":   "1",
+		"user": map[string]interface{}{"name": "John", "address": map[string]interface{}{"city": "Moscow"}},
+		"tags": []interface{}{"a", "b"},
+		"note": nil,
+	}
+	result := map[string]string{}
+	flattenJSON("", record, result)
+
+	assert.Equal(t, map[string]string{
+		"id":                "1",
+		"user.name":         "John",
+		"user.address.city": "Moscow",
+		"tags":              `["a","b"]`,
+		"note":              "",
+	}, result)
+}
+
+func TestImportJSONIntoClickHouse(t *testing.T) {
+	original := getMD5String
+	getMD5String = func(input string) string {
+		return "123456"
+	}
+	defer func() {
+		getMD5String = original
+	}()
+
+	testCases := []struct {
+		name            string
+		content         string
+		expectedCreate  []string
+		expectedLastSQL string
+	}{
+		{
+			name: "NDJSON",
+			content: `{"name":"John","age":30,"created":"2024-01-01","address":{"city":"Moscow"}}
+{"name":"Jane","age":25,"created":"2024-01-02","address":{"city":"Kazan"}}
+`,
+			expectedCreate: []string{
+				"0001_address_city String",
+				"0002_age Int64",
+				"0003_created Date",
+				"0004_name String",
+			},
+			expectedLastSQL: "INSERT INTO 0001_address_city_0002_age_0003_created_123456 SETTINGS max_query_size = 5048576, max_insert_block_size = 5000000 FORMAT CSV \n1,Moscow,30,2024-01-01,John\n2,Kazan,25,2024-01-02,Jane\n",
+		},
+		{
+			name:    "JSON array with missing keys",
+			content: `[{"price": 1.5, "sku": "A1"}, {"price": 2, "sku": "B2", "extra": null}]`,
+			expectedCreate: []string{
+				"0001_price Float64",
+				"0002_sku String",
+				"0003_extra String  NULL",
+			},
+			expectedLastSQL: "INSERT INTO 0001_price_0002_sku_0003_extra_123456 SETTINGS max_query_size = 5048576, max_insert_block_size = 5000000 FORMAT CSV \n1,1.5,A1,\n2,2,B2,\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tmpFile, err := os.CreateTemp("", "test_*.json")
+			assert.NoError(t, err)
+			defer os.Remove(tmpFile.Name())
+			_, err = tmpFile.WriteString(tc.content)
+			assert.NoError(t, err)
+			tmpFile.Close()
+
+			mockDB := NewMockDB()
+			mockDB.On("Exec", mock.Anything, mock.Anything).Return(&gorm.DB{})
+
+			assert.True(t, isJSONFile(tmpFile.Name()))
+			_, err = importFileIntoClickHouse(tmpFile.Name(), mockDB, importOptions{})
+			assert.NoError(t, err)
+
+			createSQL := ""
+			for _, call := range mockDB.Calls {
+				if query := call.Arguments.String(0); strings.HasPrefix(query, "CREATE TABLE") {
+					createSQL = query
+				}
+			}
+			for _, field := range tc.expectedCreate {
+				assert.Contains(t, createSQL, field)
+			}
+			assert.Equal(t, tc.expectedLastSQL, mockDB.lastQuery)
+		})
+	}
+}
@@ -0,0 +1,329 @@
+// log_importer.go
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pivolan/stats_analyzer/domain/models"
+)
+
+// Логи веб-серверов и syslog разбираются на колонки, чтобы по ним работал анализ дат, чисел и категорий,
+// а не получалась одна текстовая колонка. Свои форматы задаются в конфиге строкой в записи nginx log_format
+
+const (
+	logSampleLines     = 200     // сколько непустых строк из начала файла смотрим при определении формата
+	logMinMatchPercent = 80      // доля строк, которые должен разобрать формат, чтобы файл считался логом
+	maxLogLineSize     = 1 << 20 // длиннее строки в логах не бывают, а Scanner нужен предел буфера
+	clfTimeLayout      = "02/Jan/2006:15:04:05 -0700"
+)
+
+// logFormat — формат строк лога: регулярное выражение с именованными группами и колонки таблицы.
+// Колонки совпадают с группами, кроме вычисляемых в convert
+type logFormat struct {
+	Name    string
+	Pattern *regexp.Regexp
+	Columns []string
+	convert func(values map[string]string)
+}
+
+// Запрос "GET /path HTTP/1.1" разбирается на части; у битых запросов (например "-" при таймауте) части пустые
+const logRequestPattern = `"(?:(?P<method>[A-Z]+) (?P<path>\S+)(?: (?P<protocol>[^"]*))?|[^"]*)"`
+
+var (
+	combinedLogFormat = &logFormat{
+		Name: "combined access log",
+		Pattern: regexp.MustCompile(`^(?P<ip>\S+) \S+ (?P<user>\S+) \[(?P<timestamp>[^\]]+)\] ` + logRequestPattern +
+			` (?P<status>\d{3}) (?P<bytes>\d+|-) "(?P<referer>[^"]*)" "(?P<user_agent>[^"]*)"`),
+		Columns: []string{"timestamp", "ip", "user", "method", "path", "protocol", "status", "bytes", "referer", "user_agent"},
+	}
+	commonLogFormat = &logFormat{
+		Name:    "common access log",
+		Pattern: regexp.MustCompile(`^(?P<ip>\S+) \S+ (?P<user>\S+) \[(?P<timestamp>[^\]]+)\] ` + logRequestPattern + ` (?P<status>\d{3}) (?P<bytes>\d+|-)$`),
+		Columns: []string{"timestamp", "ip", "user", "method", "path", "protocol", "status", "bytes"},
+	}
+	syslogFormat = &logFormat{
+		Name: "RFC 5424 syslog",
+		Pattern: regexp.MustCompile(`^<(?P<priority>\d{1,3})>1 (?P<timestamp>\S+) (?P<hostname>\S+) (?P<app_name>\S+) (?P<proc_id>\S+) (?P<msg_id>\S+) ` +
+			`(?P<structured_data>-|(?:\[(?:[^\]\\]|\\.)*\])+)(?: (?P<message>.*))?$`),
+		Columns: []string{"timestamp", "facility", "severity", "hostname", "app_name", "proc_id", "msg_id", "structured_data", "message"},
+		convert: splitSyslogPriority,
+	}
+)
+
+// logFormats — форматы в порядке проверки; свои форматы из конфига проверяются первыми
+var logFormats = []*logFormat{combinedLogFormat, commonLogFormat, syslogFormat}
+
+var syslogSeverities = []string{"emergency", "alert", "critical", "error", "warning", "notice", "info", "debug"}
+
+// splitSyslogPriority раскладывает PRI на facility и severity: <165> → facility 20, severity notice
+func splitSyslogPriority(values map[string]string) {
+	priority, err := strconv.Atoi(values["priority"])
+	if err != nil {
+		return
+	}
+	values["facility"] = strconv.Itoa(priority / 8)
+	values["severity"] = syslogSeverities[priority%8]
+}
+
+// Переменные nginx log_format и колонки, в которые они попадают
+var logVariableColumns = map[string]string{
+	"remote_addr":     "ip",
+	"remote_user":     "user",
+	"time_local":      "timestamp",
+	"time_iso8601":    "timestamp",
+	"request_method":  "method",
+	"request_uri":     "path",
+	"uri":             "path",
+	"server_protocol": "protocol",
+	"status":          "status",
+	"body_bytes_sent": "bytes",
+	"bytes_sent":      "bytes",
+	"http_referer":    "referer",
+	"http_user_agent": "user_agent",
+}
+
+var logVariablePattern = regexp.MustCompile(`\$([a-zA-Z_][a-zA-Z0-9_]*)`)
+
+// parseLogPattern строит формат по строке в записи nginx log_format:
+// `$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent "$http_user_agent"`.
+// Значение переменной тянется до символа, который следует за ней в шаблоне
+func parseLogPattern(name, pattern string) (*logFormat, error) {
+	format := &logFormat{Name: name}
+	var expr strings.Builder
+	expr.WriteString("^")
+	seen := map[string]bool{}
+	last := 0
+	for _, m := range logVariablePattern.FindAllStringSubmatchIndex(pattern, -1) {
+		expr.WriteString(regexp.QuoteMeta(pattern[last:m[0]]))
+		last = m[1]
+		variable := pattern[m[2]:m[3]]
+		if variable == "request" && strings.HasSuffix(pattern[:m[0]], `"`) && strings.HasPrefix(pattern[m[1]:], `"`) {
+			// Кавычки вокруг $request входят в logRequestPattern
+			s := expr.String()
+			expr.Reset()
+			expr.WriteString(strings.TrimSuffix(s, `"`))
+			expr.WriteString(logRequestPattern)
+			last++
+			format.Columns = append(format.Columns, "method", "path", "protocol")
+			continue
+		}
+		column := variable
+		if mapped, ok := logVariableColumns[variable]; ok && !seen[mapped] {
+			column = mapped
+		}
+		if seen[column] {
+			return nil, fmt.Errorf("log pattern %q: variable $%s is used twice", pattern, variable)
+		}
+		seen[column] = true
+		value := `.*?`
+		switch next := pattern[m[1]:]; {
+		case strings.HasPrefix(next, `"`):
+			value = `[^"]*`
+		case strings.HasPrefix(next, "]"):
+			value = `[^\]]*`
+		case strings.HasPrefix(next, " "):
+			value = `\S*`
+		}
+		expr.WriteString(fmt.Sprintf("(?P<%s>%s)", column, value))
+		format.Columns = append(format.Columns, column)
+	}
+	expr.WriteString(regexp.QuoteMeta(pattern[last:]))
+	expr.WriteString("$")
+	if len(format.Columns) < 2 {
+		return nil, fmt.Errorf("log pattern %q: at least two $variables are required", pattern)
+	}
+	re, err := regexp.Compile(expr.String())
+	if err != nil {
+		return nil, fmt.Errorf("log pattern %q: %v", pattern, err)
+	}
+	format.Pattern = re
+	return format, nil
+}
+
+// registerLogFormats добавляет форматы из конфига, по одному шаблону на строку
+func registerLogFormats(patterns string) error {
+	custom := []*logFormat{}
+	for _, pattern := range strings.Split(patterns, "\n") {
+		if pattern = strings.TrimSpace(pattern); pattern == "" {
+			continue
+		}
+		format, err := parseLogPattern(fmt.Sprintf("custom log format %d", len(custom)+1), pattern)
+		if err != nil {
+			return err
+		}
+		custom = append(custom, format)
+	}
+	logFormats = append(custom, logFormats...)
+	return nil
+}
+
+// Parse разбирает строку лога на значения колонок; false — строка не подходит под формат
+func (f *logFormat) Parse(line string) ([]string, bool) {
+	m := f.Pattern.FindStringSubmatch(line)
+	if m == nil {
+		return nil, false
+	}
+	values := map[string]string{}
+	for i, name := range f.Pattern.SubexpNames() {
+		if name != "" && m[i] != "" {
+			values[name] = m[i]
+		}
+	}
+	if f.convert != nil {
+		f.convert(values)
+	}
+	row := make([]string, len(f.Columns))
+	for i, column := range f.Columns {
+		value := values[column]
+		if value == "-" {
+			// Прочерк в логах означает отсутствующее значение
+			value = ""
+		}
+		if column == "timestamp" {
+			value = normalizeLogTime(value)
+		}
+		row[i] = value
+	}
+	return row, true
+}
+
+// normalizeLogTime переводит время Common Log Format в RFC 3339, которое понимает определение дат
+func normalizeLogTime(value string) string {
+	if t, err := time.Parse(clfTimeLayout, value); err == nil {
+		return t.Format(time.RFC3339)
+	}
+	return value
+}
+
+// sampleLogLines читает непустые строки из начала файла для определения формата
+func sampleLogLines(filePath string) ([]string, error) {
+	f, _, err := openTextFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), maxLogLineSize)
+	var lines []string
+	for len(lines) < logSampleLines && scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			lines = append(lines, strings.TrimPrefix(line, "\uFEFF"))
+		}
+	}
+	return lines, nil
+}
+
+// matchLogFormat выбирает формат, который разбирает больше всего строк выборки, но не меньше logMinMatchPercent
+func matchLogFormat(lines []string) *logFormat {
+	var best *logFormat
+	bestCount := 0
+	for _, format := range logFormats {
+		count := 0
+		for _, line := range lines {
+			if format.Pattern.MatchString(line) {
+				count++
+			}
+		}
+		if count > bestCount {
+			best, bestCount = format, count
+		}
+	}
+	if len(lines) == 0 || bestCount*100 < len(lines)*logMinMatchPercent {
+		return nil
+	}
+	return best
+}
+
+// isJSONLines — лог из JSON объектов по одному на строку, как пишут структурированные логгеры
+func isJSONLines(lines []string) bool {
+	count := 0
+	for _, line := range lines {
+		if strings.HasPrefix(line, "{") && json.Valid([]byte(line)) {
+			count++
+		}
+	}
+	return len(lines) > 0 && count*100 >= len(lines)*logMinMatchPercent
+}
+
+// logRowReader отдает разобранные строки лога; неразобранная строка отдается одним полем
+// и уходит в отклоненные строки с исходным текстом
+type logRowReader struct {
+	scanner *bufio.Scanner
+	format  *logFormat
+	line    int64
+	raw     string
+}
+
+func newLogRowReader(r io.Reader, format *logFormat) *logRowReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLogLineSize)
+	return &logRowReader{scanner: scanner, format: format}
+}
+
+func (r *logRowReader) Read() ([]string, error) {
+	for r.scanner.Scan() {
+		r.line++
+		r.raw = strings.TrimPrefix(r.scanner.Text(), "\uFEFF")
+		if strings.TrimSpace(r.raw) == "" {
+			continue
+		}
+		if row, ok := r.format.Parse(strings.TrimRight(r.raw, "\r")); ok {
+			return row, nil
+		}
+		return []string{r.raw}, nil
+	}
+	if err := r.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+func (r *logRowReader) Position() (int64, string) {
+	return r.line, r.raw
+}
+
+// importLogIntoClickHouse загружает лог веб-сервера или syslog: формат определяется по первым строкам
+func importLogIntoClickHouse(filePath string, db DBInterface, opts importOptions) (models.ClickhouseTableName, error) {
+	lines, err := sampleLogLines(filePath)
+	if err != nil {
+		return "", err
+	}
+	format := matchLogFormat(lines)
+	if format == nil {
+		return "", fmt.Errorf("unknown log format")
+	}
+	log.Println("log format:", format.Name)
+
+	headers := make([]string, len(format.Columns))
+	for i, column := range format.Columns {
+		headers[i] = cleanHeaderName(column, i)
+	}
+	headers = addNumberPrefix(ValidateHeaders(headers))
+
+	// Первый проход — определение типов
+	f, _, err := openTextFile(filePath)
+	if err != nil {
+		return "", err
+	}
+	types, nullables, formats := inferColumnTypes(newLogRowReader(f, format), len(headers))
+	f.Close()
+
+	// Второй проход — загрузка данных
+	f, _, err = openTextFile(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if info, err := f.file.Stat(); err == nil {
+		opts.Progress.Track(info.Size(), f.BytesRead)
+	}
+	return importRows(db, filePath, headers, format.Columns, types, nullables, formats, opts.Progress.CountRows(newLogRowReader(f, format)), opts)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/gorm"
+)
+
+func TestLogFormatParse(t *testing.T) {
+	testCases := []struct {
+		name     string
+		format   *logFormat
+		line     string
+		expected []string
+	}{
+		{
+			"combined",
+			combinedLogFormat,
+			`203.0.113.7 - alice [10/Oct/2024:13:55:36 +0300] "GET /api/orders?id=5 HTTP/1.1" 200 2326 "https://example.com/" "Mozilla/5.0 (X11; Linux x86_64)"`,
+			[]string{"2024-10-10T13:55:36+03:00", "203.0.113.7", "alice", "GET", "/api/orders?id=5", "HTTP/1.1", "200", "2326", "https://example.com/", "Mozilla/5.0 (X11; Linux x86_64)"},
+		},
+		{
+			"combined with broken request",
+			combinedLogFormat,
+			`2001:db8::1 - - [10/Oct/2024:13:55:36 +0000] "-" 408 - "-" "-"`,
+			[]string{"2024-10-10T13:55:36Z", "2001:db8::1", "", "", "", "", "408", "", "", ""},
+		},
+		{
+			"common",
+			commonLogFormat,
+			`127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "POST /login HTTP/1.0" 302 0`,
+			[]string{"2000-10-10T13:55:36-07:00", "127.0.0.1", "frank", "POST", "/login", "HTTP/1.0", "302", "0"},
+		},
+		{
+			"syslog",
+			syslogFormat,
+			`<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog - ID47 [exampleSDID@32473 iut="3" eventSource="Application"] An application event`,
+			[]string{"2003-10-11T22:14:15.003Z", "20", "notice", "mymachine.example.com", "evntslog", "", "ID47", `[exampleSDID@32473 iut="3" eventSource="Application"]`, "An application event"},
+		},
+		{
+			"syslog without structured data and message",
+			syslogFormat,
+			`<34>1 2003-10-11T22:14:15.003Z host su - - -`,
+			[]string{"2003-10-11T22:14:15.003Z", "4", "critical", "host", "su", "", "", "", ""},
+		},
+	}
+	for _, tc := range testCases {
+		row, ok := tc.format.Parse(tc.line)
+		assert.True(t, ok, tc.name)
+		assert.Equal(t, tc.expected, row, tc.name)
+	}
+}
+
+func TestParseLogPattern(t *testing.T) {
+	format, err := parseLogPattern("custom", `$remote_addr [$time_local] "$request" $status $request_time "$http_user_agent" $upstream_addr`)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ip", "timestamp", "method", "path", "protocol", "status", "request_time", "user_agent", "upstream_addr"}, format.Columns)
+
+	row, ok := format.Parse(`10.0.0.1 [10/Oct/2024:13:55:36 +0000] "GET / HTTP/2.0" 200 0.012 "curl/8.0" 10.0.0.2:8080`)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"10.0.0.1", "2024-10-10T13:55:36Z", "GET", "/", "HTTP/2.0", "200", "0.012", "curl/8.0", "10.0.0.2:8080"}, row)
+
+	_, err = parseLogPattern("custom", `$status`)
+	assert.Error(t, err)
+	_, err = parseLogPattern("custom", `$status $status`)
+	assert.Error(t, err)
+}
+
+func TestMatchLogFormat(t *testing.T) {
+	access := []string{
+		`1.1.1.1 - - [10/Oct/2024:13:55:36 +0000] "GET / HTTP/1.1" 200 10 "-" "curl"`,
+		`1.1.1.2 - - [10/Oct/2024:13:55:37 +0000] "GET /a HTTP/1.1" 404 0 "-" "curl"`,
+		`garbage line`,
+		`1.1.1.3 - - [10/Oct/2024:13:55:38 +0000] "GET /b HTTP/1.1" 200 5 "-" "curl"`,
+		`1.1.1.4 - - [10/Oct/2024:13:55:39 +0000] "GET /c HTTP/1.1" 500 7 "-" "curl"`,
+	}
+	assert.Equal(t, combinedLogFormat, matchLogFormat(access))
+	assert.Nil(t, matchLogFormat([]string{"name,amount", "first,1", "second,2"}))
+	assert.Nil(t, matchLogFormat(nil))
+
+	assert.True(t, isJSONLines([]string{`{"level":"info","msg":"started"}`, `{"level":"error","msg":"failed","status":500}`}))
+	assert.False(t, isJSONLines([]string{`{"a":1}`, "plain text", "more text"}))
+}
+
+func TestImportAccessLog(t *testing.T) {
+	original := getMD5String
+	getMD5String = func(input string) string {
+		return "123456"
+	}
+	defer func() {
+		getMD5String = original
+	}()
+
+	content := strings.Join([]string{
+		`203.0.113.7 - - [10/Oct/2024:13:55:36 +0000] "GET /index.html HTTP/1.1" 200 2326 "-" "Mozilla/5.0"`,
+		`203.0.113.8 - - [10/Oct/2024:13:56:01 +0000] "POST /api HTTP/1.1" 500 12 "-" "curl/8.0"`,
+		`not a log line`,
+		`203.0.113.9 - - [10/Oct/2024:14:01:12 +0000] "GET /favicon.ico HTTP/1.1" 404 - "-" "Mozilla/5.0"`,
+		`203.0.113.7 - - [10/Oct/2024:14:02:00 +0000] "GET /index.html HTTP/1.1" 200 2326 "-" "Mozilla/5.0"`,
+		`203.0.113.7 - - [10/Oct/2024:14:03:00 +0000] "GET /about HTTP/1.1" 200 512 "-" "Mozilla/5.0"`,
+	}, "\n") + "\n"
+	filePath := filepath.Join(t.TempDir(), "access.log")
+	assert.NoError(t, os.WriteFile(filePath, []byte(content), 0644))
+	assert.Equal(t, FORMAT_LOG, detectFileFormat(filePath))
+
+	mockDB := NewMockDB()
+	mockDB.On("Exec", mock.Anything, mock.Anything).Return(&gorm.DB{})
+	tables, err := importFileIntoClickHouse(filePath, mockDB, importOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "0001_timestamp_0002_ip_0003_user_123456", string(tables[0].Name))
+
+	var queries []string
+	for _, call := range mockDB.Calls {
+		queries = append(queries, call.Arguments.String(0))
+	}
+	all := strings.Join(queries, "\n")
+	assert.Contains(t, all, "0001_timestamp DateTime64")
+	assert.Contains(t, all, "0002_ip IPv4")
+	assert.Contains(t, all, "0007_status Int64")
+	assert.Contains(t, all, "0008_bytes Int64  NULL")
+	assert.Contains(t, all, "3,wrong column count,not a log line")
+}
@@ -31,6 +31,24 @@ func main() {
 	if err != nil {
 		log.Fatalln("cannot connect to clickhouse", err)
 	}
+	// Данные загружаются через HTTP интерфейс; без CLICKHOUSE_HTTP_URL его адрес берется из DATABASE_DSN
+	httpURL := cfg.ClickhouseHTTPURL
+	if httpURL == "" {
+		httpURL, err = clickhouseHTTPURLFromDSN(cfg.DatabaseDSN)
+	}
+	if err != nil {
+		log.Println("clickhouse http interface is not available, inserting through mysql port:", err)
+	} else {
+		newRowInserter = func(db DBInterface) rowInserter {
+			return newHTTPInserter(httpURL)
+		}
+	}
+	if err := registerLogFormats(cfg.LogFormats); err != nil {
+		log.Fatalln("invalid LOG_FORMATS", err)
+	}
+	if err := loadSavedSchemas(); err != nil {
+		log.Println("cannot load saved column types", err)
+	}
 	// Add new goroutine for periodic table cleanup
 	go func() {
 		for {
@@ -63,9 +81,16 @@ func main() {
 		for {
 			<-time.Tick(time.Second)
 			for table, timer := range toDeleteTable {
+				if time.Now().After(timer) && isAppendTable(table) {
+					// В таблицу еще дописывают загрузки, срок отсчитывается заново
+					toDeleteTable[table] = time.Now().Add(time.Hour)
+					continue
+				}
 				if time.Now().After(timer) {
 					db.Exec(fmt.Sprintf(`drop table "%s"`, string(table)))
 					delete(toDeleteTable, table)
+					deleteTableMeta(table)
+					deleteColumnMeta(table)
 					log.Println("dropped table", table)
 				}
 			}
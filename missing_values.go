@@ -0,0 +1,238 @@
+// missing_values.go
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pivolan/stats_analyzer/domain/models"
+	"gorm.io/gorm"
+)
+
+// Пропуском считается NULL, пустая строка и строка из одних пробелов. Сочетания пропусков показывают,
+// какие колонки не заполняются вместе: например, адрес целиком у заказов без доставки
+const (
+	mostlyEmptyShare       = 0.95 // колонки, пустые больше чем на 95%, отмечаются в отчете
+	maxMissingPatterns     = 10
+	maxMissingPatternWidth = 64 // колонок в одном запросе сочетаний, чтобы он оставался небольшим
+)
+
+// missingPattern — набор колонок, пустых в одной строке, и сколько таких строк
+type missingPattern struct {
+	Columns []string
+	Count   int64
+}
+
+// missingProfile — пропуски по колонкам в порядке колонок таблицы и частые сочетания пропусков
+type missingProfile struct {
+	TotalRows int64
+	Columns   []string
+	Stats     map[string]models.BasicStats
+	Patterns  []missingPattern
+}
+
+// Missing — число пропусков в колонке любого вида
+func (p *missingProfile) Missing(column string) int64 {
+	stats := p.Stats[column]
+	return stats.NullCount + stats.EmptyStringCount + stats.WhitespaceCount
+}
+
+func (p *missingProfile) Share(column string) float64 {
+	if p.TotalRows == 0 {
+		return 0
+	}
+	return float64(p.Missing(column)) / float64(p.TotalRows)
+}
+
+// WithMissing — колонки, в которых есть пропуски, в порядке таблицы
+func (p *missingProfile) WithMissing() []string {
+	result := []string{}
+	for _, column := range p.Columns {
+		if p.Missing(column) > 0 {
+			result = append(result, column)
+		}
+	}
+	return result
+}
+
+// MostlyEmpty — колонки, пустые больше чем на mostlyEmptyShare
+func (p *missingProfile) MostlyEmpty() []string {
+	result := []string{}
+	for _, column := range p.Columns {
+		if p.TotalRows > 0 && p.Share(column) > mostlyEmptyShare {
+			result = append(result, column)
+		}
+	}
+	return result
+}
+
+// missingColumns — колонки из файла; служебные колонки заполняет сам бот
+func missingColumns(columns []models.ColumnInfo) []models.ColumnInfo {
+	result := []models.ColumnInfo{}
+	for _, column := range columns {
+		if isServiceColumn(column) || excludeColumn(column.Name) {
+			continue
+		}
+		result = append(result, column)
+	}
+	return result
+}
+
+// generateSqlForMissingCounts считает NULL, пустые строки и строки из пробелов для всех колонок за один проход;
+// пустые строки бывают только в текстовых колонках
+func generateSqlForMissingCounts(columns []models.ColumnInfo, table models.ClickhouseTableName) string {
+	fields := []string{"count() AS total_rows"}
+	for i, column := range columns {
+		fields = append(fields, fmt.Sprintf("countIf(isNull(%s)) AS null__%d", column.Name, i))
+		if IsCategoryType(column.Type) {
+			fields = append(fields,
+				fmt.Sprintf("countIf(toString(%s) = '') AS empty__%d", column.Name, i),
+				fmt.Sprintf("countIf(toString(%[1]s) != '' AND trimBoth(toString(%[1]s)) = '') AS whitespace__%[2]d", column.Name, i))
+		}
+	}
+	return "SELECT " + strings.Join(fields, ", ") + " FROM " + string(table)
+}
+
+// missingCondition — условие пропуска в колонке для запроса сочетаний
+func missingCondition(column models.ColumnInfo) string {
+	if IsCategoryType(column.Type) {
+		return fmt.Sprintf("(isNull(%[1]s) OR trimBoth(toString(%[1]s)) = '')", column.Name)
+	}
+	return fmt.Sprintf("isNull(%s)", column.Name)
+}
+
+// generateSqlForMissingPatterns группирует строки по набору пустых колонок. Набор записывается номерами колонок
+// через запятую, пустой набор — полностью заполненные строки
+func generateSqlForMissingPatterns(columns []models.ColumnInfo, table models.ClickhouseTableName) string {
+	flags := make([]string, len(columns))
+	for i, column := range columns {
+		flags[i] = fmt.Sprintf("if(%s, '%d', '')", missingCondition(column), i)
+	}
+	return fmt.Sprintf(`SELECT arrayStringConcat(arrayFilter(x -> x != '', [%s]), ',') AS pattern, count() AS cnt
+        FROM %s
+        GROUP BY pattern
+        ORDER BY cnt DESC
+        LIMIT %d`, strings.Join(flags, ", "), table, maxMissingPatterns+1)
+}
+
+// parseMissingCounts раскладывает результат generateSqlForMissingCounts по колонкам
+func parseMissingCounts(columns []models.ColumnInfo, row map[string]interface{}) *missingProfile {
+	profile := &missingProfile{TotalRows: int64(toFloat64(row["total_rows"])), Stats: map[string]models.BasicStats{}}
+	for i, column := range columns {
+		profile.Columns = append(profile.Columns, column.Name)
+		profile.Stats[column.Name] = models.BasicStats{
+			TotalRows:        profile.TotalRows,
+			NullCount:        int64(toFloat64(row[fmt.Sprintf("null__%d", i)])),
+			EmptyStringCount: int64(toFloat64(row[fmt.Sprintf("empty__%d", i)])),
+			WhitespaceCount:  int64(toFloat64(row[fmt.Sprintf("whitespace__%d", i)])),
+		}
+	}
+	return profile
+}
+
+// missingPatternRow — строка результата generateSqlForMissingPatterns
+type missingPatternRow struct {
+	Pattern string
+	Cnt     int64
+}
+
+// parseMissingPatterns переводит номера колонок в названия; полностью заполненные строки пропускаются
+func parseMissingPatterns(columns []models.ColumnInfo, rows []missingPatternRow) []missingPattern {
+	patterns := []missingPattern{}
+	for _, row := range rows {
+		if row.Pattern == "" {
+			continue
+		}
+		pattern := missingPattern{Count: row.Cnt}
+		for _, index := range strings.Split(row.Pattern, ",") {
+			if i, err := strconv.Atoi(index); err == nil && i < len(columns) {
+				pattern.Columns = append(pattern.Columns, columns[i].Name)
+			}
+		}
+		patterns = append(patterns, pattern)
+	}
+	sort.SliceStable(patterns, func(i, j int) bool {
+		return patterns[i].Count > patterns[j].Count
+	})
+	if len(patterns) > maxMissingPatterns {
+		patterns = patterns[:maxMissingPatterns]
+	}
+	return patterns
+}
+
+// computeMissingProfile считает пропуски по колонкам и, если они есть, частые сочетания пропусков
+func computeMissingProfile(db *gorm.DB, tableName models.ClickhouseTableName, columns []models.ColumnInfo) (*missingProfile, error) {
+	columns = missingColumns(columns)
+	row := map[string]interface{}{}
+	if err := db.Raw(generateSqlForMissingCounts(columns, tableName)).Scan(row).Error; err != nil {
+		return nil, err
+	}
+	profile := parseMissingCounts(columns, row)
+
+	withMissing := []models.ColumnInfo{}
+	for _, column := range columns {
+		if profile.Missing(column.Name) > 0 && len(withMissing) < maxMissingPatternWidth {
+			withMissing = append(withMissing, column)
+		}
+	}
+	if len(withMissing) == 0 {
+		return profile, nil
+	}
+	var rows []missingPatternRow
+	if err := db.Raw(generateSqlForMissingPatterns(withMissing, tableName)).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	profile.Patterns = parseMissingPatterns(withMissing, rows)
+	return profile, nil
+}
+
+// formatMissingProfile — раздел отчета о пропусках; пустая строка, если пропусков нет
+func formatMissingProfile(tableName models.ClickhouseTableName, profile *missingProfile) string {
+	columns := profile.WithMissing()
+	if len(columns) == 0 {
+		return ""
+	}
+	var result strings.Builder
+	result.WriteString("🕳 Пропуски в данных:\n")
+	for _, column := range columns {
+		stats := profile.Stats[column]
+		kinds := []string{}
+		if stats.NullCount > 0 {
+			kinds = append(kinds, fmt.Sprintf("NULL %d", stats.NullCount))
+		}
+		if stats.EmptyStringCount > 0 {
+			kinds = append(kinds, fmt.Sprintf("пустых строк %d", stats.EmptyStringCount))
+		}
+		if stats.WhitespaceCount > 0 {
+			kinds = append(kinds, fmt.Sprintf("из пробелов %d", stats.WhitespaceCount))
+		}
+		result.WriteString(fmt.Sprintf("• %s: %d (%.1f%%) — %s\n", columnLabel(tableName, column),
+			profile.Missing(column), profile.Share(column)*100, strings.Join(kinds, ", ")))
+	}
+
+	if empty := profile.MostlyEmpty(); len(empty) > 0 {
+		labels := make([]string, len(empty))
+		for i, column := range empty {
+			labels[i] = columnLabel(tableName, column)
+		}
+		result.WriteString(fmt.Sprintf("\n⚠️ Почти пустые колонки (больше %.0f%% пропусков): %s\n", mostlyEmptyShare*100, strings.Join(labels, ", ")))
+	}
+
+	if len(profile.Patterns) > 0 {
+		result.WriteString("\nЧастые сочетания пропусков в строке:\n")
+		for _, pattern := range profile.Patterns {
+			labels := make([]string, len(pattern.Columns))
+			for i, column := range pattern.Columns {
+				labels[i] = columnLabel(tableName, column)
+			}
+			title := strings.Join(labels, " + ")
+			if len(labels) == 1 {
+				title = "только " + title
+			}
+			result.WriteString(fmt.Sprintf("• %s: %d строк (%.1f%%)\n", title, pattern.Count, float64(pattern.Count)*100/float64(profile.TotalRows)))
+		}
+	}
+	return result.String()
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/pivolan/stats_analyzer/domain/models"
+	"github.com/stretchr/testify/assert"
+)
+
+var missingTestColumns = []models.ColumnInfo{
+	{Name: "id", Type: "Int64"},
+	{Name: "0001_city", Type: "LowCardinality(Nullable(String))"},
+	{Name: "0002_amount", Type: "Nullable(Int64)"},
+	{Name: "0003_comment", Type: "String"},
+	{Name: "0004_fax", Type: "Nullable(String)"},
+}
+
+func TestGenerateSqlForMissingCounts(t *testing.T) {
+	sql := generateSqlForMissingCounts(missingColumns(missingTestColumns), "orders_123456")
+	assert.Equal(t, "SELECT count() AS total_rows, "+
+		"countIf(isNull(0001_city)) AS null__0, countIf(toString(0001_city) = '') AS empty__0, "+
+		"countIf(toString(0001_city) != '' AND trimBoth(toString(0001_city)) = '') AS whitespace__0, "+
+		"countIf(isNull(0002_amount)) AS null__1, "+
+		"countIf(isNull(0003_comment)) AS null__2, countIf(toString(0003_comment) = '') AS empty__2, "+
+		"countIf(toString(0003_comment) != '' AND trimBoth(toString(0003_comment)) = '') AS whitespace__2, "+
+		"countIf(isNull(0004_fax)) AS null__3, countIf(toString(0004_fax) = '') AS empty__3, "+
+		"countIf(toString(0004_fax) != '' AND trimBoth(toString(0004_fax)) = '') AS whitespace__3 "+
+		"FROM orders_123456", sql)
+}
+
+func TestGenerateSqlForMissingPatterns(t *testing.T) {
+	sql := generateSqlForMissingPatterns(missingTestColumns[1:3], "orders_123456")
+	assert.Contains(t, sql, "arrayStringConcat(arrayFilter(x -> x != '', [if((isNull(0001_city) OR trimBoth(toString(0001_city)) = ''), '0', ''), if(isNull(0002_amount), '1', '')]), ',') AS pattern")
+	assert.Contains(t, sql, "GROUP BY pattern")
+	assert.Contains(t, sql, "LIMIT 11")
+}
+
+func TestMissingProfile(t *testing.T) {
+	columns := missingColumns(missingTestColumns)
+	profile := parseMissingCounts(columns, map[string]interface{}{
+		"total_rows": int64(1000),
+		"null__0":    int64(100), "empty__0": int64(15), "whitespace__0": int64(5),
+		"null__1": int64(0),
+		"null__2": int64(0), "empty__2": int64(0), "whitespace__2": int64(0),
+		"null__3": int64(990), "empty__3": int64(2), "whitespace__3": int64(0),
+	})
+	assert.Equal(t, models.BasicStats{TotalRows: 1000, NullCount: 100, EmptyStringCount: 15, WhitespaceCount: 5}, profile.Stats["0001_city"])
+	assert.Equal(t, int64(120), profile.Missing("0001_city"))
+	assert.InDelta(t, 0.992, profile.Share("0004_fax"), 1e-9)
+	assert.Equal(t, []string{"0001_city", "0004_fax"}, profile.WithMissing())
+	assert.Equal(t, []string{"0004_fax"}, profile.MostlyEmpty())
+
+	withMissing := []models.ColumnInfo{columns[0], columns[3]}
+	profile.Patterns = parseMissingPatterns(withMissing, []missingPatternRow{
+		{Pattern: "1", Cnt: 880},
+		{Pattern: "0,1", Cnt: 112},
+		{Pattern: "", Cnt: 0},
+		{Pattern: "0", Cnt: 8},
+	})
+	assert.Equal(t, []missingPattern{
+		{Columns: []string{"0004_fax"}, Count: 880},
+		{Columns: []string{"0001_city", "0004_fax"}, Count: 112},
+		{Columns: []string{"0001_city"}, Count: 8},
+	}, profile.Patterns)
+
+	table := models.ClickhouseTableName("missing_values_table")
+	setColumnMeta(table, map[string]models.ColumnMeta{"0001_city": {Label: "Город"}, "0004_fax": {Label: "Факс"}})
+	defer deleteColumnMeta(table)
+	assert.Equal(t, "🕳 Пропуски в данных:\n"+
+		"• Город: 120 (12.0%) — NULL 100, пустых строк 15, из пробелов 5\n"+
+		"• Факс: 992 (99.2%) — NULL 990, пустых строк 2\n"+
+		"\n⚠️ Почти пустые колонки (больше 95% пропусков): Факс\n"+
+		"\nЧастые сочетания пропусков в строке:\n"+
+		"• только Факс: 880 строк (88.0%)\n"+
+		"• Город + Факс: 112 строк (11.2%)\n"+
+		"• только Город: 8 строк (0.8%)\n",
+		formatMissingProfile(table, profile))
+
+	complete := parseMissingCounts(columns, map[string]interface{}{"total_rows": int64(10)})
+	assert.Equal(t, "", formatMissingProfile(table, complete))
+}
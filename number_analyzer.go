@@ -63,11 +63,13 @@ func calculateQuantile(sorted []float64, p float64) float64 {
 	return lower + fraction*(upper-lower)
 }
 
-// findOutliers находит выбросы на основе межквартильного размаха
-func findOutliers(numbers []float64, q1 float64, q3 float64, iqr float64) []float64 {
+// findOutliers находит выбросы детектором, тем же, что ищет выбросы в колонках таблиц
+func findOutliers(numbers []float64, detector outlierDetector) []float64 {
 	outliers := make([]float64, 0)
-	lowerBound := q1 - 1.5*iqr
-	upperBound := q3 + 1.5*iqr
+	lowerBound, upperBound, err := detector.Bounds(newMemoryValues(numbers))
+	if err != nil {
+		return outliers
+	}
 
 	for _, num := range numbers {
 		if num < lowerBound || num > upperBound {
@@ -115,7 +117,7 @@ func AnalyzeNumbers(numbers []float64) *NumberStats {
 	iqr := quantiles[0.75] - quantiles[0.25]
 
 	// Находим выбросы
-	outliers := findOutliers(numbers, quantiles[0.25], quantiles[0.75], iqr)
+	outliers := findOutliers(numbers, defaultOutlierDetector)
 
 	return &NumberStats{
 		Average:   roundToTwo(avg),
@@ -0,0 +1,124 @@
+// number_locale.go
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Валюты и проценты, которые срезаются с чисел, и их единое обозначение.
+// Длинные варианты идут раньше коротких, чтобы "руб." не срезался как "р"
+var numberUnits = []struct{ raw, unit string }{
+	{"руб.", "₽"}, {"руб", "₽"}, {"р.", "₽"}, {"₽", "₽"}, {"RUB", "₽"},
+	{"USD", "$"}, {"$", "$"}, {"EUR", "€"}, {"€", "€"}, {"GBP", "£"}, {"£", "£"},
+	{"¥", "¥"}, {"₴", "₴"}, {"₸", "₸"}, {"%", "%"},
+}
+
+var (
+	digitsPattern = regexp.MustCompile(`^\d+$`)
+	// Разделители разрядов: пробел, неразрывные пробелы и апостроф (швейцарская запись)
+	groupSpaces = []string{" ", "\u00a0", "\u202f", "'"}
+)
+
+// Что значение говорит о десятичном разделителе колонки
+const (
+	separatorUnknown   = iota // разделителя нет или обе записи дают одно число: "1 200"
+	separatorComma            // "12,5", "1.234,56"
+	separatorPoint            // "1,234.56", "1,234,567"
+	separatorAmbiguous        // "1,234": тысячи или три знака после запятой
+)
+
+// splitLocaleNumber отделяет от значения знак и единицу измерения.
+// Возвращает знак ("" или "-"), тело числа с разделителями и единицу
+func splitLocaleNumber(value string) (sign, body, unit string) {
+	s := strings.TrimSpace(value)
+	trimSign := func() {
+		if strings.HasPrefix(s, "+") {
+			s = strings.TrimSpace(strings.TrimPrefix(s, "+"))
+		}
+		for _, minus := range []string{"-", "\u2212"} {
+			if strings.HasPrefix(s, minus) {
+				sign, s = "-", strings.TrimSpace(strings.TrimPrefix(s, minus))
+			}
+		}
+	}
+	trimSign()
+	for _, u := range numberUnits {
+		if strings.HasSuffix(s, u.raw) {
+			unit, s = u.unit, strings.TrimSpace(strings.TrimSuffix(s, u.raw))
+			break
+		}
+		if strings.HasPrefix(s, u.raw) {
+			unit, s = u.unit, strings.TrimSpace(strings.TrimPrefix(s, u.raw))
+			break
+		}
+	}
+	if sign == "" {
+		trimSign()
+	}
+	return sign, s, unit
+}
+
+// localeNumber переводит тело числа в запись с точкой. Разряды могут разделяться пробелами
+// или вторым знаком (точкой при десятичной запятой и наоборот), группы после первой — ровно по три цифры
+func localeNumber(body string, decimalComma bool) (string, bool) {
+	decimal, group := ".", ","
+	if decimalComma {
+		decimal, group = ",", "."
+	}
+	integer, fraction := body, ""
+	if i := strings.LastIndex(body, decimal); i >= 0 {
+		integer, fraction = body[:i], body[i+1:]
+		if !digitsPattern.MatchString(fraction) {
+			return "", false
+		}
+	}
+	for _, space := range groupSpaces {
+		integer = strings.ReplaceAll(integer, space, group)
+	}
+	groups := strings.Split(integer, group)
+	for i, g := range groups {
+		if !digitsPattern.MatchString(g) || (i == 0 && len(groups) > 1 && len(g) > 3) || (i > 0 && len(g) != 3) {
+			return "", false
+		}
+	}
+	number := strings.Join(groups, "")
+	if fraction != "" {
+		number += "." + fraction
+	}
+	return number, true
+}
+
+// sniffLocaleNumber пробует обе записи дробной части. Возвращает число в записи с точкой
+// (для неоднозначных значений — прочитанное как разряды), единицу и то, что значение говорит о разделителе
+func sniffLocaleNumber(value string) (number, unit string, separator int, ok bool) {
+	sign, body, unit := splitLocaleNumber(value)
+	comma, commaOk := localeNumber(body, true)
+	point, pointOk := localeNumber(body, false)
+	switch {
+	case commaOk && pointOk && comma == point:
+		return sign + point, unit, separatorUnknown, true
+	case commaOk && pointOk:
+		return sign + point, unit, separatorAmbiguous, true
+	case commaOk:
+		return sign + comma, unit, separatorComma, true
+	case pointOk:
+		return sign + point, unit, separatorPoint, true
+	}
+	return "", "", separatorUnknown, false
+}
+
+// parseLocaleNumber читает число по уже известному формату колонки
+func parseLocaleNumber(value string, decimalComma bool) (string, bool) {
+	sign, body, _ := splitLocaleNumber(value)
+	number, ok := localeNumber(body, decimalComma)
+	if !ok {
+		return "", false
+	}
+	return sign + number, true
+}
+
+// columnUnit достает срезанную единицу измерения из комментария колонки
+func columnUnit(comment string) string {
+	return commentValue(comment, "unit")
+}
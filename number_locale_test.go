@@ -0,0 +1,117 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pivolan/stats_analyzer/domain/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/gorm"
+)
+
+func TestSniffLocaleNumber(t *testing.T) {
+	testCases := []struct {
+		value     string
+		number    string
+		unit      string
+		separator int
+		ok        bool
+	}{
+		{"1 234,56", "1234.56", "", separatorComma, true},
+		{"1 234,56", "1234.56", "", separatorComma, true},
+		{"1.234,56", "1234.56", "", separatorComma, true},
+		{"12,5%", "12.5", "%", separatorComma, true},
+		{"₽1 200", "1200", "₽", separatorUnknown, true},
+		{"1 200 руб.", "1200", "₽", separatorUnknown, true},
+		{"-$1,200.50", "-1200.50", "$", separatorPoint, true},
+		{"1,234,567", "1234567", "", separatorPoint, true},
+		{"1,234", "1234", "", separatorAmbiguous, true},
+		{"+7 999 123 45 67", "", "", separatorUnknown, false},
+		{"192.168.0.1", "", "", separatorUnknown, false},
+		{"1,2,3", "", "", separatorUnknown, false},
+		{"руб.", "", "", separatorUnknown, false},
+	}
+	for _, tc := range testCases {
+		number, unit, separator, ok := sniffLocaleNumber(tc.value)
+		assert.Equal(t, tc.ok, ok, tc.value)
+		if tc.ok {
+			assert.Equal(t, tc.number, number, tc.value)
+			assert.Equal(t, tc.unit, unit, tc.value)
+			assert.Equal(t, tc.separator, separator, tc.value)
+		}
+	}
+}
+
+func TestInferLocaleNumbers(t *testing.T) {
+	testCases := []struct {
+		name     string
+		values   []string
+		expected string
+		format   columnFormat
+	}{
+		{"russian money", []string{"1 234,56", "12,50", "7 000,00"}, "Decimal(18, 2)", columnFormat{DecimalComma: true}},
+		{"percent", []string{"12,5%", "3%", "100%"}, "Float64", columnFormat{DecimalComma: true, Unit: "%"}},
+		{"currency prefix", []string{"₽1 200", "₽300", "₽15 000"}, "Int64", columnFormat{Unit: "₽"}},
+		{"ambiguous read as thousands", []string{"1,234", "5,678"}, "Int64", columnFormat{}},
+		{"ambiguous with decimal comma", []string{"1,234", "2,5"}, "Float64", columnFormat{DecimalComma: true}},
+		{"ambiguous with thousands", []string{"1,234", "1,234,567"}, "Int64", columnFormat{}},
+		{"mixed currencies", []string{"$5", "€6"}, "String", columnFormat{}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rows := make([][]string, len(tc.values))
+			for i, value := range tc.values {
+				rows[i] = []string{value}
+			}
+			types, _, formats := inferColumnTypes(&sliceRowReader{rows: rows}, 1)
+			assert.Equal(t, tc.expected, types[0])
+			assert.Equal(t, tc.format, formats[0])
+		})
+	}
+}
+
+func TestImportLocaleNumbersCSV(t *testing.T) {
+	original := getMD5String
+	getMD5String = func(input string) string {
+		return "123456"
+	}
+	defer func() {
+		getMD5String = original
+	}()
+
+	content := "item;price;discount;total\nA;1 234,56;12,5%;₽1 200\nB;7,00;3%;₽300\n"
+	filePath := filepath.Join(t.TempDir(), "export.csv")
+	assert.NoError(t, os.WriteFile(filePath, []byte(content), 0644))
+
+	mockDB := NewMockDB()
+	mockDB.On("Exec", mock.Anything, mock.Anything).Return(&gorm.DB{})
+	_, err := importFileIntoClickHouse(filePath, mockDB, importOptions{})
+	assert.NoError(t, err)
+
+	createSQL := ""
+	for _, call := range mockDB.Calls {
+		if query := call.Arguments.String(0); strings.HasPrefix(query, "CREATE TABLE") {
+			createSQL = query
+		}
+	}
+	assert.Contains(t, createSQL, "0002_price Decimal(18, 2)")
+	assert.Contains(t, createSQL, "0003_discount Float64 COMMENT 'unit:%'")
+	assert.Contains(t, createSQL, "0004_total Int64 COMMENT 'unit:₽'")
+	assert.Contains(t, mockDB.lastQuery, "1,A,1234.56,12.5,1200\n2,B,7.00,3,300\n")
+}
+
+func TestUnitShownInReport(t *testing.T) {
+	stats := map[string]CommonStat{
+		"0002_price": {IsNumeric: true, Avg: 10},
+		"0003_name":  {Uniq: 2},
+	}
+	applyColumnUnits(stats, []models.ColumnInfo{
+		{Name: "0002_price", Type: "Decimal(18, 2)", Comment: "unit:₽"},
+		{Name: "0003_name", Type: "String"},
+	})
+	assert.Equal(t, "₽", stats["0002_price"].Unit)
+	assert.Contains(t, GenerateCommonInfoMsg(stats), "• price (₽)\n")
+}
@@ -0,0 +1,428 @@
+// outlier_detection.go
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pivolan/stats_analyzer/domain/models"
+	"gorm.io/gorm"
+)
+
+// Выбросы ищутся детекторами: детектор считает границы нормальных значений, а все, что за ними, — выброс.
+// Границы считаются по статистикам значений, поэтому один детектор работает и с колонкой в ClickHouse,
+// и с числами из сообщения в памяти
+
+const (
+	maxOutlierRowsShown = 10
+	maxOutlierExport    = 100000 // строк в CSV с выбросами
+)
+
+// outlierValues — значения, по которым детектор считает границы
+type outlierValues interface {
+	Quantiles(levels ...float64) ([]float64, error)
+	MeanStdDev() (mean, stdDev float64, err error)
+	// MedianAbsDeviation — медиана и медиана абсолютных отклонений от нее (MAD)
+	MedianAbsDeviation() (median, mad float64, err error)
+}
+
+// outlierDetector — метод поиска выбросов
+type outlierDetector interface {
+	Name() string
+	Bounds(values outlierValues) (lower, upper float64, err error)
+}
+
+// iqrDetector — правило Тьюки: за пределами [Q1 - K×IQR, Q3 + K×IQR]
+type iqrDetector struct {
+	K float64
+}
+
+func (d iqrDetector) Name() string {
+	return fmt.Sprintf("%s×IQR", formatNumber(d.K))
+}
+
+func (d iqrDetector) Bounds(values outlierValues) (float64, float64, error) {
+	q, err := values.Quantiles(0.25, 0.75)
+	if err != nil {
+		return 0, 0, err
+	}
+	iqr := q[1] - q[0]
+	return q[0] - d.K*iqr, q[1] + d.K*iqr, nil
+}
+
+// zScoreDetector — дальше Threshold стандартных отклонений от среднего; сами выбросы сдвигают среднее
+// и раздувают отклонение, поэтому на сильно скошенных данных метод пропускает выбросы
+type zScoreDetector struct {
+	Threshold float64
+}
+
+func (d zScoreDetector) Name() string {
+	return fmt.Sprintf("z-оценка > %s", formatNumber(d.Threshold))
+}
+
+func (d zScoreDetector) Bounds(values outlierValues) (float64, float64, error) {
+	mean, stdDev, err := values.MeanStdDev()
+	if err != nil {
+		return 0, 0, err
+	}
+	return mean - d.Threshold*stdDev, mean + d.Threshold*stdDev, nil
+}
+
+// madDetector — модифицированная z-оценка Иглевича-Хоглина: 0.6745×|x - медиана| / MAD > Threshold.
+// Медиана и MAD устойчивы к самим выбросам
+type madDetector struct {
+	Threshold float64
+}
+
+const madConsistency = 0.6745
+
+func (d madDetector) Name() string {
+	return fmt.Sprintf("модифицированная z-оценка (MAD) > %s", formatNumber(d.Threshold))
+}
+
+func (d madDetector) Bounds(values outlierValues) (float64, float64, error) {
+	median, mad, err := values.MedianAbsDeviation()
+	if err != nil {
+		return 0, 0, err
+	}
+	if mad == 0 {
+		// Больше половины значений совпадают с медианой: оценка не определена, выбросов не ищем
+		return math.Inf(-1), math.Inf(1), nil
+	}
+	spread := d.Threshold * mad / madConsistency
+	return median - spread, median + spread, nil
+}
+
+// percentileDetector — отсечение хвостов: ниже перцентиля Lower и выше Upper
+type percentileDetector struct {
+	Lower, Upper float64
+}
+
+func (d percentileDetector) Name() string {
+	return fmt.Sprintf("за пределами %s–%s перцентилей", formatNumber(d.Lower*100), formatNumber(d.Upper*100))
+}
+
+func (d percentileDetector) Bounds(values outlierValues) (float64, float64, error) {
+	q, err := values.Quantiles(d.Lower, d.Upper)
+	if err != nil {
+		return 0, 0, err
+	}
+	return q[0], q[1], nil
+}
+
+var defaultOutlierDetector outlierDetector = iqrDetector{K: 1.5}
+
+const outlierMethodsHelp = "iqr[=k], zscore[=порог], mad[=порог], percentile[=процент]"
+
+// parseOutlierDetector разбирает метод из команды: "iqr", "iqr=3", "zscore=2.5", "mad", "percentile=5"
+func parseOutlierDetector(spec string) (outlierDetector, bool) {
+	name, param, hasParam := strings.Cut(strings.ToLower(strings.TrimSpace(spec)), "=")
+	value := 0.0
+	if hasParam {
+		v, err := strconv.ParseFloat(strings.ReplaceAll(param, ",", "."), 64)
+		if err != nil || v <= 0 || math.IsInf(v, 0) {
+			return nil, false
+		}
+		value = v
+	}
+	withDefault := func(def float64) float64 {
+		if hasParam {
+			return value
+		}
+		return def
+	}
+	switch name {
+	case "iqr", "tukey":
+		return iqrDetector{K: withDefault(1.5)}, true
+	case "zscore", "z":
+		return zScoreDetector{Threshold: withDefault(3)}, true
+	case "mad":
+		return madDetector{Threshold: withDefault(3.5)}, true
+	case "percentile", "pct":
+		percent := withDefault(1)
+		if percent >= 50 {
+			return nil, false
+		}
+		return percentileDetector{Lower: percent / 100, Upper: 1 - percent/100}, true
+	}
+	return nil, false
+}
+
+func formatNumber(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// memoryValues — числа в памяти, отсортированные по возрастанию
+type memoryValues []float64
+
+func newMemoryValues(numbers []float64) memoryValues {
+	sorted := append([]float64(nil), numbers...)
+	sort.Float64s(sorted)
+	return sorted
+}
+
+func (v memoryValues) Quantiles(levels ...float64) ([]float64, error) {
+	if len(v) == 0 {
+		return nil, fmt.Errorf("no values")
+	}
+	result := make([]float64, len(levels))
+	for i, level := range levels {
+		result[i] = calculateQuantile(v, level)
+	}
+	return result, nil
+}
+
+func (v memoryValues) MeanStdDev() (float64, float64, error) {
+	if len(v) == 0 {
+		return 0, 0, fmt.Errorf("no values")
+	}
+	mean := 0.0
+	for _, x := range v {
+		mean += x
+	}
+	mean /= float64(len(v))
+	variance := 0.0
+	for _, x := range v {
+		variance += (x - mean) * (x - mean)
+	}
+	return mean, math.Sqrt(variance / float64(len(v))), nil
+}
+
+func (v memoryValues) MedianAbsDeviation() (float64, float64, error) {
+	if len(v) == 0 {
+		return 0, 0, fmt.Errorf("no values")
+	}
+	median := calculateQuantile(v, 0.5)
+	deviations := make([]float64, len(v))
+	for i, x := range v {
+		deviations[i] = math.Abs(x - median)
+	}
+	sort.Float64s(deviations)
+	return median, calculateQuantile(deviations, 0.5), nil
+}
+
+// clickhouseValues — числовая колонка таблицы; статистики считаются запросами
+type clickhouseValues struct {
+	db     *gorm.DB
+	table  models.ClickhouseTableName
+	column string
+}
+
+func newClickhouseValues(db *gorm.DB, table models.ClickhouseTableName, column string) clickhouseValues {
+	return clickhouseValues{db: db, table: table, column: column}
+}
+
+func (v clickhouseValues) Quantiles(levels ...float64) ([]float64, error) {
+	var result struct {
+		Quantiles string
+	}
+	if err := v.db.Raw(generateSqlForQuantiles(v.column, v.table, levels)).Scan(&result).Error; err != nil {
+		return nil, err
+	}
+	quantiles := parseFloatArray(result.Quantiles)
+	if len(quantiles) != len(levels) {
+		return nil, fmt.Errorf("unexpected quantiles result: %s", result.Quantiles)
+	}
+	return quantiles, nil
+}
+
+func (v clickhouseValues) MeanStdDev() (float64, float64, error) {
+	var result struct {
+		Mean   float64
+		StdDev float64
+	}
+	err := v.db.Raw(fmt.Sprintf("SELECT avg(toFloat64(%[1]s)) AS mean, stddevPop(toFloat64(%[1]s)) AS std_dev FROM %[2]s", v.column, v.table)).Scan(&result).Error
+	return result.Mean, result.StdDev, err
+}
+
+func (v clickhouseValues) MedianAbsDeviation() (float64, float64, error) {
+	var result struct {
+		Median float64
+		Mad    float64
+	}
+	err := v.db.Raw(generateSqlForMedianAbsDeviation(v.column, v.table)).Scan(&result).Error
+	return result.Median, result.Mad, err
+}
+
+func generateSqlForQuantiles(column string, table models.ClickhouseTableName, levels []float64) string {
+	parts := make([]string, len(levels))
+	for i, level := range levels {
+		parts[i] = formatNumber(level)
+	}
+	return fmt.Sprintf("SELECT quantiles(%s)(toFloat64(%s)) AS quantiles FROM %s", strings.Join(parts, ", "), column, table)
+}
+
+func generateSqlForMedianAbsDeviation(column string, table models.ClickhouseTableName) string {
+	return fmt.Sprintf("WITH (SELECT median(toFloat64(%[1]s)) FROM %[2]s) AS m SELECT m AS median, median(abs(toFloat64(%[1]s) - m)) AS mad FROM %[2]s", column, table)
+}
+
+// parseFloatArray разбирает массив ClickHouse, который через MySQL протокол приходит строкой "[1,2.5]"
+func parseFloatArray(value string) []float64 {
+	value = strings.Trim(strings.TrimSpace(value), "[]")
+	if value == "" {
+		return nil
+	}
+	result := []float64{}
+	for _, part := range strings.Split(value, ",") {
+		if f, err := strconv.ParseFloat(strings.TrimSpace(part), 64); err == nil {
+			result = append(result, f)
+		}
+	}
+	return result
+}
+
+// outlierCondition — условие выброса для WHERE; бесконечная граница не ограничивает
+func outlierCondition(column string, lower, upper float64) string {
+	conditions := []string{}
+	if !math.IsInf(lower, -1) {
+		conditions = append(conditions, fmt.Sprintf("toFloat64(%s) < %s", column, formatNumber(lower)))
+	}
+	if !math.IsInf(upper, 1) {
+		conditions = append(conditions, fmt.Sprintf("toFloat64(%s) > %s", column, formatNumber(upper)))
+	}
+	if len(conditions) == 0 {
+		return "0"
+	}
+	return "(" + strings.Join(conditions, " OR ") + ")"
+}
+
+// outlierSummary — сколько значений ниже и выше границ
+type outlierSummary struct {
+	Total int64
+	Below int64
+	Above int64
+}
+
+func generateSqlForOutlierSummary(column string, table models.ClickhouseTableName, lower, upper float64) string {
+	below, above := "0", "0"
+	if !math.IsInf(lower, -1) {
+		below = fmt.Sprintf("countIf(toFloat64(%s) < %s)", column, formatNumber(lower))
+	}
+	if !math.IsInf(upper, 1) {
+		above = fmt.Sprintf("countIf(toFloat64(%s) > %s)", column, formatNumber(upper))
+	}
+	return fmt.Sprintf("SELECT count(%s) AS total, %s AS below, %s AS above FROM %s", column, below, above, table)
+}
+
+// outlierDistance — насколько значение за границей, для сортировки строк
+func outlierDistance(column string, lower, upper float64) string {
+	distances := []string{}
+	if !math.IsInf(lower, -1) {
+		distances = append(distances, fmt.Sprintf("%s - toFloat64(%s)", formatNumber(lower), column))
+	}
+	if !math.IsInf(upper, 1) {
+		distances = append(distances, fmt.Sprintf("toFloat64(%s) - %s", column, formatNumber(upper)))
+	}
+	switch len(distances) {
+	case 0:
+		return "0"
+	case 1:
+		return distances[0]
+	}
+	return "greatest(" + strings.Join(distances, ", ") + ")"
+}
+
+// generateSqlForOutlierRows — строки с выбросами целиком, самые далекие от границ первыми
+func generateSqlForOutlierRows(column string, table models.ClickhouseTableName, lower, upper float64, limit int) string {
+	return fmt.Sprintf("SELECT * FROM %s WHERE %s ORDER BY %s DESC LIMIT %d",
+		table, outlierCondition(column, lower, upper), outlierDistance(column, lower, upper), limit)
+}
+
+// queryRows выполняет запрос и возвращает колонки и значения строк текстом; NULL становится пустой строкой
+func queryRows(db *gorm.DB, query string) ([]string, [][]string, error) {
+	rows, err := db.Raw(query).Rows()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, nil, err
+	}
+	result := [][]string{}
+	for rows.Next() {
+		values := make([]sql.NullString, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, nil, err
+		}
+		row := make([]string, len(columns))
+		for i, value := range values {
+			row[i] = value.String
+		}
+		result = append(result, row)
+	}
+	return columns, result, rows.Err()
+}
+
+// outlierRowsCSV выгружает строки в CSV с исходными названиями колонок
+func outlierRowsCSV(tableName models.ClickhouseTableName, columns []string, rows [][]string) []byte {
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+	header := make([]string, len(columns))
+	for i, column := range columns {
+		header[i] = columnLabel(tableName, column)
+	}
+	w.Write(header)
+	w.WriteAll(rows)
+	return b.Bytes()
+}
+
+// formatOutlierReport — итог поиска выбросов и самые далекие от границ строки со всеми колонками
+func formatOutlierReport(tableName models.ClickhouseTableName, column string, detector outlierDetector, lower, upper float64,
+	summary outlierSummary, columns []string, rows [][]string) string {
+	var result strings.Builder
+	result.WriteString(fmt.Sprintf("🎯 Выбросы в %s\nМетод: %s\n", columnLabel(tableName, column), detector.Name()))
+	result.WriteString(fmt.Sprintf("Границы нормальных значений: %s … %s\n", formatBound(lower), formatBound(upper)))
+	outliers := summary.Below + summary.Above
+	share := 0.0
+	if summary.Total > 0 {
+		share = float64(outliers) * 100 / float64(summary.Total)
+	}
+	result.WriteString(fmt.Sprintf("Выбросов: %d из %d (%.2f%%): ниже %d, выше %d\n", outliers, summary.Total, share, summary.Below, summary.Above))
+	if len(rows) == 0 {
+		return result.String()
+	}
+
+	valueIndex := -1
+	for i, name := range columns {
+		if name == column {
+			valueIndex = i
+		}
+	}
+	result.WriteString("\nСамые далекие от границ строки:\n")
+	for n, row := range rows {
+		fields := []string{}
+		for i, name := range columns {
+			if i == valueIndex || name == "id" {
+				continue
+			}
+			fields = append(fields, fmt.Sprintf("%s: %s", columnLabel(tableName, name), row[i]))
+		}
+		value := ""
+		if valueIndex >= 0 {
+			value = row[valueIndex]
+		}
+		result.WriteString(fmt.Sprintf("%d. %s — %s\n", n+1, value, strings.Join(fields, "; ")))
+	}
+	return result.String()
+}
+
+func formatBound(v float64) string {
+	if math.IsInf(v, 1) {
+		return "∞"
+	}
+	if math.IsInf(v, -1) {
+		return "-∞"
+	}
+	return strconv.FormatFloat(v, 'f', 2, 64)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"github.com/pivolan/stats_analyzer/domain/models"
+	"github.com/stretchr/testify/assert"
+)
+
+var outlierTestNumbers = []float64{10, 12, 11, 13, 12, 11, 10, 12, 13, 11, 95, -40}
+
+func TestParseOutlierDetector(t *testing.T) {
+	testCases := []struct {
+		spec     string
+		expected outlierDetector
+		ok       bool
+	}{
+		{"iqr", iqrDetector{K: 1.5}, true},
+		{"IQR=3", iqrDetector{K: 3}, true},
+		{"zscore", zScoreDetector{Threshold: 3}, true},
+		{"z=2,5", zScoreDetector{Threshold: 2.5}, true},
+		{"mad", madDetector{Threshold: 3.5}, true},
+		{"percentile", percentileDetector{Lower: 0.01, Upper: 0.99}, true},
+		{"pct=5", percentileDetector{Lower: 0.05, Upper: 0.95}, true},
+		{"percentile=50", nil, false},
+		{"iqr=-1", nil, false},
+		{"iqr=abc", nil, false},
+		{"Москва", nil, false},
+	}
+	for _, tc := range testCases {
+		detector, ok := parseOutlierDetector(tc.spec)
+		assert.Equal(t, tc.ok, ok, tc.spec)
+		assert.Equal(t, tc.expected, detector, tc.spec)
+	}
+}
+
+func TestOutlierDetectorsInMemory(t *testing.T) {
+	values := newMemoryValues(outlierTestNumbers)
+	testCases := []struct {
+		detector     outlierDetector
+		lower, upper float64
+		outliers     []float64
+	}{
+		// Q1 = 10.75, Q3 = 12.25
+		{iqrDetector{K: 1.5}, 8.5, 14.5, []float64{95, -40}},
+		{iqrDetector{K: 100}, -139.25, 162.25, []float64{}},
+		// медиана 11.5, MAD 1
+		{madDetector{Threshold: 3.5}, 11.5 - 3.5/madConsistency, 11.5 + 3.5/madConsistency, []float64{95, -40}},
+		// Выбросы раздувают отклонение: z-оценка не видит даже 95
+		{zScoreDetector{Threshold: 3}, math.NaN(), math.NaN(), []float64{}},
+	}
+	for _, tc := range testCases {
+		lower, upper, err := tc.detector.Bounds(values)
+		assert.NoError(t, err)
+		if !math.IsNaN(tc.lower) {
+			assert.InDelta(t, tc.lower, lower, 1e-9, tc.detector.Name())
+			assert.InDelta(t, tc.upper, upper, 1e-9, tc.detector.Name())
+		}
+		assert.Equal(t, tc.outliers, findOutliers(outlierTestNumbers, tc.detector), tc.detector.Name())
+	}
+
+	lower, upper, err := percentileDetector{Lower: 0.1, Upper: 0.9}.Bounds(values)
+	assert.NoError(t, err)
+	assert.InDelta(t, 10, lower, 1e-9)
+	assert.InDelta(t, 13, upper, 1e-9)
+
+	// MAD равен нулю, когда больше половины значений одинаковые: выбросов не ищем
+	lower, upper, err = madDetector{Threshold: 3.5}.Bounds(newMemoryValues([]float64{5, 5, 5, 5, 100}))
+	assert.NoError(t, err)
+	assert.True(t, math.IsInf(lower, -1) && math.IsInf(upper, 1))
+
+	_, _, err = defaultOutlierDetector.Bounds(newMemoryValues(nil))
+	assert.Error(t, err)
+	assert.Equal(t, []float64{95, -40}, AnalyzeNumbers(outlierTestNumbers).Outliers)
+}
+
+func TestOutlierSQL(t *testing.T) {
+	assert.Equal(t, "SELECT quantiles(0.25, 0.75)(toFloat64(0002_amount)) AS quantiles FROM orders_123456",
+		generateSqlForQuantiles("0002_amount", "orders_123456", []float64{0.25, 0.75}))
+	assert.Equal(t, "WITH (SELECT median(toFloat64(0002_amount)) FROM orders_123456) AS m SELECT m AS median, median(abs(toFloat64(0002_amount) - m)) AS mad FROM orders_123456",
+		generateSqlForMedianAbsDeviation("0002_amount", "orders_123456"))
+	assert.Equal(t, "SELECT count(0002_amount) AS total, countIf(toFloat64(0002_amount) < -2.5) AS below, countIf(toFloat64(0002_amount) > 100) AS above FROM orders_123456",
+		generateSqlForOutlierSummary("0002_amount", "orders_123456", -2.5, 100))
+	assert.Equal(t, "SELECT * FROM orders_123456 WHERE (toFloat64(0002_amount) < -2.5 OR toFloat64(0002_amount) > 100) "+
+		"ORDER BY greatest(-2.5 - toFloat64(0002_amount), toFloat64(0002_amount) - 100) DESC LIMIT 10",
+		generateSqlForOutlierRows("0002_amount", "orders_123456", -2.5, 100, 10))
+	assert.Equal(t, "SELECT * FROM orders_123456 WHERE 0 ORDER BY 0 DESC LIMIT 10",
+		generateSqlForOutlierRows("0002_amount", "orders_123456", math.Inf(-1), math.Inf(1), 10))
+	assert.Equal(t, []float64{1, 2.5, -3}, parseFloatArray("[1,2.5,-3]"))
+	assert.Nil(t, parseFloatArray("[]"))
+}
+
+func TestFormatOutlierReport(t *testing.T) {
+	table := models.ClickhouseTableName("outliers_table")
+	setColumnMeta(table, map[string]models.ColumnMeta{"0001_city": {Label: "Город"}, "0002_amount": {Label: "Сумма"}})
+	defer deleteColumnMeta(table)
+
+	columns := []string{"id", "0001_city", "0002_amount"}
+	rows := [][]string{{"7", "Москва", "95000"}, {"3", "", "-400"}}
+	assert.Equal(t, "🎯 Выбросы в Сумма\n"+
+		"Метод: 1.5×IQR\n"+
+		"Границы нормальных значений: -2.50 … 100.00\n"+
+		"Выбросов: 2 из 1000 (0.20%): ниже 1, выше 1\n"+
+		"\nСамые далекие от границ строки:\n"+
+		"1. 95000 — Город: Москва\n"+
+		"2. -400 — Город: \n",
+		formatOutlierReport(table, "0002_amount", iqrDetector{K: 1.5}, -2.5, 100, outlierSummary{Total: 1000, Below: 1, Above: 1}, columns, rows))
+	assert.Equal(t, "id,Город,Сумма\n7,Москва,95000\n3,,-400\n", string(outlierRowsCSV(table, columns, rows)))
+}
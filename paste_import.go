@@ -0,0 +1,84 @@
+// paste_import.go
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Вставленная из таблицы выборка: шапка и хотя бы одна строка данных. Для запятой и других
+// разделителей, которые встречаются в обычном тексте, строк данных нужно не меньше двух
+const (
+	pastedMinRows          = 1
+	pastedMinRowsNoTab     = 2
+	pastedMaxHeaderLength  = 64
+	pastedTableFilePattern = "pasted_%d.csv"
+)
+
+// detectPastedTable проверяет, что сообщение — таблица, скопированная из Excel или Google Sheets:
+// у всех строк одинаковое число полей (не меньше двух) по одному разделителю и первая строка похожа на шапку
+func detectPastedTable(text string) (csvDialect, bool) {
+	text = strings.TrimSpace(strings.ReplaceAll(text, "\r\n", "\n"))
+	lines := strings.Split(text, "\n")
+	if len(lines) < 1+pastedMinRows {
+		return csvDialect{}, false
+	}
+	quote := detectQuoteChar(lines)
+	// Табуляция первой: так копируются ячейки из таблиц, и в тексте ячеек она не встречается
+	for _, delimiter := range []rune{'\t', ';', '|', ','} {
+		dialect := csvDialect{Delimiter: delimiter, Quote: quote}
+		records := sniffRecords(dialect, lines)
+		minRows := pastedMinRowsNoTab
+		if delimiter == '\t' {
+			minRows = pastedMinRows
+		}
+		if len(records) < 1+minRows || records[0].fields < 2 {
+			continue
+		}
+		consistent := true
+		for _, record := range records {
+			if record.fields != records[0].fields {
+				consistent = false
+				break
+			}
+		}
+		if consistent && isPlausibleHeader((&dialectReader{dialect: dialect}).parseRecord(records[0].raw, func() (string, bool) { return "", false })) {
+			return dialect, true
+		}
+	}
+	return csvDialect{}, false
+}
+
+// isPlausibleHeader — названия колонок непустые, короткие, не повторяются и не все являются числами
+func isPlausibleHeader(fields []string) bool {
+	seen := map[string]bool{}
+	hasText := false
+	for _, field := range fields {
+		field = strings.TrimSpace(field)
+		if field == "" || len([]rune(field)) > pastedMaxHeaderLength || seen[field] {
+			return false
+		}
+		seen[field] = true
+		if _, err := strconv.ParseFloat(strings.ReplaceAll(field, ",", "."), 64); err != nil {
+			hasText = true
+		}
+	}
+	return hasText
+}
+
+// savePastedTable сохраняет вставленную таблицу в файл, чтобы она загрузилась как отправленный CSV
+func savePastedTable(text, dir string) (string, error) {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return "", err
+	}
+	filePath := filepath.Join(dir, fmt.Sprintf(pastedTableFilePattern, time.Now().UnixNano()))
+	text = strings.TrimSpace(strings.ReplaceAll(text, "\r\n", "\n")) + "\n"
+	if err := os.WriteFile(filePath, []byte(text), 0644); err != nil {
+		return "", err
+	}
+	return filePath, nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/gorm"
+)
+
+func TestDetectPastedTable(t *testing.T) {
+	testCases := []struct {
+		name      string
+		text      string
+		ok        bool
+		delimiter rune
+	}{
+		{"spreadsheet", "city\tsales\tdate\nMoscow\t1 200,50\t01.02.2024\nKazan\t800\t02.02.2024", true, '\t'},
+		{"windows line endings", "name\tamount\r\nfirst\t1\r\n", true, '\t'},
+		{"csv", "name,amount\nfirst,1\nsecond,2", true, ','},
+		{"semicolon with quotes", "name;comment\nfirst;\"a; b\"\nsecond;c", true, ';'},
+		{"csv with one row", "name,amount\nfirst,1", false, 0},
+		{"numbers by spaces", "1 2 3 4 5", false, 0},
+		{"numbers by commas", "1,2,3,4,5", false, 0},
+		{"numeric header", "1\t2\n3\t4\n5\t6", false, 0},
+		{"different field count", "a\tb\n1\t2\t3", false, 0},
+		{"duplicate header", "a\ta\n1\t2", false, 0},
+		{"prose", "Привет, как дела?\nЕсть новый файл, посмотри\nА потом ответь", false, 0},
+	}
+	for _, tc := range testCases {
+		dialect, ok := detectPastedTable(tc.text)
+		assert.Equal(t, tc.ok, ok, tc.name)
+		if tc.ok {
+			assert.Equal(t, tc.delimiter, dialect.Delimiter, tc.name)
+		}
+	}
+}
+
+func TestImportPastedTable(t *testing.T) {
+	original := getMD5String
+	getMD5String = func(input string) string {
+		return "123456"
+	}
+	defer func() {
+		getMD5String = original
+	}()
+
+	text := "city\tsales\nMoscow\t1200\nKazan\t800\n"
+	filePath, err := savePastedTable(text, t.TempDir())
+	assert.NoError(t, err)
+	data, err := os.ReadFile(filePath)
+	assert.NoError(t, err)
+	assert.Equal(t, text, string(data))
+
+	mockDB := NewMockDB()
+	mockDB.On("Exec", mock.Anything, mock.Anything).Return(&gorm.DB{})
+	tables, err := importFileIntoClickHouse(filePath, mockDB, importOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "0001_city_0002_sales_123456", string(tables[0].Name))
+	assert.True(t, strings.HasPrefix(tables[0].Source, "pasted_"))
+	assert.Contains(t, mockDB.lastQuery, "1,Moscow,1200\n2,Kazan,800\n")
+}
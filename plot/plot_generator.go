@@ -10,7 +10,20 @@ import (
 	"github.com/wcharczuk/go-chart/v2/drawing"
 )
 
+// FittedCurve — плотность подобранного распределения, которая накладывается на график плотности
+type FittedCurve struct {
+	Name    string
+	XValues []float64
+	YValues []float64
+}
+
 func DrawDensityPlot(xValues []float64, yValues []float64) ([]byte, error) {
+	return DrawDensityPlotWithFit(xValues, yValues, nil)
+}
+
+// DrawDensityPlotWithFit рисует нормированную гистограмму и, если fit задан, кривую распределения поверх нее.
+// Кривая должна быть в тех же единицах, что и yValues: она нормируется на ту же площадь
+func DrawDensityPlotWithFit(xValues []float64, yValues []float64, fit *FittedCurve) ([]byte, error) {
 	// Нормализуем значения y, чтобы площадь под кривой была равна 1
 	totalArea := 0.0
 	binWidth := 0.0
@@ -90,6 +103,25 @@ func DrawDensityPlot(xValues []float64, yValues []float64) ([]byte, error) {
 		},
 	}
 
+	// Кривая распределения рисуется последней, поверх данных; легенда подписала бы и заливку, поэтому название — в заголовке
+	if fit != nil && len(fit.XValues) > 0 {
+		fitY := make([]float64, len(fit.YValues))
+		for i, y := range fit.YValues {
+			fitY[i] = y / totalArea
+		}
+		graph.Series = append(graph.Series, &chart.ContinuousSeries{
+			Name:    fit.Name,
+			XValues: fit.XValues,
+			YValues: fitY,
+			Style: chart.Style{
+				StrokeColor:     drawing.ColorFromHex("2ca02c"),
+				StrokeWidth:     3,
+				StrokeDashArray: []float64{10, 5},
+			},
+		})
+		graph.Title = fmt.Sprintf("Density Distribution (пунктир — %s)", fit.Name)
+	}
+
 	// Создаем буфер для записи изображения
 	buffer := bytes.NewBuffer([]byte{})
 	graph.Background.StrokeWidth = 1
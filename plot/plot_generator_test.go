@@ -1,11 +1,14 @@
 package plot
 
 import (
+	"bytes"
+	"math"
 	"os"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/wcharczuk/go-chart/v2"
+	"github.com/wcharczuk/go-chart/v2/drawing"
 )
 
 func TestLenPaddingBot(t *testing.T) {
@@ -58,3 +61,40 @@ func TestDrawDensityPlot(t *testing.T) {
 	err = os.WriteFile("DrawDestinyPlot.png", b, 0655)
 	assert.NoError(t, err)
 }
+
+func TestDrawDensityPlotWithFit(t *testing.T) {
+	xValues := []float64{1, 2, 3, 4, 5, 6, 7, 8}
+	yValues := []float64{8, 7, 6, 5, 4, 3, 2, 1}
+	fit := &FittedCurve{Name: "экспоненциальное", XValues: []float64{0.5, 2, 4, 6, 8.5}, YValues: []float64{7.8, 6.7, 5.4, 4.3, 3}}
+
+	b, err := DrawDensityPlotWithFit(xValues, yValues, fit)
+	assert.NoError(t, err)
+	assert.True(t, bytes.HasPrefix(b, []byte("\x89PNG")))
+}
+
+func TestDrawHeatmap(t *testing.T) {
+	labels := []string{"Цена", "Количество", "Сумма заказа"}
+	values := [][]float64{{1, 0.8, -0.5}, {0.8, 1, math.NaN()}, {-0.5, math.NaN(), 1}}
+	b, err := DrawHeatmap(labels, values, "Корреляция: Пирсон")
+	assert.NoError(t, err)
+	assert.True(t, bytes.HasPrefix(b, []byte("\x89PNG")))
+
+	_, err = DrawHeatmap(labels, values[:2], "Корреляция: Пирсон")
+	assert.Error(t, err)
+}
+
+func TestHeatmapColor(t *testing.T) {
+	assert.Equal(t, drawing.ColorWhite, heatmapColor(0))
+	assert.Equal(t, heatmapPositive, heatmapColor(1))
+	assert.Equal(t, heatmapNegative, heatmapColor(-1))
+	assert.Equal(t, heatmapEmpty, heatmapColor(math.NaN()))
+}
+
+func TestDrawStackedBar(t *testing.T) {
+	b, err := DrawStackedBar([]string{"Москва", "Санкт-Петербург"}, []string{"карта", "наличные"}, [][]int64{{40, 30}, {0, 0}}, "Город × Оплата")
+	assert.NoError(t, err)
+	assert.True(t, bytes.HasPrefix(b, []byte("\x89PNG")))
+
+	_, err = DrawStackedBar([]string{"Москва"}, []string{"карта"}, [][]int64{{0}}, "Город × Оплата")
+	assert.Error(t, err)
+}
@@ -0,0 +1,158 @@
+package plot
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+
+	"github.com/wcharczuk/go-chart/v2"
+	"github.com/wcharczuk/go-chart/v2/drawing"
+)
+
+const (
+	heatmapCellSize      = 64
+	heatmapMaxLabelRunes = 28
+	heatmapPadding       = 20
+	heatmapTitleHeight   = 60
+)
+
+var (
+	heatmapPositive = drawing.Color{R: 214, G: 39, B: 40, A: 255}
+	heatmapNegative = drawing.Color{R: 31, G: 119, B: 180, A: 255}
+	heatmapEmpty    = drawing.Color{R: 220, G: 220, B: 220, A: 255}
+)
+
+// DrawHeatmap рисует квадратную матрицу значений от -1 до 1, например корреляций между колонками:
+// отрицательные значения синие, положительные красные, около нуля белые, NaN серые.
+// Подписи строк слева, подписи колонок снизу
+func DrawHeatmap(labels []string, values [][]float64, title string) ([]byte, error) {
+	n := len(labels)
+	if n == 0 || len(values) != n {
+		return nil, fmt.Errorf("heatmap needs a %dx%d matrix", n, n)
+	}
+	for _, row := range values {
+		if len(row) != n {
+			return nil, fmt.Errorf("heatmap needs a %dx%d matrix", n, n)
+		}
+	}
+	font, err := chart.GetDefaultFont()
+	if err != nil {
+		return nil, fmt.Errorf("error loading font: %v", err)
+	}
+
+	// Ширина подписей нужна до создания картинки, поэтому меряем на временном холсте
+	short := make([]string, n)
+	for i, label := range labels {
+		short[i] = truncateLabel(label, heatmapMaxLabelRunes)
+	}
+	measure, err := chart.PNG(1, 1)
+	if err != nil {
+		return nil, fmt.Errorf("error rendering chart: %v", err)
+	}
+	measure.SetFont(font)
+	measure.SetFontSize(12)
+	labelWidth := 0
+	for _, label := range short {
+		if w := measure.MeasureText(label).Width(); w > labelWidth {
+			labelWidth = w
+		}
+	}
+	labelWidth += 10
+	measure.SetFontSize(16)
+	titleWidth := measure.MeasureText(title).Width()
+
+	left := heatmapPadding + labelWidth
+	top := heatmapTitleHeight
+	width := left + n*heatmapCellSize + heatmapPadding
+	if titleWidth+2*heatmapPadding > width {
+		width = titleWidth + 2*heatmapPadding
+	}
+	height := top + n*heatmapCellSize + labelWidth + heatmapPadding
+	r, err := chart.PNG(width, height)
+	if err != nil {
+		return nil, fmt.Errorf("error rendering chart: %v", err)
+	}
+	r.SetFont(font)
+
+	fillRect(r, 0, 0, width, height, drawing.ColorWhite, drawing.ColorWhite)
+
+	r.SetFontSize(16)
+	r.SetFontColor(drawing.ColorBlack)
+	r.Text(title, (width-titleWidth)/2, heatmapTitleHeight/2+r.MeasureText(title).Height()/2)
+
+	for i := 0; i < n; i++ {
+		y := top + i*heatmapCellSize
+		for j := 0; j < n; j++ {
+			x := left + j*heatmapCellSize
+			value := values[i][j]
+			fillRect(r, x, y, x+heatmapCellSize, y+heatmapCellSize, heatmapColor(value), drawing.ColorWhite)
+
+			text := "—"
+			if !math.IsNaN(value) {
+				text = fmt.Sprintf("%.2f", value)
+			}
+			r.SetFontSize(11)
+			r.SetFontColor(drawing.ColorBlack)
+			if math.Abs(value) > 0.6 {
+				r.SetFontColor(drawing.ColorWhite)
+			}
+			box := r.MeasureText(text)
+			r.Text(text, x+(heatmapCellSize-box.Width())/2, y+(heatmapCellSize+box.Height())/2)
+		}
+	}
+
+	r.SetFontSize(12)
+	r.SetFontColor(drawing.ColorBlack)
+	for i, label := range short {
+		box := r.MeasureText(label)
+		// Подпись строки прижата к клетке справа
+		r.Text(label, left-6-box.Width(), top+i*heatmapCellSize+(heatmapCellSize+box.Height())/2)
+
+		// Подпись колонки повернута и читается сверху вниз; поворот сбрасывается после каждой подписи
+		r.SetTextRotation(chart.DegreesToRadians(90))
+		r.Text(label, left+i*heatmapCellSize+(heatmapCellSize-box.Height())/2, top+n*heatmapCellSize+6)
+		r.ClearTextRotation()
+	}
+
+	buffer := bytes.NewBuffer([]byte{})
+	if err := r.Save(buffer); err != nil {
+		return nil, fmt.Errorf("error rendering chart: %v", err)
+	}
+	return buffer.Bytes(), nil
+}
+
+func fillRect(r chart.Renderer, x0, y0, x1, y1 int, fill, stroke drawing.Color) {
+	r.SetFillColor(fill)
+	r.SetStrokeColor(stroke)
+	r.SetStrokeWidth(1)
+	r.MoveTo(x0, y0)
+	r.LineTo(x1, y0)
+	r.LineTo(x1, y1)
+	r.LineTo(x0, y1)
+	r.Close()
+	r.FillStroke()
+}
+
+// heatmapColor смешивает белый с красным для положительных значений и с синим для отрицательных
+func heatmapColor(value float64) drawing.Color {
+	if math.IsNaN(value) {
+		return heatmapEmpty
+	}
+	target := heatmapPositive
+	if value < 0 {
+		target = heatmapNegative
+	}
+	share := math.Min(math.Abs(value), 1)
+	mix := func(c uint8) uint8 {
+		return uint8(255 - share*(255-float64(c)))
+	}
+	return drawing.Color{R: mix(target.R), G: mix(target.G), B: mix(target.B), A: 255}
+}
+
+func truncateLabel(label string, max int) string {
+	runes := []rune(label)
+	if len(runes) <= max {
+		return label
+	}
+	return string(runes[:max-1]) + "…"
+}
@@ -0,0 +1,72 @@
+package plot
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/wcharczuk/go-chart/v2"
+	"github.com/wcharczuk/go-chart/v2/drawing"
+)
+
+// Доля сегмента, начиная с которой на нем пишется подпись: в узкий сегмент текст не помещается
+const stackedBarMinLabelShare = 0.06
+
+// DrawStackedBar рисует столбцы по 100%: каждый столбец — значение из bars, сегменты — доли segments внутри него.
+// counts[i][j] — число строк со значением bars[i] и segments[j]. Легенды у такого графика нет,
+// поэтому название сегмента и процент пишутся на самом сегменте; цвет сегмента одинаков во всех столбцах
+func DrawStackedBar(bars, segments []string, counts [][]int64, title string) ([]byte, error) {
+	if len(bars) == 0 || len(segments) == 0 || len(counts) != len(bars) {
+		return nil, fmt.Errorf("stacked bar needs %d rows of %d counts", len(bars), len(segments))
+	}
+	stacked := make([]chart.StackedBar, 0, len(bars))
+	for i, name := range bars {
+		if len(counts[i]) != len(segments) {
+			return nil, fmt.Errorf("stacked bar needs %d rows of %d counts", len(bars), len(segments))
+		}
+		var total int64
+		for _, count := range counts[i] {
+			total += count
+		}
+		if total == 0 {
+			continue
+		}
+		bar := chart.StackedBar{Name: truncateLabel(name, heatmapMaxLabelRunes), Width: 90}
+		for j, count := range counts[i] {
+			share := float64(count) / float64(total)
+			value := chart.Value{Value: share}
+			if share >= stackedBarMinLabelShare {
+				value.Label = fmt.Sprintf("%s %.0f%%", truncateLabel(segments[j], 12), share*100)
+			}
+			bar.Values = append(bar.Values, value)
+		}
+		stacked = append(stacked, bar)
+	}
+	if len(stacked) == 0 {
+		return nil, fmt.Errorf("stacked bar has no data")
+	}
+
+	graph := chart.StackedBarChart{
+		Title:      title,
+		TitleStyle: chart.Style{FontSize: 14},
+		Background: chart.Style{
+			FillColor: drawing.ColorWhite,
+			Padding:   chart.Box{Top: 60, Left: 20, Right: 20, Bottom: 20},
+		},
+		Width:      len(stacked)*110 + 120,
+		Height:     800,
+		BarSpacing: 20,
+		// Перенос по словам зацикливается на слове шире столбца, например "Санкт-Петербург"
+		XAxis: chart.Style{FontSize: 10, TextWrap: chart.TextWrapRune},
+		YAxis: chart.Style{FontSize: 10},
+		Bars:  stacked,
+	}
+	if graph.Width < 500 {
+		graph.Width = 500
+	}
+
+	buffer := bytes.NewBuffer([]byte{})
+	if err := graph.Render(chart.PNG, buffer); err != nil {
+		return nil, fmt.Errorf("error rendering chart: %v", err)
+	}
+	return buffer.Bytes(), nil
+}
@@ -0,0 +1,252 @@
+// row_quarantine.go
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pivolan/stats_analyzer/domain/models"
+	"gorm.io/gorm"
+)
+
+// Строки, которые не подходят под типы колонок или имеют другое число полей, не ломают импорт,
+// а откладываются в таблицу <таблица>_rejected: номер строки в файле, исходный текст и причина
+
+const (
+	REJECT_WRONG_COLUMN_COUNT = "wrong column count"
+
+	maxRejectReasons    = 10     // сколько причин перечисляется в сводке, остальные считаются одной суммой
+	maxRejectedExport   = 100000 // сколько отклоненных строк попадает в файл для скачивания
+	rejectedTableSuffix = "_rejected"
+)
+
+// rowPosition реализуют источники, которые знают, откуда взята последняя прочитанная строка.
+// raw может быть пустым, тогда исходный текст собирается из значений
+type rowPosition interface {
+	Position() (line int64, raw string)
+}
+
+// rejectedReason — число отклоненных строк по одной причине
+type rejectedReason struct {
+	Reason string
+	Count  int64
+}
+
+// rowQuarantine пишет отклоненные строки пакетами в отдельную таблицу; таблица создается при первой такой строке.
+// При дописывании в существующую таблицу отклоненные строки прошлых загрузок сохраняются
+type rowQuarantine struct {
+	db        DBInterface
+	tableName string
+	keep      bool
+	inserter  *batchInserter
+	buffer    *bytes.Buffer
+	writer    *csv.Writer
+	counts    map[string]int64
+	total     int64
+}
+
+func newRowQuarantine(db DBInterface, tableName string, keep bool) *rowQuarantine {
+	return &rowQuarantine{db: db, tableName: rejectedTableName(tableName), keep: keep, counts: map[string]int64{}}
+}
+
+func rejectedTableName(tableName string) string {
+	return tableName + rejectedTableSuffix
+}
+
+// Reject откладывает строку с номером line и исходным текстом raw
+func (q *rowQuarantine) Reject(line int64, reason, raw string) error {
+	if q.inserter == nil {
+		if err := q.create(); err != nil {
+			return err
+		}
+	}
+	q.counts[reason]++
+	q.total++
+	q.writer.Write([]string{strconv.FormatInt(line, 10), reason, truncateUTF8(raw, maxColumnLength)})
+	q.writer.Flush()
+	if q.buffer.Len() > maxBatchSize {
+		return q.flush()
+	}
+	return nil
+}
+
+func (q *rowQuarantine) create() error {
+	if !q.keep {
+		if tx := q.db.Exec("DROP TABLE IF EXISTS " + q.tableName); tx.Error != nil {
+			return tx.Error
+		}
+	}
+	tx := q.db.Exec("CREATE TABLE IF NOT EXISTS " + q.tableName + " (line UInt64, reason String, raw String) ENGINE = MergeTree ORDER BY line")
+	if tx.Error != nil {
+		return tx.Error
+	}
+	q.inserter = newBatchInserter(newRowInserter(q.db), q.tableName, 1)
+	q.buffer = &bytes.Buffer{}
+	q.writer = csv.NewWriter(q.buffer)
+	return nil
+}
+
+func (q *rowQuarantine) flush() error {
+	if q.buffer.Len() == 0 {
+		return nil
+	}
+	batch := append([]byte(nil), q.buffer.Bytes()...)
+	q.buffer.Reset()
+	return q.inserter.Send(batch)
+}
+
+// Close дописывает оставшиеся строки и дожидается вставки
+func (q *rowQuarantine) Close() error {
+	if q.inserter == nil {
+		return nil
+	}
+	err := q.flush()
+	if waitErr := q.inserter.Wait(); err == nil {
+		err = waitErr
+	}
+	return err
+}
+
+// Reasons возвращает причины по убыванию числа строк
+func (q *rowQuarantine) Reasons() []rejectedReason {
+	reasons := make([]rejectedReason, 0, len(q.counts))
+	for reason, count := range q.counts {
+		reasons = append(reasons, rejectedReason{Reason: reason, Count: count})
+	}
+	sort.Slice(reasons, func(i, j int) bool {
+		if reasons[i].Count != reasons[j].Count {
+			return reasons[i].Count > reasons[j].Count
+		}
+		return reasons[i].Reason < reasons[j].Reason
+	})
+	return reasons
+}
+
+// rowRejectReason проверяет уже приведенные значения строки и возвращает причину отказа или "".
+// labels — названия колонок для причины, как в исходном файле
+func rowRejectReason(labels, types []string, values []string) string {
+	if len(values) != len(labels) {
+		return REJECT_WRONG_COLUMN_COUNT
+	}
+	for k, v := range values {
+		if problem := valueProblem(types[k], v); problem != "" {
+			return problem + " in " + labels[k]
+		}
+	}
+	return ""
+}
+
+// valueProblem проверяет, что ClickHouse примет значение для колонки этого типа
+func valueProblem(columnType, value string) string {
+	if value == "" {
+		return ""
+	}
+	switch t := unwrapNullable(columnType); {
+	case t == "Int64":
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			return "non-numeric"
+		}
+	case t == "Float64" || IsDecimalType(t):
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return "non-numeric"
+		}
+	case t == "Date":
+		if _, err := time.Parse("2006-01-02", value); err != nil {
+			return "bad date"
+		}
+	case t == "DateTime64":
+		if _, err := time.Parse("2006-01-02 15:04:05.999999", value); err != nil {
+			return "bad date"
+		}
+	case t == "Bool":
+		if value != "true" && value != "false" {
+			return "not a boolean"
+		}
+	case t == "UUID":
+		if !uuidPattern.MatchString(value) {
+			return "bad uuid"
+		}
+	case t == "IPv4":
+		if ip := net.ParseIP(value); ip == nil || strings.Contains(value, ":") {
+			return "bad ip"
+		}
+	case t == "IPv6":
+		if net.ParseIP(value) == nil {
+			return "bad ip"
+		}
+	}
+	return ""
+}
+
+// csvLine собирает исходный текст строки из значений для источников без текстового представления
+func csvLine(values []string) string {
+	var b strings.Builder
+	w := csv.NewWriter(&b)
+	w.Write(values)
+	w.Flush()
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// formatRejectedSummary: "312 rows rejected: 290 non-numeric in amount, 22 wrong column count"
+func formatRejectedSummary(reasons []rejectedReason) string {
+	var total, other int64
+	parts := []string{}
+	for i, reason := range reasons {
+		total += reason.Count
+		if i < maxRejectReasons {
+			parts = append(parts, fmt.Sprintf("%d %s", reason.Count, reason.Reason))
+		} else {
+			other += reason.Count
+		}
+	}
+	if total == 0 {
+		return ""
+	}
+	if other > 0 {
+		parts = append(parts, fmt.Sprintf("%d other", other))
+	}
+	return fmt.Sprintf("%d rows rejected: %s", total, strings.Join(parts, ", "))
+}
+
+// loadRejectedReasons читает сводку по таблице отклоненных строк; если таблицы нет, строк не было
+func loadRejectedReasons(db *gorm.DB, tableName models.ClickhouseTableName) ([]rejectedReason, error) {
+	rejected := rejectedTableName(string(tableName))
+	var exists int64
+	if err := db.Raw("SELECT count() FROM system.tables WHERE database = currentDatabase() AND name = ?", rejected).Scan(&exists).Error; err != nil {
+		return nil, err
+	}
+	if exists == 0 {
+		return nil, nil
+	}
+	var reasons []rejectedReason
+	err := db.Raw("SELECT reason, count() AS count FROM " + rejected + " GROUP BY reason ORDER BY count DESC, reason").Scan(&reasons).Error
+	return reasons, err
+}
+
+// exportRejectedRows выгружает отклоненные строки в CSV: номер строки, причина, исходный текст
+func exportRejectedRows(db *gorm.DB, tableName models.ClickhouseTableName) ([]byte, error) {
+	rows, err := db.Raw(fmt.Sprintf("SELECT line, reason, raw FROM %s ORDER BY line LIMIT %d", rejectedTableName(string(tableName)), maxRejectedExport)).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+	w.Write([]string{"line", "reason", "raw"})
+	for rows.Next() {
+		var line int64
+		var reason, raw string
+		if err := rows.Scan(&line, &reason, &raw); err != nil {
+			return nil, err
+		}
+		w.Write([]string{strconv.FormatInt(line, 10), reason, raw})
+	}
+	w.Flush()
+	return b.Bytes(), rows.Err()
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/gorm"
+)
+
+func TestValueProblem(t *testing.T) {
+	testCases := []struct {
+		columnType string
+		value      string
+		expected   string
+	}{
+		{"Int64", "42", ""},
+		{"Int64", "n/a", "non-numeric"},
+		{"Nullable(Int64)", "", ""},
+		{"Decimal(18, 2)", "10.50", ""},
+		{"Float64", "1,5", "non-numeric"},
+		{"Date", "2024-01-02", ""},
+		{"Date", "soon", "bad date"},
+		{"DateTime64", "2024-01-02 10:00:00.5", ""},
+		{"Bool", "maybe", "not a boolean"},
+		{"UUID", "123", "bad uuid"},
+		{"IPv4", "::1", "bad ip"},
+		{"IPv6", "::ffff:10.0.0.1", ""},
+		{"String", "anything", ""},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.expected, valueProblem(tc.columnType, tc.value), tc.columnType+" "+tc.value)
+	}
+}
+
+func TestFormatRejectedSummary(t *testing.T) {
+	assert.Equal(t, "", formatRejectedSummary(nil))
+	assert.Equal(t, "312 rows rejected: 290 non-numeric in amount, 22 wrong column count", formatRejectedSummary([]rejectedReason{
+		{Reason: "non-numeric in amount", Count: 290},
+		{Reason: REJECT_WRONG_COLUMN_COUNT, Count: 22},
+	}))
+
+	many := []rejectedReason{}
+	for i := 0; i < maxRejectReasons+2; i++ {
+		many = append(many, rejectedReason{Reason: fmt.Sprintf("bad date in d%d", i), Count: 1})
+	}
+	assert.True(t, strings.HasSuffix(formatRejectedSummary(many), ", 2 other"))
+}
+
+func TestInferColumnTypesToleratesStrays(t *testing.T) {
+	rows := make([][]string, 300)
+	for i := range rows {
+		rows[i] = []string{fmt.Sprint(i * 10)}
+	}
+	rows[5] = []string{"n/a"}
+	types, _, _ := inferColumnTypes(&sliceRowReader{rows: rows}, 1)
+	assert.Equal(t, "Int64", types[0])
+
+	for i := 0; i < 10; i++ {
+		rows[i*10] = []string{"n/a"}
+	}
+	types, _, _ = inferColumnTypes(&sliceRowReader{rows: rows}, 1)
+	assert.Equal(t, "String", types[0])
+}
+
+func TestImportRejectsBadRows(t *testing.T) {
+	original := getMD5String
+	getMD5String = func(input string) string {
+		return "123456"
+	}
+	defer func() {
+		getMD5String = original
+	}()
+
+	var content strings.Builder
+	content.WriteString("name,amount\n")
+	for i := 0; i < 200; i++ {
+		content.WriteString(fmt.Sprintf("item %d,%d\n", i, i))
+	}
+	content.WriteString("broken,n/a\n")
+	content.WriteString("\"multi\nline\",7,extra\n")
+	filePath := filepath.Join(t.TempDir(), "orders.csv")
+	assert.NoError(t, os.WriteFile(filePath, []byte(content.String()), 0644))
+
+	mockDB := NewMockDB()
+	mockDB.On("Exec", mock.Anything, mock.Anything).Return(&gorm.DB{})
+	tables, err := importFileIntoClickHouse(filePath, mockDB, importOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "0001_name_0002_amount_123456", string(tables[0].Name))
+
+	var queries []string
+	for _, call := range mockDB.Calls {
+		queries = append(queries, call.Arguments.String(0))
+	}
+	all := strings.Join(queries, "\n")
+	assert.Contains(t, all, "0002_amount Int64")
+	assert.Contains(t, all, "CREATE TABLE IF NOT EXISTS 0001_name_0002_amount_123456_rejected (line UInt64, reason String, raw String)")
+	assert.Contains(t, mockDB.lastQuery, "INSERT INTO 0001_name_0002_amount_123456_rejected SETTINGS max_query_size = 5048576, max_insert_block_size = 5000000 FORMAT CSV \n"+
+		"202,non-numeric in amount,\"broken,n/a\"\n"+
+		"203,wrong column count,\"\"\"multi\nline\"\",7,extra\"\n")
+	for _, query := range queries {
+		if strings.HasPrefix(query, "INSERT INTO 0001_name_0002_amount_123456 ") {
+			assert.NotContains(t, query, "broken")
+			assert.Contains(t, query, "200,item 199,199\n")
+		}
+	}
+}
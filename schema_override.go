@@ -0,0 +1,218 @@
+// schema_override.go
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pivolan/stats_analyzer/domain/models"
+)
+
+// columnSchema — типы колонок, которые пользователь исправил командой /cast: имя колонки → тип ClickHouse
+type columnSchema map[string]string
+
+// savedSchemas хранит исправленные типы каждого чата по отпечатку заголовков, чтобы повторная
+// загрузка той же выгрузки сразу получала правильные типы. Команды и загрузка через веб-форму
+// работают в разных горутинах, поэтому под мьютексом; на диске копия переживает перезапуск бота
+var savedSchemas = struct {
+	sync.RWMutex
+	chats map[int64]map[string]columnSchema
+}{chats: map[int64]map[string]columnSchema{}}
+
+// Файл с исправленными типами всех чатов. Таблицы ClickHouse для этого не подходят: бот удаляет их раз в час
+var savedSchemasFile = "saved_schemas.json"
+
+// castTypes — типы, к которым можно привести колонку, в записи без учета регистра
+var castTypes = map[string]string{
+	"string":                 "String",
+	"int64":                  "Int64",
+	"float64":                "Float64",
+	"date":                   "Date",
+	"datetime64":             "DateTime64",
+	"bool":                   "Bool",
+	"uuid":                   "UUID",
+	"ipv4":                   "IPv4",
+	"ipv6":                   "IPv6",
+	"lowcardinality(string)": "LowCardinality(String)",
+}
+
+var castDecimalPattern = regexp.MustCompile(`^(?i)decimal\((\d+),\s*(\d+)\)$`)
+
+// parseCastType приводит тип из команды к записи ClickHouse: "decimal(18,2)" → "Decimal(18, 2)"
+func parseCastType(value string) (string, bool) {
+	if columnType, ok := castTypes[strings.ToLower(value)]; ok {
+		return columnType, true
+	}
+	if m := castDecimalPattern.FindStringSubmatch(value); m != nil {
+		precision, _ := strconv.Atoi(m[1])
+		scale, _ := strconv.Atoi(m[2])
+		if precision >= 1 && precision <= 76 && scale <= precision {
+			return fmt.Sprintf("Decimal(%d, %d)", precision, scale), true
+		}
+	}
+	return "", false
+}
+
+// castTypesList — подсказка с допустимыми типами для сообщений бота
+func castTypesList() string {
+	names := make([]string, 0, len(castTypes)+1)
+	for _, columnType := range castTypes {
+		names = append(names, columnType)
+	}
+	sort.Strings(names)
+	return strings.Join(append(names, "Decimal(P, S)"), ", ")
+}
+
+// headerFingerprint — отпечаток набора колонок, не зависящий от имени файла и порядка строк
+func headerFingerprint(headers []string) string {
+	sorted := append([]string(nil), headers...)
+	sort.Strings(sorted)
+	sum := sha1.Sum([]byte(strings.Join(sorted, "\n")))
+	return hex.EncodeToString(sum[:8])
+}
+
+// isServiceColumn — колонки, которых нет в исходном файле: id, метка загрузки и вычисляемые колонки
+func isServiceColumn(column models.ColumnInfo) bool {
+	return column.Name == "id" || column.Name == LOAD_BATCH_COLUMN || column.DefaultType == "ALIAS"
+}
+
+// tableFingerprint считает отпечаток по колонкам таблицы без служебных колонок
+func tableFingerprint(columns []models.ColumnInfo) string {
+	headers := make([]string, 0, len(columns))
+	for _, column := range columns {
+		if isServiceColumn(column) {
+			continue
+		}
+		headers = append(headers, column.Name)
+	}
+	return headerFingerprint(headers)
+}
+
+// saveColumnType запоминает тип колонки для таблиц чата с таким же отпечатком и сохраняет все типы в файл
+func saveColumnType(chatId int64, fingerprint, column, columnType string) error {
+	savedSchemas.Lock()
+	defer savedSchemas.Unlock()
+	if savedSchemas.chats[chatId] == nil {
+		savedSchemas.chats[chatId] = map[string]columnSchema{}
+	}
+	if savedSchemas.chats[chatId][fingerprint] == nil {
+		savedSchemas.chats[chatId][fingerprint] = columnSchema{}
+	}
+	savedSchemas.chats[chatId][fingerprint][column] = columnType
+
+	data, err := json.Marshal(savedSchemas.chats)
+	if err != nil {
+		return err
+	}
+	// Запись через временный файл: при падении посреди записи остается прежняя версия
+	tmpPath := savedSchemasFile + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, savedSchemasFile)
+}
+
+// loadSavedSchemas читает исправленные типы при запуске бота; файла нет до первой команды /cast
+func loadSavedSchemas() error {
+	data, err := os.ReadFile(savedSchemasFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	chats := map[int64]map[string]columnSchema{}
+	if err := json.Unmarshal(data, &chats); err != nil {
+		return fmt.Errorf("%s: %v", savedSchemasFile, err)
+	}
+	savedSchemas.Lock()
+	defer savedSchemas.Unlock()
+	savedSchemas.chats = chats
+	return nil
+}
+
+// chatSchemas возвращает копию исправленных типов чата: импорт читает ее в своей горутине,
+// пока команда /cast может менять оригинал
+func chatSchemas(chatId int64) map[string]columnSchema {
+	savedSchemas.RLock()
+	defer savedSchemas.RUnlock()
+	result := make(map[string]columnSchema, len(savedSchemas.chats[chatId]))
+	for fingerprint, schema := range savedSchemas.chats[chatId] {
+		copied := make(columnSchema, len(schema))
+		for column, columnType := range schema {
+			copied[column] = columnType
+		}
+		result[fingerprint] = copied
+	}
+	return result
+}
+
+// applySchema заменяет угаданные типы сохраненными. Запись чисел и дат сохраняется, если колонка
+// остается числовой или датой; остальное для нового типа не имеет смысла
+func applySchema(schema columnSchema, headers, types []string, formats []columnFormat) {
+	for i, header := range headers {
+		columnType, ok := schema[header]
+		if !ok || columnType == types[i] {
+			continue
+		}
+		format := columnFormat{}
+		if IsNumericType(columnType) && IsNumericType(types[i]) {
+			format = columnFormat{DecimalComma: formats[i].DecimalComma, Unit: formats[i].Unit}
+		}
+		if isDateType(columnType) && isDateType(types[i]) {
+			format.DateLayouts = formats[i].DateLayouts
+		}
+		types[i], formats[i] = columnType, format
+	}
+}
+
+func isDateType(columnType string) bool {
+	return columnType == "Date" || columnType == "DateTime64"
+}
+
+// alterColumnSQL меняет тип колонки на месте, когда исходного файла уже нет. Nullable и комментарий сохраняются
+func alterColumnSQL(tableName models.ClickhouseTableName, column models.ColumnInfo, columnType string) string {
+	nullable := ""
+	if strings.Contains(column.Type, "Nullable(") {
+		nullable = " NULL "
+	}
+	return fmt.Sprintf("ALTER TABLE %s MODIFY COLUMN %s", tableName, columnDefinition(column.Name, columnType, nullable, column.Comment))
+}
+
+// formatSchema — список колонок таблицы с исходными названиями, типами и смыслом значений;
+// исправленные пользователем типы отмечены
+func formatSchema(tableName models.ClickhouseTableName, columns []models.ColumnInfo, schema columnSchema) string {
+	var result strings.Builder
+	result.WriteString("🧬 Типы колонок:\n\n")
+	example := ""
+	for _, column := range columns {
+		if isServiceColumn(column) {
+			continue
+		}
+		label := columnLabel(tableName, column.Name)
+		if example == "" {
+			example = label
+		}
+		mark := ""
+		if _, ok := schema[column.Name]; ok {
+			mark = " ✏️"
+		}
+		semantics := ""
+		if meta, ok := getColumnMeta(tableName, column.Name); ok && meta.Semantics != "" {
+			semantics = " · " + meta.Semantics
+		}
+		result.WriteString(fmt.Sprintf("%s — %s%s%s\n", label, column.Type, semantics, mark))
+	}
+	result.WriteString(fmt.Sprintf("\nИзменить тип: /cast %s String\n", example))
+	result.WriteString("Типы: " + castTypesList() + "\n")
+	result.WriteString("Исправленные типы запоминаются и применяются к следующим загрузкам файла с такими же колонками")
+	return result.String()
+}
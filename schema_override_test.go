@@ -0,0 +1,114 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pivolan/stats_analyzer/domain/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/gorm"
+)
+
+func TestParseCastType(t *testing.T) {
+	testCases := []struct {
+		value    string
+		expected string
+		ok       bool
+	}{
+		{"String", "String", true},
+		{"int64", "Int64", true},
+		{"lowcardinality(string)", "LowCardinality(String)", true},
+		{"decimal(10,3)", "Decimal(10, 3)", true},
+		{"Decimal(2, 5)", "", false},
+		{"Array(String)", "", false},
+	}
+	for _, tc := range testCases {
+		columnType, ok := parseCastType(tc.value)
+		assert.Equal(t, tc.ok, ok, tc.value)
+		assert.Equal(t, tc.expected, columnType, tc.value)
+	}
+}
+
+func TestApplySchema(t *testing.T) {
+	headers := []string{"0001_zip", "0002_price", "0003_ts"}
+	types := []string{"Int64", "Float64", "Int64"}
+	formats := []columnFormat{{Unit: "₽"}, {DecimalComma: true, Unit: "₽"}, {Epoch: EPOCH_SECONDS}}
+	applySchema(columnSchema{"0001_zip": "String", "0002_price": "Decimal(18, 2)", "0003_ts": "Int64"}, headers, types, formats)
+	assert.Equal(t, []string{"String", "Decimal(18, 2)", "Int64"}, types)
+	assert.Equal(t, []columnFormat{{}, {DecimalComma: true, Unit: "₽"}, {Epoch: EPOCH_SECONDS}}, formats)
+}
+
+func TestTableFingerprintMatchesHeaders(t *testing.T) {
+	columns := []models.ColumnInfo{
+		{Name: "id", Type: "UInt64"},
+		{Name: "0001_name", Type: "String"},
+		{Name: "0002_ts", Type: "Int64"},
+		{Name: "0002_ts_datetime", Type: "DateTime", DefaultType: "ALIAS"},
+	}
+	assert.Equal(t, headerFingerprint([]string{"0001_name", "0002_ts"}), tableFingerprint(columns))
+	assert.NotEqual(t, headerFingerprint([]string{"0001_name", "0002_zip"}), tableFingerprint(columns))
+}
+
+func TestAlterColumnSQL(t *testing.T) {
+	assert.Equal(t, "ALTER TABLE orders MODIFY COLUMN 0003_zip String  NULL ",
+		alterColumnSQL("orders", models.ColumnInfo{Name: "0003_zip", Type: "Nullable(Int64)"}, "String"))
+	assert.Equal(t, "ALTER TABLE orders MODIFY COLUMN 0001_id String ",
+		alterColumnSQL("orders", models.ColumnInfo{Name: "0001_id", Type: "Float64"}, "String"))
+}
+
+func TestImportAppliesSavedSchema(t *testing.T) {
+	original := getMD5String
+	getMD5String = func(input string) string {
+		return "123456"
+	}
+	defer func() {
+		getMD5String = original
+	}()
+
+	filePath := filepath.Join(t.TempDir(), "addresses.csv")
+	assert.NoError(t, os.WriteFile(filePath, []byte("city,zip\nBoston,02108\nNew York,10001\n"), 0644))
+
+	schemas := map[string]columnSchema{
+		headerFingerprint([]string{"0001_city", "0002_zip"}): {"0002_zip": "String"},
+	}
+	mockDB := NewMockDB()
+	mockDB.On("Exec", mock.Anything, mock.Anything).Return(&gorm.DB{})
+	_, err := importFileIntoClickHouse(filePath, mockDB, importOptions{Schemas: schemas})
+	assert.NoError(t, err)
+
+	createSQL := ""
+	for _, call := range mockDB.Calls {
+		if query := call.Arguments.String(0); strings.HasPrefix(query, "CREATE TABLE") {
+			createSQL = query
+		}
+	}
+	assert.Contains(t, createSQL, "0002_zip String")
+	assert.Contains(t, mockDB.lastQuery, "1,Boston,02108\n2,New York,10001\n")
+}
+
+func TestSavedSchemasSurviveRestart(t *testing.T) {
+	original := savedSchemasFile
+	savedSchemasFile = filepath.Join(t.TempDir(), "saved_schemas.json")
+	defer func() {
+		savedSchemasFile = original
+		savedSchemas.chats = map[int64]map[string]columnSchema{}
+	}()
+
+	assert.NoError(t, loadSavedSchemas())
+	assert.NoError(t, saveColumnType(42, "abc", "0002_zip", "String"))
+	assert.NoError(t, saveColumnType(42, "abc", "0003_price", "Decimal(18, 2)"))
+
+	// Копия для импорта не меняется от следующих команд /cast
+	schemas := chatSchemas(42)
+	assert.NoError(t, saveColumnType(42, "abc", "0002_zip", "Int64"))
+	assert.Equal(t, "String", schemas["abc"]["0002_zip"])
+
+	savedSchemas.chats = map[int64]map[string]columnSchema{}
+	assert.Empty(t, chatSchemas(42))
+	assert.NoError(t, loadSavedSchemas())
+	assert.Equal(t, map[string]columnSchema{"abc": {"0002_zip": "Int64", "0003_price": "Decimal(18, 2)"}}, chatSchemas(42))
+	assert.Empty(t, chatSchemas(7))
+}
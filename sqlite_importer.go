@@ -0,0 +1,337 @@
+// sqlite_importer.go
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pivolan/go_utils"
+	"github.com/pivolan/stats_analyzer/domain/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+var sqliteMagic = []byte("SQLite format 3\x00")
+
+// sqliteColumn описывает колонку из PRAGMA table_info
+type sqliteColumn struct {
+	Cid     int
+	Name    string
+	Type    string
+	NotNull bool `gorm:"column:notnull"`
+	Pk      int
+}
+
+// sqliteRowReader читает строки таблицы SQLite и приводит значения к текстовому виду
+type sqliteRowReader struct {
+	rows   *sql.Rows
+	values []interface{}
+}
+
+func (r *sqliteRowReader) Read() ([]string, error) {
+	if !r.rows.Next() {
+		if err := r.rows.Err(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+	pointers := make([]interface{}, len(r.values))
+	for i := range r.values {
+		pointers[i] = &r.values[i]
+	}
+	if err := r.rows.Scan(pointers...); err != nil {
+		return nil, err
+	}
+	row := make([]string, len(r.values))
+	for i, value := range r.values {
+		row[i] = sqliteValueString(value)
+	}
+	return row, nil
+}
+
+func sqliteValueString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	case []byte:
+		return string(v)
+	case string:
+		return v
+	case time.Time:
+		// Драйвер разбирает значения колонок DATE и DATETIME во время; дата без времени остается датой
+		v = v.UTC()
+		if v.Equal(v.Truncate(24 * time.Hour)) {
+			return v.Format("2006-01-02")
+		}
+		return v.Format("2006-01-02 15:04:05.999999")
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func isSQLiteFile(filePath string) bool {
+	return bytes.Equal(readMagic(filePath, len(sqliteMagic)), sqliteMagic)
+}
+
+// sqliteTableInfo — таблица базы SQLite и число строк в ней
+type sqliteTableInfo struct {
+	Name string
+	Rows int64
+}
+
+// sqliteSelectionError возвращается, когда в базе несколько таблиц, а пользователь еще не выбрал, какие загружать
+type sqliteSelectionError struct {
+	FilePath string
+	Tables   []sqliteTableInfo
+}
+
+func (e *sqliteSelectionError) Error() string {
+	return fmt.Sprintf("sqlite file has %d tables, select tables to import", len(e.Tables))
+}
+
+func openSQLite(filePath string) (*gorm.DB, func(), error) {
+	sqliteDB, err := gorm.Open(sqlite.Open("file:"+filePath+"?mode=ro"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot open sqlite file: %v", err)
+	}
+	closeDB := func() {}
+	if sqlDB, err := sqliteDB.DB(); err == nil {
+		closeDB = func() { sqlDB.Close() }
+	}
+	return sqliteDB, closeDB, nil
+}
+
+func quoteSQLiteName(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// listSQLiteTables — пользовательские таблицы базы по алфавиту с числом строк
+func listSQLiteTables(sqliteDB *gorm.DB) ([]sqliteTableInfo, error) {
+	var tableNames []string
+	err := sqliteDB.Raw("SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name").Scan(&tableNames).Error
+	if err != nil {
+		return nil, fmt.Errorf("cannot list sqlite tables: %v", err)
+	}
+	tables := make([]sqliteTableInfo, len(tableNames))
+	for i, name := range tableNames {
+		tables[i].Name = name
+		sqliteDB.Raw("SELECT count(*) FROM " + quoteSQLiteName(name)).Scan(&tables[i].Rows)
+	}
+	return tables, nil
+}
+
+// importSQLiteIntoClickHouse импортирует выбранные таблицы базы, каждую в отдельную таблицу ClickHouse.
+// Если таблица в базе одна, она загружается сразу; если несколько и выбора нет — возвращается sqliteSelectionError
+func importSQLiteIntoClickHouse(filePath string, db DBInterface, opts importOptions) ([]models.ImportedTable, error) {
+	sqliteDB, closeDB, err := openSQLite(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer closeDB()
+
+	available, err := listSQLiteTables(sqliteDB)
+	if err != nil {
+		return nil, err
+	}
+	if len(available) == 0 {
+		return nil, fmt.Errorf("sqlite file has no tables")
+	}
+	selected := available
+	if opts.SQLiteTables != nil {
+		selected = []sqliteTableInfo{}
+		for _, table := range available {
+			if go_utils.InArray(table.Name, opts.SQLiteTables) {
+				selected = append(selected, table)
+			}
+		}
+		if len(selected) == 0 {
+			return nil, fmt.Errorf("selected tables not found in sqlite file")
+		}
+	} else if len(available) > 1 {
+		return nil, &sqliteSelectionError{FilePath: filePath, Tables: available}
+	}
+
+	var tables []models.ImportedTable
+	for _, table := range selected {
+		opts.Progress.SetStage(table.Name)
+		tableName, inferred, err := importSQLiteTable(sqliteDB, table, filePath, db, opts)
+		if err != nil {
+			return nil, fmt.Errorf("table %s: %v", table.Name, err)
+		}
+		tables = append(tables, models.ImportedTable{
+			Name:   tableName,
+			Source: fmt.Sprintf("%s (%d строк)", table.Name, table.Rows),
+			Meta:   models.TableMeta{SQLiteTable: table.Name, InferredColumns: inferred},
+		})
+	}
+	return tables, nil
+}
+
+// importSQLiteTable загружает одну таблицу. Типы колонок берутся из объявленных в базе по правилам
+// совместимости типов SQLite. SQLite хранит в колонке значения любого типа, поэтому если значения не подходят
+// под объявленный тип, а также у колонок без типа и BLOB, тип определяется по самим значениям, как у CSV
+func importSQLiteTable(sqliteDB *gorm.DB, table sqliteTableInfo, filePath string, db DBInterface, opts importOptions) (models.ClickhouseTableName, []string, error) {
+	quoted := quoteSQLiteName(table.Name)
+
+	var columns []sqliteColumn
+	if err := sqliteDB.Raw("PRAGMA table_info(" + quoted + ")").Scan(&columns).Error; err != nil {
+		return "", nil, err
+	}
+	if len(columns) == 0 {
+		return "", nil, fmt.Errorf("no columns")
+	}
+
+	headers := make([]string, len(columns))
+	labels := make([]string, len(columns))
+	types := make([]string, len(columns))
+	nullables := make([]string, len(columns))
+	for i, column := range columns {
+		headers[i] = cleanHeaderName(column.Name, i)
+		labels[i] = column.Name
+		types[i] = affinityToClickHouseType(column.Type)
+		// INTEGER PRIMARY KEY — псевдоним rowid и NULL не содержит, даже если NOT NULL не указан
+		if !column.NotNull && !(column.Pk > 0 && strings.EqualFold(strings.TrimSpace(column.Type), "INTEGER")) {
+			nullables[i] = " NULL "
+		}
+	}
+	headers = addNumberPrefix(ValidateHeaders(headers))
+
+	// Проверяем, что значения подходят под объявленные типы
+	rows, err := sqliteDB.Raw("SELECT * FROM " + quoted).Rows()
+	if err != nil {
+		return "", nil, err
+	}
+	fits := checkDeclaredTypes(&sqliteRowReader{rows: rows, values: make([]interface{}, len(columns))}, types)
+	rows.Close()
+	allFit := true
+	for _, fit := range fits {
+		allFit = allFit && fit
+	}
+
+	var inferred []string
+	var formats []columnFormat
+	if !allFit {
+		rows, err = sqliteDB.Raw("SELECT * FROM " + quoted).Rows()
+		if err != nil {
+			return "", nil, err
+		}
+		var valueTypes []string
+		valueTypes, _, formats = inferColumnTypes(&sqliteRowReader{rows: rows, values: make([]interface{}, len(columns))}, len(columns))
+		rows.Close()
+		for i, column := range columns {
+			if fits[i] {
+				formats[i] = columnFormat{}
+				continue
+			}
+			if types[i] != "" {
+				inferred = append(inferred, fmt.Sprintf("%s.%s: значения не подходят под объявленный тип %s, тип определен по значениям (%s)",
+					table.Name, column.Name, column.Type, valueTypes[i]))
+			}
+			types[i] = valueTypes[i]
+		}
+	}
+
+	rows, err = sqliteDB.Raw("SELECT * FROM " + quoted).Rows()
+	if err != nil {
+		return "", nil, err
+	}
+	defer rows.Close()
+
+	opts.Progress.Track(0, nil)
+	reader := opts.Progress.CountRows(&sqliteRowReader{rows: rows, values: make([]interface{}, len(columns))})
+	tableName, err := importRows(db, filePath+"#"+table.Name, headers, labels, types, nullables, formats, reader, opts)
+	return tableName, inferred, err
+}
+
+var sqliteDecimalParams = regexp.MustCompile(`\((\d+)\s*(?:,\s*(\d+))?\s*\)`)
+
+// affinityToClickHouseType переводит объявленный тип колонки SQLite в тип ClickHouse по правилам
+// определения совместимости типов SQLite (https://www.sqlite.org/datatype3.html#determination_of_column_affinity).
+// Для колонок без типа и BLOB возвращает пустую строку: их тип определяется по значениям
+func affinityToClickHouseType(decl string) string {
+	upper := strings.ToUpper(strings.TrimSpace(decl))
+	switch {
+	case strings.Contains(upper, "INT"):
+		return "Int64"
+	case strings.Contains(upper, "CHAR") || strings.Contains(upper, "CLOB") || strings.Contains(upper, "TEXT"):
+		return "String"
+	case upper == "" || strings.Contains(upper, "BLOB"):
+		return ""
+	case strings.Contains(upper, "REAL") || strings.Contains(upper, "FLOA") || strings.Contains(upper, "DOUB"):
+		return "Float64"
+	case strings.Contains(upper, "BOOL"):
+		return "Bool"
+	case strings.Contains(upper, "DATETIME") || strings.Contains(upper, "TIMESTAMP"):
+		return "DateTime64"
+	case strings.Contains(upper, "DATE"):
+		return "Date"
+	}
+	// Остальное — NUMERIC: DECIMAL(p,s) и NUMERIC(p,s) хранятся точно, без точности — как дробные числа
+	if m := sqliteDecimalParams.FindStringSubmatch(upper); m != nil {
+		precision, _ := strconv.Atoi(m[1])
+		scale, _ := strconv.Atoi(m[2])
+		if precision >= 1 && precision <= 76 && scale <= precision {
+			return fmt.Sprintf("Decimal(%d, %d)", precision, scale)
+		}
+	}
+	return "Float64"
+}
+
+// checkDeclaredTypes просматривает все строки и отмечает колонки, значения которых ClickHouse примет
+// для объявленного типа. Колонка Date, в которой встречается время суток, становится DateTime64, чтобы время не потерялось
+func checkDeclaredTypes(r rowReader, types []string) []bool {
+	fits := make([]bool, len(types))
+	for i, columnType := range types {
+		fits[i] = columnType != ""
+	}
+	for {
+		values, err := r.Read()
+		if err != nil {
+			break
+		}
+		for i, value := range values {
+			if !fits[i] || value == "" {
+				continue
+			}
+			if types[i] == "Date" {
+				if t, ok := parseColumnDate(value, nil); ok && !t.Equal(t.Truncate(24*time.Hour)) {
+					types[i] = "DateTime64"
+				}
+			}
+			fits[i] = declaredValueFits(types[i], value)
+		}
+	}
+	return fits
+}
+
+// declaredValueFits проверяет значение так же, как его проверит импорт; у Decimal дополнительно
+// число цифр не должно превышать точность типа
+func declaredValueFits(columnType, value string) bool {
+	value = normalizeValue(columnType, columnFormat{}, value)
+	if valueProblem(columnType, value) != "" {
+		return false
+	}
+	if m := castDecimalPattern.FindStringSubmatch(strings.ReplaceAll(columnType, " ", "")); m != nil {
+		precision, _ := strconv.Atoi(m[1])
+		scale, _ := strconv.Atoi(m[2])
+		integer, fraction, _ := strings.Cut(strings.TrimLeft(value, "+-"), ".")
+		return len(strings.TrimLeft(integer, "0")) <= precision-scale && len(fraction) <= scale
+	}
+	return true
+}
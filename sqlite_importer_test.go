@@ -0,0 +1,113 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestImportSQLiteIntoClickHouse(t *testing.T) {
+	original := getMD5String
+	getMD5String = func(input string) string {
+		return "123456"
+	}
+	defer func() {
+		getMD5String = original
+	}()
+
+	filePath := filepath.Join(t.TempDir(), "shop.db")
+	source, err := gorm.Open(sqlite.Open(filePath), &gorm.Config{})
+	assert.NoError(t, err)
+	assert.NoError(t, source.Exec(`CREATE TABLE orders (id INTEGER PRIMARY KEY, customer TEXT NOT NULL, total REAL, created DATE)`).Error)
+	assert.NoError(t, source.Exec(`INSERT INTO orders VALUES (1, 'John', 10.5, '2024-01-01'), (2, 'Jane', NULL, '2024-01-02')`).Error)
+	assert.NoError(t, source.Exec(`CREATE TABLE customers (name VARCHAR(50), age INT)`).Error)
+	assert.NoError(t, source.Exec(`INSERT INTO customers VALUES ('John', 30)`).Error)
+	assert.NoError(t, source.Exec(`CREATE TABLE events (code INT, happened DATE, paid BOOL, amount DECIMAL(10,2), payload BLOB, note)`).Error)
+	assert.NoError(t, source.Exec(`INSERT INTO events VALUES ('A-1', 1704103200, 1, 12.5, 'x', 'a'), (2, 1704189600, 0, NULL, 'y', 'b')`).Error)
+	sqlDB, _ := source.DB()
+	sqlDB.Close()
+
+	assert.Equal(t, FORMAT_SQLITE, detectFileFormat(filePath))
+
+	mockDB := NewMockDB()
+	mockDB.On("Exec", mock.Anything, mock.Anything).Return(&gorm.DB{})
+	// Таблиц несколько: сначала пользователь выбирает, какие загружать
+	_, err = importFileIntoClickHouse(filePath, mockDB, importOptions{})
+	var selection *sqliteSelectionError
+	assert.ErrorAs(t, err, &selection)
+	assert.Equal(t, filePath, selection.FilePath)
+	assert.Equal(t, []sqliteTableInfo{{"customers", 1}, {"events", 2}, {"orders", 2}}, selection.Tables)
+	assert.Empty(t, mockDB.Calls)
+
+	tables, err := importFileIntoClickHouse(filePath, mockDB, importOptions{SQLiteTables: []string{"orders", "events"}})
+	assert.NoError(t, err)
+	assert.Len(t, tables, 2)
+	assert.Equal(t, "events (2 строк)", tables[0].Source)
+	assert.Equal(t, "orders (2 строк)", tables[1].Source)
+	assert.Equal(t, "orders", tables[1].Meta.SQLiteTable)
+
+	var creates, inserts []string
+	for _, call := range mockDB.Calls {
+		query := call.Arguments.String(0)
+		if strings.HasPrefix(query, "CREATE TABLE") {
+			creates = append(creates, query)
+		}
+		if strings.HasPrefix(query, "INSERT INTO") {
+			inserts = append(inserts, query)
+		}
+	}
+	assert.Len(t, creates, 2)
+	// Типы берутся из объявленных; текст в колонке INT не подходит под Int64, и ее тип определяется по значениям
+	assert.Contains(t, creates[0], "0001_code String  NULL ,")
+	assert.Contains(t, creates[0], "0002_happened DateTime64  NULL ,")
+	assert.Contains(t, creates[0], "0003_paid Bool  NULL ,")
+	assert.Contains(t, creates[0], "0004_amount Decimal(10, 2)  NULL ,")
+	assert.Contains(t, creates[0], "0005_payload String  NULL ,")
+	assert.Contains(t, creates[0], "0006_note String  NULL ")
+	assert.Contains(t, inserts[0], "1,A-1,2024-01-01 10:00:00,true,12.5,x,a\n2,2,2024-01-02 10:00:00,false,,y,b\n")
+	assert.Equal(t, []string{"events.code: значения не подходят под объявленный тип INT, тип определен по значениям (String)"},
+		tables[0].Meta.InferredColumns)
+	assert.Contains(t, creates[1], "0001_id Int64 ,")
+	assert.Contains(t, creates[1], "0002_customer String ,")
+	assert.Contains(t, creates[1], "0003_total Float64  NULL ,")
+	assert.Contains(t, creates[1], "0004_created Date  NULL ")
+	assert.Contains(t, inserts[1], "1,1,John,10.5,2024-01-01\n2,2,Jane,,2024-01-02\n")
+	assert.Empty(t, tables[1].Meta.InferredColumns)
+}
+
+func TestAffinityToClickHouseType(t *testing.T) {
+	tests := []struct {
+		decl     string
+		expected string
+	}{
+		{"INTEGER", "Int64"},
+		{"tinyint(1)", "Int64"},
+		{"BIGINT UNSIGNED", "Int64"},
+		{"REAL", "Float64"},
+		{"DOUBLE PRECISION", "Float64"},
+		{"FLOAT", "Float64"},
+		{"NUMERIC(12, 3)", "Decimal(12, 3)"},
+		{"DECIMAL(10)", "Decimal(10, 0)"},
+		{"NUMERIC", "Float64"},
+		{"VARCHAR(50)", "String"},
+		{"NATIVE CHARACTER(70)", "String"},
+		{"CLOB", "String"},
+		{"TEXT", "String"},
+		{"DATE", "Date"},
+		{"DATETIME", "DateTime64"},
+		{"TIMESTAMP", "DateTime64"},
+		{"BOOLEAN", "Bool"},
+		{"BLOB", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.decl, func(t *testing.T) {
+			assert.Equal(t, tt.expected, affinityToClickHouseType(tt.decl))
+		})
+	}
+}
@@ -41,6 +41,8 @@ func analyzeStatistics(tableName models.ClickhouseTableName) map[string]CommonSt
 	r2 := parseNumericResults(numericInfo)
 	r3 := parseCountResults(countInfo)
 	r := mergeStat(r1, r2, r3)
+	applyColumnUnits(r, columnsInfo)
+	applyColumnLabels(r, tableName, columnsInfo)
 	//generate by date fields
 	sqls3 := generateSqlForGroupByDates(columnsInfo, tableName)
 
@@ -97,14 +99,47 @@ func analyzeStatistics(tableName models.ClickhouseTableName) map[string]CommonSt
 
 	return r
 }
+
+// applyColumnLabels подставляет исходные названия колонок для сообщений со статистикой
+func applyColumnLabels(stats map[string]CommonStat, tableName models.ClickhouseTableName, columnsInfo []models.ColumnInfo) {
+	for _, column := range columnsInfo {
+		if stat, ok := stats[column.Name]; ok {
+			stat.Label = columnLabel(tableName, column.Name)
+			stats[column.Name] = stat
+		}
+	}
+}
+
+// titleLabel — название колонки для заголовка группировки; "//" разделяет части строки запроса
+func titleLabel(tableName models.ClickhouseTableName, column string) string {
+	return strings.ReplaceAll(columnLabel(tableName, column), "//", "/")
+}
+
+// applyColumnUnits переносит единицы измерения из комментариев колонок в статистику
+func applyColumnUnits(stats map[string]CommonStat, columnsInfo []models.ColumnInfo) {
+	for _, column := range columnsInfo {
+		stat, ok := stats[column.Name]
+		if unit := columnUnit(column.Comment); ok && unit != "" {
+			stat.Unit = unit
+			stats[column.Name] = stat
+		}
+	}
+}
+
 func generateSqlForGroups(columnInfos []models.ColumnInfo, uniqInfos map[string]CommonStat, table models.ClickhouseTableName) []string {
 	sqls := []string{}
 	groupedColumns := []string{}
 
 	for _, columnInfo := range columnInfos {
-		if columnInfo.Type == "String" || columnInfo.Type == "Nullable(String)" {
+		if IsIPType(columnInfo.Type) {
+			if uniqInfo, ok := uniqInfos[columnInfo.Name]; ok && uniqInfo.Uniq > 1 {
+				sqls = append(sqls, generateSqlForSubnets(columnInfo, table))
+			}
+		}
+		if IsCategoryType(columnInfo.Type) || IsIPType(columnInfo.Type) {
 			if uniqInfo, ok := uniqInfos[columnInfo.Name]; ok {
 				if uniqInfo.Uniq > 1 && uniqInfo.Uniq < 1000 {
+					title := titleLabel(table, columnInfo.Name)
 					// Modified SQL to include percentage and better formatting
 					mostFrequentSQL := fmt.Sprintf(`%s//Самые частые значения в %s//
                         SELECT 
@@ -116,7 +151,7 @@ func generateSqlForGroups(columnInfos []models.ColumnInfo, uniqInfos map[string]
                         GROUP BY %s 
                         ORDER BY count DESC 
                         LIMIT 10`,
-						columnInfo.Name, columnInfo.Name,
+						columnInfo.Name, title,
 						columnInfo.Name, table, table,
 						columnInfo.Name, columnInfo.Name)
 
@@ -131,7 +166,7 @@ func generateSqlForGroups(columnInfos []models.ColumnInfo, uniqInfos map[string]
                         HAVING count(*) > 1
                         ORDER BY count ASC 
                         LIMIT 10`,
-						columnInfo.Name, columnInfo.Name,
+						columnInfo.Name, title,
 						columnInfo.Name, table, table,
 						columnInfo.Name, columnInfo.Name)
 
@@ -177,6 +212,27 @@ func generateSqlForGroups(columnInfos []models.ColumnInfo, uniqInfos map[string]
 	return sqls
 }
 
+// generateSqlForSubnets группирует адреса по подсетям: /24 для IPv4, /48 для IPv6
+func generateSqlForSubnets(columnInfo models.ColumnInfo, table models.ClickhouseTableName) string {
+	subnet := fmt.Sprintf("IPv4NumToStringClassC(toUInt32(%s))", columnInfo.Name)
+	if strings.Contains(columnInfo.Type, "IPv6") {
+		subnet = fmt.Sprintf("toString(cutIPv6(%s, 10, 1))", columnInfo.Name)
+	}
+	return fmt.Sprintf(`%s_subnets//Самые частые подсети в %s//
+                        SELECT 
+                            count(*) as count,
+                            %s as value,
+                            (count(*) * 100.0 / (SELECT count(*) FROM %s)) as percentage
+                        FROM %s 
+                        WHERE %s IS NOT NULL
+                        GROUP BY value 
+                        ORDER BY count DESC 
+                        LIMIT 10`,
+		columnInfo.Name, titleLabel(table, columnInfo.Name),
+		subnet, table, table,
+		columnInfo.Name)
+}
+
 // Add a new function to format the results nicely
 func formatValueFrequency(groups []map[string]interface{}) string {
 	var result strings.Builder
@@ -286,7 +342,7 @@ func findNumColomn(db *gorm.DB, table models.ClickhouseTableName) string {
 	SELECT name
 	FROM system.columns
 	WHERE table = '%s'
-	AND type IN ('Int8', 'Int16', 'Int32', 'Int64', 'Float32', 'Float64', 'Decimal')
+	AND (type IN ('Int8', 'Int16', 'Int32', 'Int64', 'Float32', 'Float64') OR startsWith(type, 'Decimal'))
 	LIMIT 1`, table)
 	err := db.Raw(numericColSQL).Scan(&numericColumn).Error
 	if err != nil {
@@ -16,7 +16,7 @@ func TestAnalyzeStatistics(t *testing.T) {
 	//groups
 }
 func TestCSV(t *testing.T) {
-	results, _ := handleFile("/Users/igorpecenikin/Downloads/a.csv")
+	results, _ := handleFile("/Users/igorpecenikin/Downloads/a.csv", importOptions{})
 	data, _ := json.MarshalIndent(results, "", "\t")
 	fmt.Printf("%+v\n", string(data))
 }
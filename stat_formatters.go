@@ -11,8 +11,17 @@ import (
 	"strings"
 
 	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/pivolan/stats_analyzer/domain/models"
 )
 
+// statLabel — название колонки в сообщении: исходное из файла или SQL имя без номера
+func statLabel(name string, stat CommonStat) string {
+	if stat.Label != "" {
+		return stat.Label
+	}
+	return displayColumnName(name)
+}
+
 func GenerateCommonInfoMsg(stats map[string]CommonStat) string {
 	var result strings.Builder
 
@@ -25,31 +34,53 @@ func GenerateCommonInfoMsg(stats map[string]CommonStat) string {
 	result.WriteString("📈 Numeric Columns:\n")
 	for name, stat := range stats {
 		if stat.IsNumeric {
-			columnName := name[5:]
+			columnName := statLabel(name, stat)
+			if stat.Unit != "" {
+				columnName += " (" + stat.Unit + ")"
+			}
 			result.WriteString(fmt.Sprintf("• %s\n", columnName))
 			result.WriteString(fmt.Sprintf("  Avg: %.2f\n", stat.Avg))
 			result.WriteString(fmt.Sprintf("  Median: %.2f\n", stat.Median))
 			result.WriteString(fmt.Sprintf("  90%% of values between: %.2f - %.2f\n", stat.Quantile01, stat.Quantile09))
+			if stat.Sum != "" {
+				result.WriteString(fmt.Sprintf("  Sum: %s\n", stat.Sum))
+			}
 			result.WriteString(fmt.Sprintf("  /graph_%s\n", name))
 		}
 	}
 	result.WriteString("\n")
 
+	// Boolean Columns
+	hasBools := false
+	for name, stat := range stats {
+		if stat.IsBool {
+			if !hasBools {
+				result.WriteString("✅ Boolean Columns:\n")
+				hasBools = true
+			}
+			result.WriteString(fmt.Sprintf("• %s: true in %.2f%%\n", statLabel(name, stat), stat.Rate*100))
+		}
+	}
+
 	// Text Columns
 	result.WriteString("\n📝 Text Columns:")
 	processedColumns := make(map[string]bool)
 	// isFirstColumn := true
 
 	for name, stat := range stats {
-		if !stat.IsNumeric && !strings.HasPrefix(name, "dates_") {
+		if !stat.IsNumeric && !stat.IsBool && !strings.HasPrefix(name, "dates_") {
 			baseName := strings.TrimPrefix(name, "0002_")
 			if processedColumns[baseName] {
 				continue
 			}
 
+			label := baseName
+			if stat.Label != "" {
+				label = stat.Label
+			}
 			if stat.Uniq > 0 {
 				result.WriteString(fmt.Sprintf("\n• %s (%d unique values); /details_%s\n",
-					baseName, stat.Uniq, name))
+					label, stat.Uniq, name))
 			}
 
 			// Самое частое значение
@@ -238,7 +269,9 @@ func GenerateGroupsTables(stats map[string]CommonStat) []string {
 	// Render the table and return it as a string
 	return result
 }
-func GenerateCSVByDates(stats map[string]CommonStat) map[string]string {
+
+// GenerateCSVByDates выгружает группировки по датам в CSV; колонки агрегатов подписываются исходными названиями
+func GenerateCSVByDates(stats map[string]CommonStat, tableName models.ClickhouseTableName) map[string]string {
 	result := map[string]string{}
 
 	// Loop over each key in the map and add a row to the table
@@ -260,7 +293,7 @@ func GenerateCSVByDates(stats map[string]CommonStat) map[string]string {
 		}
 		sort.Strings(header)
 		for _, columnName := range header {
-			fields = append(fields, columnName)
+			fields = append(fields, aggregateLabel(tableName, columnName))
 			mapRevert[columnName] = i
 			i++
 		}
@@ -284,6 +317,16 @@ func GenerateCSVByDates(stats map[string]CommonStat) map[string]string {
 	// Render the table and return it as a string
 	return result
 }
+
+// aggregateLabel подписывает колонку агрегата: "avg__0003_Summa_zakaza" → "avg Сумма заказа"
+func aggregateLabel(tableName models.ClickhouseTableName, column string) string {
+	parts := strings.SplitN(column, "__", 2)
+	if len(parts) != 2 || originalName(parts[1]) == parts[1] {
+		return column
+	}
+	return parts[0] + " " + columnLabel(tableName, parts[1])
+}
+
 func ZipArchive(csvs map[string]string) []byte {
 	var buffer bytes.Buffer
 
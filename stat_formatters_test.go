@@ -175,7 +175,7 @@ func TestGenerateCSVByDates(t *testing.T) {
 		},
 	}
 
-	results := GenerateCSVByDates(stats)
+	results := GenerateCSVByDates(stats, "")
 
 	if len(results) != 1 {
 		t.Errorf("Expected 1 CSV, got %d", len(results))
@@ -0,0 +1,273 @@
+// table_append.go
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pivolan/stats_analyzer/domain/models"
+	"gorm.io/gorm"
+)
+
+// LOAD_BATCH_COLUMN — колонка с меткой загрузки у таблиц, в которые дописываются файлы.
+// Номер 0000 оставляет ее первой в списке колонок, а в отчетах она показывается как load_batch
+const LOAD_BATCH_COLUMN = "0000_load_batch"
+
+// appendMode — чаты, в которых новые загрузки дописываются в таблицу, и эта таблица. Команды, загрузка
+// через веб-форму и удаление устаревших таблиц работают в разных горутинах, поэтому под мьютексом
+var appendMode = struct {
+	sync.RWMutex
+	chats map[int64]models.ClickhouseTableName
+}{chats: map[int64]models.ClickhouseTableName{}}
+
+// setAppendMode включает дописывание загрузок чата в таблицу tableName; пустое имя выключает его
+func setAppendMode(chatId int64, tableName models.ClickhouseTableName) {
+	appendMode.Lock()
+	defer appendMode.Unlock()
+	if tableName != "" {
+		appendMode.chats[chatId] = tableName
+	} else {
+		delete(appendMode.chats, chatId)
+	}
+}
+
+// appendTable — таблица, в которую дописываются загрузки чата, или пустая строка, если дописывание выключено
+func appendTable(chatId int64) models.ClickhouseTableName {
+	appendMode.RLock()
+	defer appendMode.RUnlock()
+	return appendMode.chats[chatId]
+}
+
+func isAppendMode(chatId int64) bool {
+	return appendTable(chatId) != ""
+}
+
+// followCurrentTable переносит дописывание на новую текущую таблицу чата, если оно включено
+func followCurrentTable(chatId int64, tableName models.ClickhouseTableName) {
+	appendMode.Lock()
+	defer appendMode.Unlock()
+	if _, ok := appendMode.chats[chatId]; ok {
+		appendMode.chats[chatId] = tableName
+	}
+}
+
+// isAppendTable — таблица, в которую дописывает загрузки какой-нибудь чат, или ее таблица отклоненных строк.
+// Такие таблицы не удаляются через час после загрузки, иначе следующий файл молча уйдет в новую таблицу
+func isAppendTable(tableName models.ClickhouseTableName) bool {
+	appendMode.RLock()
+	defer appendMode.RUnlock()
+	for _, target := range appendMode.chats {
+		if target == tableName || rejectedTableName(string(target)) == string(tableName) {
+			return true
+		}
+	}
+	return false
+}
+
+// appendTarget — существующая таблица, в которую дописывается загрузка
+type appendTarget struct {
+	Table        models.ClickhouseTableName
+	Columns      []models.ColumnInfo // колонки таблицы из DESCRIBE
+	NextID       int64               // наибольший id в таблице, новые строки нумеруются после него
+	InitialBatch string              // метка для строк, загруженных до появления load_batch
+}
+
+// appendPlan — как загрузка ложится на таблицу: ALTER запросы и колонки, в которые пишутся значения
+type appendPlan struct {
+	Alters  []string
+	Columns []string // колонка таблицы для каждого заголовка загрузки
+	Batch   string
+	table   models.ClickhouseTableName
+	after   []models.ColumnInfo // колонки таблицы после ALTER запросов
+}
+
+// Commit переносит изменения в target, чтобы следующая часть того же файла (лист, файл архива)
+// дописывалась уже в новую схему и продолжала нумерацию строк
+func (p *appendPlan) Commit(target *appendTarget, rows int64) {
+	target.Columns = p.after
+	target.NextID += rows
+}
+
+// InsertInto — таблица со списком колонок для INSERT: колонки, которых нет в файле, остаются NULL
+func (p *appendPlan) InsertInto() string {
+	columns := append(append([]string{"id"}, p.Columns...), LOAD_BATCH_COLUMN)
+	return fmt.Sprintf("%s (%s)", p.table, strings.Join(columns, ", "))
+}
+
+// originalName — SQL имя колонки без номера: "0003_zip" → "zip"
+func originalName(column string) string {
+	if len(column) > 5 && column[4] == '_' {
+		return column[5:]
+	}
+	return column
+}
+
+// splitColumnType разбирает тип из DESCRIBE на тип для сравнения и признак Nullable:
+// "LowCardinality(Nullable(String))" → "LowCardinality(String)", true; "DateTime64(3)" → "DateTime64"
+func splitColumnType(columnType string) (string, bool) {
+	nullable := strings.Contains(columnType, "Nullable(")
+	if strings.HasPrefix(columnType, "LowCardinality(") {
+		return "LowCardinality(String)", nullable
+	}
+	base := unwrapNullable(columnType)
+	if strings.HasPrefix(base, "DateTime64") {
+		base = "DateTime64"
+	}
+	return base, nullable
+}
+
+func isTextType(columnType string) bool {
+	return columnType == "String" || strings.HasPrefix(columnType, "LowCardinality(") || strings.HasPrefix(columnType, "Enum")
+}
+
+// widenType подбирает тип, в котором поместятся и старые, и новые значения:
+// Bool → Int64 → Float64, Date → DateTime64, IPv4 → IPv6, а несовместимые типы становятся текстом.
+// Int64 и UInt64 не вмещают друг друга и сходятся в Float64
+func widenType(existing, incoming string) string {
+	numeric := map[string]int{"Bool": 1, "Int64": 2, "UInt64": 2, "Float64": 3}
+	switch {
+	case incoming == "" || incoming == existing:
+		return existing
+	case strings.HasPrefix(existing, "Enum"):
+		// Новых значений в Enum может не быть
+		return "LowCardinality(String)"
+	case isTextType(existing):
+		return existing
+	case isTextType(incoming):
+		return "String"
+	case IsDecimalType(existing) || IsDecimalType(incoming):
+		// Decimal с другим масштабом или целые числа, которые могут не поместиться в точность
+		if (IsNumericType(existing) || IsBoolType(existing)) && (IsNumericType(incoming) || IsBoolType(incoming)) {
+			return "Float64"
+		}
+	case numeric[existing] > 0 && numeric[incoming] > 0:
+		switch {
+		case numeric[incoming] == numeric[existing]:
+			return "Float64"
+		case numeric[incoming] > numeric[existing]:
+			return incoming
+		}
+		return existing
+	case isDateType(existing) && isDateType(incoming):
+		return "DateTime64"
+	case IsIPType(existing) && IsIPType(incoming):
+		return "IPv6"
+	}
+	return "String"
+}
+
+// appendKey — ключ сопоставления колонок: исходное название без учета регистра и лишних пробелов.
+// SQL имена для этого не годятся: разные названия могут дать один транслит, а транслит зависит от номера
+func appendKey(label string) string {
+	return strings.ToLower(strings.Join(strings.Fields(label), " "))
+}
+
+// planAppend сопоставляет заголовки загрузки с колонками таблицы по исходным названиям. Совпавшие колонки
+// расширяются до общего типа, новые добавляются как Nullable, отсутствующие в файле становятся Nullable.
+// types заменяются итоговыми типами колонок, чтобы значения приводились к ним при вставке
+func planAppend(target *appendTarget, headers, labels, types, nullables []string, formats []columnFormat, filePath string) *appendPlan {
+	plan := &appendPlan{table: target.Table, Columns: make([]string, len(headers))}
+	plan.Batch = time.Now().Format("2006-01-02 15:04:05") + " " + filepath.Base(filePath)
+
+	existing := map[string]models.ColumnInfo{}
+	last := 0
+	hasBatch := false
+	for _, column := range target.Columns {
+		if column.Name == LOAD_BATCH_COLUMN {
+			hasBatch = true
+		}
+		if isServiceColumn(column) {
+			continue
+		}
+		existing[appendKey(columnLabel(target.Table, column.Name))] = column
+		if number, err := strconv.Atoi(strings.SplitN(column.Name, "_", 2)[0]); err == nil && number > last {
+			last = number
+		}
+	}
+	if !hasBatch {
+		plan.Alters = append(plan.Alters, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s LowCardinality(String) DEFAULT '%s'",
+			target.Table, LOAD_BATCH_COLUMN, strings.ReplaceAll(target.InitialBatch, "'", "\\'")))
+		plan.after = append(plan.after, models.ColumnInfo{Name: LOAD_BATCH_COLUMN, Type: "LowCardinality(String)"})
+	}
+	changed := map[string]string{}
+
+	matched := map[string]bool{}
+	for i, header := range headers {
+		name := appendKey(labels[i])
+		column, ok := existing[name]
+		if !ok {
+			// Новая колонка: у старых строк значений нет
+			last++
+			plan.Columns[i] = fmt.Sprintf("%04d_%s", last, originalName(header))
+			plan.Alters = append(plan.Alters, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s", target.Table,
+				columnDefinition(plan.Columns[i], types[i], " NULL ", columnComment(plan.Columns[i], labels[i], formats[i].Unit))))
+			plan.after = append(plan.after, models.ColumnInfo{Name: plan.Columns[i], Type: "Nullable(" + types[i] + ")"})
+			continue
+		}
+		matched[name] = true
+		plan.Columns[i] = column.Name
+		base, nullable := splitColumnType(column.Type)
+		widened := widenType(base, types[i])
+		if widened != base || (!nullable && strings.TrimSpace(nullables[i]) != "") {
+			plan.Alters = append(plan.Alters, alterColumnSQL(target.Table, models.ColumnInfo{Name: column.Name, Type: nullableType(column.Type, nullables[i]), Comment: column.Comment}, widened))
+			changed[column.Name] = widened
+			if nullable || strings.TrimSpace(nullables[i]) != "" {
+				changed[column.Name] = "Nullable(" + widened + ")"
+			}
+		}
+		if IsBoolType(types[i]) && IsNumericType(widened) {
+			formats[i].BoolAsNumber = true
+		}
+		types[i] = widened
+	}
+
+	// Колонки таблицы, которых нет в загрузке, получат NULL, а не 0 или пустую строку
+	for _, column := range target.Columns {
+		key := appendKey(columnLabel(target.Table, column.Name))
+		if existing[key] != column || matched[key] {
+			continue
+		}
+		if base, nullable := splitColumnType(column.Type); !nullable {
+			plan.Alters = append(plan.Alters, alterColumnSQL(target.Table, models.ColumnInfo{Name: column.Name, Type: "Nullable(" + base + ")", Comment: column.Comment}, base))
+			changed[column.Name] = "Nullable(" + base + ")"
+		}
+	}
+	for _, column := range target.Columns {
+		if columnType, ok := changed[column.Name]; ok {
+			column.Type = columnType
+		}
+		plan.after = append(plan.after, column)
+	}
+	return plan
+}
+
+// loadAppendTarget читает колонки и последний id таблицы, в которую дописывается загрузка
+func loadAppendTarget(db *gorm.DB, tableName models.ClickhouseTableName) (*appendTarget, error) {
+	columns, err := getColumnAndTypeList(db, tableName)
+	if err != nil {
+		return nil, err
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("table %s not found", tableName)
+	}
+	target := &appendTarget{Table: tableName, Columns: columns, InitialBatch: "первая загрузка"}
+	if source := getTableMeta(tableName).SourcePath; source != "" {
+		target.InitialBatch = filepath.Base(source)
+	}
+	if err := db.Raw(fmt.Sprintf("SELECT max(id) FROM %s", tableName)).Scan(&target.NextID).Error; err != nil {
+		return nil, err
+	}
+	return target, nil
+}
+
+// nullableType отмечает тип как Nullable, если в загрузке у колонки есть пустые значения
+func nullableType(columnType, nullable string) string {
+	if strings.TrimSpace(nullable) == "" || strings.Contains(columnType, "Nullable(") {
+		return columnType
+	}
+	return "Nullable(" + columnType + ")"
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pivolan/stats_analyzer/domain/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/gorm"
+)
+
+func TestWidenType(t *testing.T) {
+	testCases := []struct {
+		existing string
+		incoming string
+		expected string
+	}{
+		{"Int64", "Int64", "Int64"},
+		{"Int64", "Float64", "Float64"},
+		{"Float64", "Int64", "Float64"},
+		{"Int64", "String", "String"},
+		{"Int64", "", "Int64"},
+		{"Decimal(18, 2)", "Decimal(18, 4)", "Float64"},
+		{"Date", "DateTime64", "DateTime64"},
+		{"Date", "Int64", "String"},
+		{"IPv4", "IPv6", "IPv6"},
+		{"Enum8('a' = 1)", "Enum8('b' = 1)", "LowCardinality(String)"},
+		{"LowCardinality(String)", "Int64", "LowCardinality(String)"},
+		{"Bool", "UUID", "String"},
+		{"Int64", "UInt64", "Float64"},
+		{"UInt64", "Int64", "Float64"},
+		{"UInt64", "UInt64", "UInt64"},
+		{"UInt64", "Float64", "Float64"},
+		{"Float64", "UInt64", "Float64"},
+		{"Bool", "Int64", "Int64"},
+		{"Int64", "Bool", "Int64"},
+		{"Bool", "UInt64", "UInt64"},
+		{"Bool", "Float64", "Float64"},
+		{"Decimal(18, 2)", "Bool", "Float64"},
+		{"Bool", "Date", "String"},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.expected, widenType(tc.existing, tc.incoming), tc.existing+" + "+tc.incoming)
+	}
+}
+
+func TestPlanAppend(t *testing.T) {
+	target := &appendTarget{
+		Table: "orders",
+		Columns: []models.ColumnInfo{
+			{Name: "id", Type: "UInt64"},
+			{Name: "0001_name", Type: "String"},
+			{Name: "0002_amount", Type: "Int64"},
+			{Name: "0003_city", Type: "LowCardinality(String)"},
+		},
+		NextID:       10,
+		InitialBatch: "monday.csv",
+	}
+	headers := []string{"0001_amount", "0002_name", "0003_discount"}
+	labels := []string{"amount", "name", "discount"}
+	types := []string{"Float64", "String", "Int64"}
+	nullables := []string{"", "", " NULL "}
+	plan := planAppend(target, headers, labels, types, nullables, make([]columnFormat, 3), "/tmp/tuesday.csv")
+
+	assert.Equal(t, []string{
+		"ALTER TABLE orders ADD COLUMN 0000_load_batch LowCardinality(String) DEFAULT 'monday.csv'",
+		"ALTER TABLE orders MODIFY COLUMN 0002_amount Float64 ",
+		"ALTER TABLE orders ADD COLUMN 0004_discount Int64  NULL ",
+		"ALTER TABLE orders MODIFY COLUMN 0003_city LowCardinality(Nullable(String)) ",
+	}, plan.Alters)
+	assert.Equal(t, []string{"0002_amount", "0001_name", "0004_discount"}, plan.Columns)
+	assert.Equal(t, []string{"Float64", "String", "Int64"}, types)
+	assert.Equal(t, "orders (id, 0002_amount, 0001_name, 0004_discount, 0000_load_batch)", plan.InsertInto())
+	assert.True(t, strings.HasSuffix(plan.Batch, " tuesday.csv"))
+
+	plan.Commit(target, 5)
+	assert.Equal(t, int64(15), target.NextID)
+	second := planAppend(target, headers, labels, []string{"Float64", "String", "Int64"}, nullables, make([]columnFormat, 3), "/tmp/tuesday.csv")
+	assert.Empty(t, second.Alters)
+}
+
+func TestPlanAppendMatchesLabels(t *testing.T) {
+	// Колонки сопоставляются по исходным названиям, а не по транслиту в SQL имени
+	target := &appendTarget{
+		Table: "orders_labels",
+		Columns: []models.ColumnInfo{
+			{Name: "id", Type: "UInt64"},
+			{Name: "0000_load_batch", Type: "LowCardinality(String)"},
+			{Name: "0001_gorod", Type: "String", Comment: "label:Город"},
+			{Name: "0002_summa", Type: "Int64", Comment: "label:Сумма заказа"},
+		},
+	}
+	setColumnMeta(target.Table, map[string]models.ColumnMeta{"0001_gorod": {Label: "Город"}, "0002_summa": {Label: "Сумма заказа"}})
+	defer deleteColumnMeta(target.Table)
+
+	headers := []string{"0001_summa_zakaza", "0002_gorod"}
+	plan := planAppend(target, headers, []string{"сумма  заказа", "Город"}, []string{"Float64", "String"}, []string{"", ""}, make([]columnFormat, 2), "/tmp/tuesday.csv")
+	assert.Equal(t, []string{"0002_summa", "0001_gorod"}, plan.Columns)
+	assert.Equal(t, []string{"ALTER TABLE orders_labels MODIFY COLUMN 0002_summa Float64 COMMENT 'label:Сумма заказа'"}, plan.Alters)
+
+	plan = planAppend(target, []string{"0001_gorod"}, []string{"Город доставки"}, []string{"String"}, []string{""}, make([]columnFormat, 1), "/tmp/tuesday.csv")
+	assert.Equal(t, []string{"0003_gorod"}, plan.Columns)
+	assert.Contains(t, plan.Alters, "ALTER TABLE orders_labels ADD COLUMN 0003_gorod String  NULL COMMENT 'label:Город доставки'")
+}
+
+func TestPlanAppendBoolIntoNumber(t *testing.T) {
+	// Колонка 0/1 из нового файла распознана как Bool, но остается числом и пишется как 1 и 0
+	target := &appendTarget{
+		Table: "flags",
+		Columns: []models.ColumnInfo{
+			{Name: "id", Type: "UInt64"},
+			{Name: "0000_load_batch", Type: "LowCardinality(String)"},
+			{Name: "0001_paid", Type: "Int64"},
+		},
+	}
+	types := []string{"Bool"}
+	formats := make([]columnFormat, 1)
+	plan := planAppend(target, []string{"0001_paid"}, []string{"paid"}, types, []string{""}, formats, "/tmp/flags.csv")
+	assert.Empty(t, plan.Alters)
+	assert.Equal(t, []string{"Int64"}, types)
+	assert.Equal(t, "1", normalizeValue(types[0], formats[0], "да"))
+	assert.Equal(t, "0", normalizeValue(types[0], formats[0], "false"))
+}
+
+func TestImportAppendsToTable(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "tuesday.csv")
+	assert.NoError(t, os.WriteFile(filePath, []byte("name,amount\nA,1.5\nB,2.25\n"), 0644))
+
+	target := &appendTarget{
+		Table: "orders",
+		Columns: []models.ColumnInfo{
+			{Name: "id", Type: "UInt64"},
+			{Name: "0000_load_batch", Type: "LowCardinality(String)"},
+			{Name: "0001_name", Type: "String"},
+			{Name: "0002_amount", Type: "Float64"},
+		},
+		NextID: 100,
+	}
+	mockDB := NewMockDB()
+	mockDB.On("Exec", mock.Anything, mock.Anything).Return(&gorm.DB{})
+	tables, err := importFileIntoClickHouse(filePath, mockDB, importOptions{Append: target})
+	assert.NoError(t, err)
+	assert.Equal(t, models.ClickhouseTableName("orders"), tables[0].Name)
+
+	for _, call := range mockDB.Calls {
+		query := call.Arguments.String(0)
+		assert.False(t, strings.HasPrefix(query, "CREATE TABLE") || strings.HasPrefix(query, "DROP TABLE"), query)
+	}
+	assert.True(t, strings.HasPrefix(mockDB.lastQuery, "INSERT INTO orders (id, 0001_name, 0002_amount, 0000_load_batch) SETTINGS max_query_size = 5048576, max_insert_block_size = 5000000 FORMAT CSV \n101,A,1.5,"))
+	assert.Contains(t, mockDB.lastQuery, " tuesday.csv\n102,B,2.25,")
+	assert.Equal(t, int64(102), target.NextID)
+}
+
+func TestAppendTableIsKeptWhileAppending(t *testing.T) {
+	defer setAppendMode(77, "")
+	assert.False(t, isAppendTable("orders"))
+
+	// Пока дописывание выключено, смена текущей таблицы его не включает
+	followCurrentTable(77, "orders")
+	assert.False(t, isAppendMode(77))
+
+	setAppendMode(77, "orders")
+	assert.True(t, isAppendMode(77))
+	assert.True(t, isAppendTable("orders"))
+	assert.True(t, isAppendTable(models.ClickhouseTableName(rejectedTableName("orders"))))
+	assert.False(t, isAppendTable("customers"))
+
+	followCurrentTable(77, "customers")
+	assert.Equal(t, models.ClickhouseTableName("customers"), appendTable(77))
+	assert.False(t, isAppendTable("orders"))
+
+	setAppendMode(77, "")
+	assert.False(t, isAppendTable("customers"))
+}
@@ -25,6 +25,7 @@ func handleCommand(api *tgbotapi.BotAPI, update tgbotapi.Update) {
 	graphPrefix := "graph_"
 	detailsPrefix := "details_"
 	datesPrefix := "dates_"
+	tablePrefix := "table_"
 
 	// Проверяем и обрабатываем команды по префиксам
 	switch {
@@ -57,6 +58,50 @@ func handleCommand(api *tgbotapi.BotAPI, update tgbotapi.Update) {
 			return
 		}
 		handleDateColumn(api, update, columnName)
+	case strings.HasPrefix(fullCommand, "sqlite_"):
+		go importSQLiteSelection(api, update.Message.Chat.ID, strings.TrimPrefix(fullCommand, "sqlite_"))
+	case strings.HasPrefix(fullCommand, tablePrefix):
+		handleTableSwitch(api, update, strings.TrimPrefix(fullCommand, tablePrefix))
+	case fullCommand == "tables":
+		tables, ok := getChatTables(update.Message.Chat.ID)
+		if !ok {
+			msg := tgbotapi.NewMessage(update.Message.Chat.ID, "В последнем загруженном файле только одна таблица")
+			api.Send(msg)
+			return
+		}
+		msg := tgbotapi.NewMessage(update.Message.Chat.ID, formatTablesList(tables, currentTable[update.Message.Chat.ID]))
+		api.Send(msg)
+	case fullCommand == "archive_all":
+		setArchiveAllMembers(update.Message.Chat.ID, true)
+		msg := tgbotapi.NewMessage(update.Message.Chat.ID, "Из архивов будут загружаться все файлы: файлы с одинаковыми колонками склеиваются в одну таблицу с колонкой source_file, остальные — отдельные таблицы (/tables). Вернуть прежний режим: /archive_largest")
+		api.Send(msg)
+	case fullCommand == "archive_largest":
+		setArchiveAllMembers(update.Message.Chat.ID, false)
+		msg := tgbotapi.NewMessage(update.Message.Chat.ID, "Из архивов будет загружаться только самый большой файл. Загружать все файлы: /archive_all")
+		api.Send(msg)
+	case fullCommand == "append":
+		if currentTable[update.Message.Chat.ID] == "" {
+			msg := tgbotapi.NewMessage(update.Message.Chat.ID, "Сначала загрузите файл: новые файлы будут дописываться в его таблицу")
+			api.Send(msg)
+			return
+		}
+		setAppendMode(update.Message.Chat.ID, currentTable[update.Message.Chat.ID])
+		msg := tgbotapi.NewMessage(update.Message.Chat.ID, "Новые файлы будут дописываться в текущую таблицу: колонки сопоставляются по названиям, новые колонки добавляются, а в колонке load_batch видно, из какой загрузки строка. Создавать новую таблицу на каждый файл: /append_off")
+		api.Send(msg)
+	case fullCommand == "append_off":
+		setAppendMode(update.Message.Chat.ID, "")
+		msg := tgbotapi.NewMessage(update.Message.Chat.ID, "Каждый файл снова загружается в новую таблицу. Дописывать в текущую: /append")
+		api.Send(msg)
+	case fullCommand == "schema":
+		handleSchemaCommand(api, update)
+	case fullCommand == "cast":
+		handleCastCommand(api, update)
+	case fullCommand == "corr":
+		handleCorrCommand(api, update)
+	case fullCommand == "crosstab":
+		handleCrosstabCommand(api, update)
+	case fullCommand == "outliers":
+		handleOutliersCommand(api, update)
 	case fullCommand == "start":
 		handleStartCommand(api, update)
 	default:
@@ -65,6 +110,336 @@ func handleCommand(api *tgbotapi.BotAPI, update tgbotapi.Update) {
 	}
 }
 
+// handleTableSwitch делает выбранную таблицу (лист книги и т.п.) текущей и присылает по ней статистику
+func handleTableSwitch(api *tgbotapi.BotAPI, update tgbotapi.Update, number string) {
+	chatId := update.Message.Chat.ID
+	tables, _ := getChatTables(chatId)
+	index, err := strconv.Atoi(number)
+	if err != nil || index < 1 || index > len(tables) {
+		msg := tgbotapi.NewMessage(chatId, "Таблица не найдена, список таблиц: /tables")
+		api.Send(msg)
+		return
+	}
+	table := tables[index-1]
+	currentTable[chatId] = table.Name
+	followCurrentTable(chatId, table.Name)
+	toDeleteTable[table.Name] = time.Now().Add(time.Hour)
+
+	msg := tgbotapi.NewMessage(chatId, fmt.Sprintf("Текущая таблица: %s", table.Source))
+	api.Send(msg)
+	stat := analyzeStatistics(table.Name)
+	sendStats(chatId, stat, api)
+}
+
+// handleSchemaCommand показывает угаданные типы колонок текущей таблицы и как их исправить
+func handleSchemaCommand(api *tgbotapi.BotAPI, update tgbotapi.Update) {
+	chatId := update.Message.Chat.ID
+	tableName := currentTable[chatId]
+	if tableName == "" {
+		api.Send(tgbotapi.NewMessage(chatId, "Сначала загрузите файл"))
+		return
+	}
+	cfg := config.GetConfig()
+	db, err := gorm.Open(mysql.Open(cfg.DatabaseDSN), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		api.Send(tgbotapi.NewMessage(chatId, "Error connecting to database"))
+		return
+	}
+	columns, err := getColumnAndTypeList(db, tableName)
+	if err != nil {
+		api.Send(tgbotapi.NewMessage(chatId, "Error getting column info: "+err.Error()))
+		return
+	}
+	schema := chatSchemas(chatId)[tableFingerprint(columns)]
+	api.Send(tgbotapi.NewMessage(chatId, formatSchema(tableName, columns, schema)))
+}
+
+// handleCastCommand меняет тип колонки: /cast zip String или /cast Сумма заказа Decimal(18, 2). Таблица пересобирается из загруженного файла,
+// чтобы вернуть потерянное при неверном типе (например, ведущие нули), а если файла уже нет — меняется в ClickHouse.
+// Тип запоминается для следующих загрузок файла с такими же колонками
+func handleCastCommand(api *tgbotapi.BotAPI, update tgbotapi.Update) {
+	chatId := update.Message.Chat.ID
+	tableName := currentTable[chatId]
+	if tableName == "" {
+		api.Send(tgbotapi.NewMessage(chatId, "Сначала загрузите файл"))
+		return
+	}
+	// Название колонки из файла может содержать пробелы, тип всегда последний
+	args := strings.Fields(update.Message.CommandArguments())
+	if len(args) < 2 {
+		api.Send(tgbotapi.NewMessage(chatId, "Использование: /cast <колонка> <тип>, например /cast zip String. Колонки и типы: /schema"))
+		return
+	}
+	columnName, typeName := strings.Join(args[:len(args)-1], " "), args[len(args)-1]
+	columnType, ok := parseCastType(typeName)
+	if !ok {
+		api.Send(tgbotapi.NewMessage(chatId, "Неизвестный тип "+typeName+". Типы: "+castTypesList()))
+		return
+	}
+
+	cfg := config.GetConfig()
+	db, err := gorm.Open(mysql.Open(cfg.DatabaseDSN), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		api.Send(tgbotapi.NewMessage(chatId, "Error connecting to database"))
+		return
+	}
+	columns, err := getColumnAndTypeList(db, tableName)
+	if err != nil {
+		api.Send(tgbotapi.NewMessage(chatId, "Error getting column info: "+err.Error()))
+		return
+	}
+	column := findColumn(tableName, columns, columnName)
+	if column == nil {
+		api.Send(tgbotapi.NewMessage(chatId, "Колонка "+columnName+" не найдена. Колонки: /schema"))
+		return
+	}
+	if err := saveColumnType(chatId, tableFingerprint(columns), column.Name, columnType); err != nil {
+		log.Printf("Error saving column types: %v", err)
+	}
+
+	meta := getTableMeta(tableName)
+	if _, err := os.Stat(meta.SourcePath); meta.SourcePath != "" && err == nil {
+		status := sendProgressMessage(api, chatId, fmt.Sprintf("⏳ Пересобираю таблицу: %s → %s", columnLabel(tableName, column.Name), columnType))
+		progress := newImportProgress()
+		stopProgress := status.Watch(progress)
+		opts := importOptions{AllArchiveMembers: isArchiveAllMembers(chatId), Progress: progress, Schemas: chatSchemas(chatId)}
+		// Из базы SQLite пересобираются те же таблицы, что были выбраны при загрузке
+		loaded, _ := getChatTables(chatId)
+		for _, table := range loaded {
+			if table.Meta.SQLiteTable != "" {
+				opts.SQLiteTables = append(opts.SQLiteTables, table.Meta.SQLiteTable)
+			}
+		}
+		if opts.SQLiteTables == nil && meta.SQLiteTable != "" {
+			opts.SQLiteTables = []string{meta.SQLiteTable}
+		}
+		tables, err := handleFile(meta.SourcePath, opts)
+		stopProgress()
+		if err != nil {
+			status.Update("❌ Пересборка не удалась")
+			api.Send(tgbotapi.NewMessage(chatId, "Some error on processing file:"+err.Error()))
+			return
+		}
+		// Текущей остается та же часть файла (лист, таблица базы), что и до пересборки
+		source := ""
+		for _, table := range loaded {
+			if table.Name == tableName {
+				source = table.Source
+			}
+		}
+		for i, table := range tables {
+			if source != "" && table.Source == source {
+				tables[0], tables[i] = tables[i], tables[0]
+			}
+		}
+		activateImportedTables(chatId, tables, api, status)
+		return
+	}
+
+	if err := db.Exec(alterColumnSQL(tableName, *column, columnType)).Error; err != nil {
+		api.Send(tgbotapi.NewMessage(chatId, fmt.Sprintf("Не удалось привести %s к %s: %v", columnLabel(tableName, column.Name), columnType, err)))
+		return
+	}
+	updateColumnSemantics(tableName, column.Name, columnType)
+	api.Send(tgbotapi.NewMessage(chatId, fmt.Sprintf("✅ Тип %s изменен на %s", columnLabel(tableName, column.Name), columnType)))
+	stat := analyzeStatistics(tableName)
+	sendStats(chatId, stat, api)
+}
+
+// handleCorrCommand присылает тепловые карты корреляций Пирсона и Спирмена между числовыми колонками и список связей
+func handleCorrCommand(api *tgbotapi.BotAPI, update tgbotapi.Update) {
+	chatId := update.Message.Chat.ID
+	tableName := currentTable[chatId]
+	if tableName == "" {
+		api.Send(tgbotapi.NewMessage(chatId, "Сначала загрузите файл"))
+		return
+	}
+	cfg := config.GetConfig()
+	db, err := gorm.Open(mysql.Open(cfg.DatabaseDSN), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		api.Send(tgbotapi.NewMessage(chatId, "Error connecting to database"))
+		return
+	}
+	columns, err := getColumnAndTypeList(db, tableName)
+	if err != nil {
+		api.Send(tgbotapi.NewMessage(chatId, "Error getting column info: "+err.Error()))
+		return
+	}
+	matrix, err := computeCorrelations(db, tableName, columns)
+	if err != nil {
+		log.Printf("Error computing correlations: %v", err)
+		api.Send(tgbotapi.NewMessage(chatId, "Ошибка расчета корреляций"))
+		return
+	}
+	if matrix == nil {
+		api.Send(tgbotapi.NewMessage(chatId, "Для корреляций нужно хотя бы две числовые колонки"))
+		return
+	}
+
+	labels := matrix.Labels(tableName)
+	for _, heatmap := range []struct {
+		method string
+		values [][]float64
+	}{{"Пирсон", matrix.Pearson}, {"Спирмен", matrix.Spearman}} {
+		graph, err := plot.DrawHeatmap(labels, heatmap.values, "Корреляция: "+heatmap.method)
+		if err != nil {
+			log.Printf("Error generating heatmap: %v", err)
+			continue
+		}
+		sendGraphVisualization(graph, "heatmap", heatmap.method, "", chatId, api)
+	}
+
+	text := formatCorrelations(tableName, matrix, 0)
+	if text == "" {
+		text = fmt.Sprintf("Сильных связей между числовыми колонками нет: все коэффициенты по модулю меньше %.1f", correlationMinStrength)
+	}
+	for _, part := range splitMessage(text, 4000) {
+		api.Send(tgbotapi.NewMessage(chatId, part))
+	}
+}
+
+// handleCrosstabCommand присылает таблицу сопряженности двух колонок с процентами по строкам и столбцам,
+// тест хи-квадрат и график долей: /crosstab Город Способ оплаты
+func handleCrosstabCommand(api *tgbotapi.BotAPI, update tgbotapi.Update) {
+	chatId := update.Message.Chat.ID
+	tableName := currentTable[chatId]
+	if tableName == "" {
+		api.Send(tgbotapi.NewMessage(chatId, "Сначала загрузите файл"))
+		return
+	}
+	args := strings.Fields(update.Message.CommandArguments())
+	if len(args) < 2 {
+		api.Send(tgbotapi.NewMessage(chatId, "Использование: /crosstab <колонка> <колонка>, например /crosstab city payment. Колонки: /schema"))
+		return
+	}
+	cfg := config.GetConfig()
+	db, err := gorm.Open(mysql.Open(cfg.DatabaseDSN), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		api.Send(tgbotapi.NewMessage(chatId, "Error connecting to database"))
+		return
+	}
+	columns, err := getColumnAndTypeList(db, tableName)
+	if err != nil {
+		api.Send(tgbotapi.NewMessage(chatId, "Error getting column info: "+err.Error()))
+		return
+	}
+	columnA, columnB := findColumnPair(tableName, columns, args)
+	if columnA == nil {
+		api.Send(tgbotapi.NewMessage(chatId, "Колонки не найдены: "+strings.Join(args, " ")+". Колонки: /schema"))
+		return
+	}
+	t, err := loadContingencyTable(db, tableName, columnA.Name, columnB.Name, maxCrosstabValues)
+	if err != nil {
+		log.Printf("Error getting crosstab: %v", err)
+		api.Send(tgbotapi.NewMessage(chatId, "Ошибка построения таблицы сопряженности"))
+		return
+	}
+	if t.Total == 0 {
+		api.Send(tgbotapi.NewMessage(chatId, "Нет строк, где заполнены обе колонки"))
+		return
+	}
+	labelA, labelB := columnLabel(tableName, columnA.Name), columnLabel(tableName, columnB.Name)
+
+	fileName := "crosstab_" + time.Now().Format("20060102-150405") + ".txt"
+	doc := tgbotapi.NewDocumentUpload(chatId, tgbotapi.FileBytes{
+		Name:  fileName,
+		Bytes: []byte(fmt.Sprintf("%s × %s\n%s\n\n%s\n", labelA, labelB, formatCrosstab(labelA, labelB, t), formatChiSquare(t.ChiSquare()))),
+	})
+	doc.Caption = fmt.Sprintf("%s × %s\n%s", labelA, labelB, formatChiSquare(t.ChiSquare()))
+	if _, err := api.Send(doc); err != nil {
+		log.Printf("Error sending crosstab: %v", err)
+	}
+
+	graph, err := plot.DrawStackedBar(t.Rows, t.Columns, t.Counts, fmt.Sprintf("%s × %s", labelA, labelB))
+	if err != nil {
+		log.Printf("Error generating stacked bar: %v", err)
+		return
+	}
+	sendGraphVisualization(graph, "crosstab", labelA+"_"+labelB, labelB, chatId, api)
+}
+
+// handleOutliersCommand ищет выбросы в числовой колонке выбранным методом: /outliers Сумма заказа mad.
+// Присылает границы, число выбросов, самые далекие строки целиком и CSV со всеми строками с выбросами
+func handleOutliersCommand(api *tgbotapi.BotAPI, update tgbotapi.Update) {
+	chatId := update.Message.Chat.ID
+	tableName := currentTable[chatId]
+	if tableName == "" {
+		api.Send(tgbotapi.NewMessage(chatId, "Сначала загрузите файл"))
+		return
+	}
+	args := strings.Fields(update.Message.CommandArguments())
+	if len(args) == 0 {
+		api.Send(tgbotapi.NewMessage(chatId, "Использование: /outliers <колонка> [метод], например /outliers amount mad. Методы: "+outlierMethodsHelp))
+		return
+	}
+	// Метод необязателен и всегда последний, название колонки может содержать пробелы
+	detector := defaultOutlierDetector
+	if len(args) > 1 {
+		if parsed, ok := parseOutlierDetector(args[len(args)-1]); ok {
+			detector = parsed
+			args = args[:len(args)-1]
+		}
+	}
+	columnName := strings.Join(args, " ")
+
+	cfg := config.GetConfig()
+	db, err := gorm.Open(mysql.Open(cfg.DatabaseDSN), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		api.Send(tgbotapi.NewMessage(chatId, "Error connecting to database"))
+		return
+	}
+	columns, err := getColumnAndTypeList(db, tableName)
+	if err != nil {
+		api.Send(tgbotapi.NewMessage(chatId, "Error getting column info: "+err.Error()))
+		return
+	}
+	column := findColumn(tableName, columns, columnName)
+	if column == nil || !IsNumericType(column.Type) {
+		api.Send(tgbotapi.NewMessage(chatId, "Числовая колонка "+columnName+" не найдена. Колонки: /schema. Методы: "+outlierMethodsHelp))
+		return
+	}
+
+	lower, upper, err := detector.Bounds(newClickhouseValues(db, tableName, column.Name))
+	if err != nil {
+		log.Printf("Error getting outlier bounds: %v", err)
+		api.Send(tgbotapi.NewMessage(chatId, "Ошибка получения статистики по выбросам"))
+		return
+	}
+	var summary outlierSummary
+	if err := db.Raw(generateSqlForOutlierSummary(column.Name, tableName, lower, upper)).Scan(&summary).Error; err != nil {
+		log.Printf("Error counting outliers: %v", err)
+		api.Send(tgbotapi.NewMessage(chatId, "Ошибка получения статистики по выбросам"))
+		return
+	}
+	resultColumns, rows, err := queryRows(db, generateSqlForOutlierRows(column.Name, tableName, lower, upper, maxOutlierExport))
+	if err != nil {
+		log.Printf("Error getting outlier rows: %v", err)
+		api.Send(tgbotapi.NewMessage(chatId, "Ошибка получения строк с выбросами"))
+		return
+	}
+
+	top := rows
+	if len(top) > maxOutlierRowsShown {
+		top = top[:maxOutlierRowsShown]
+	}
+	text := formatOutlierReport(tableName, column.Name, detector, lower, upper, summary, resultColumns, top)
+	for _, part := range splitMessage(text, 4000) {
+		api.Send(tgbotapi.NewMessage(chatId, part))
+	}
+	if len(rows) == 0 {
+		return
+	}
+	fileName := "outliers_" + replaceSpecialSymbols(columnLabel(tableName, column.Name)) + "_" + time.Now().Format("20060102-150405") + ".csv"
+	doc := tgbotapi.NewDocumentUpload(chatId, tgbotapi.FileBytes{Name: fileName, Bytes: outlierRowsCSV(tableName, resultColumns, rows)})
+	doc.Caption = fmt.Sprintf("Строки с выбросами: %d", len(rows))
+	if int64(len(rows)) < summary.Below+summary.Above {
+		doc.Caption += fmt.Sprintf(" из %d, самые далекие от границ", summary.Below+summary.Above)
+	}
+	if _, err := api.Send(doc); err != nil {
+		log.Printf("Error sending outliers: %v", err)
+	}
+}
+
 func handleDateColumn(api *tgbotapi.BotAPI, update tgbotapi.Update, columnName string) {
 	tableName, exists := currentTable[update.Message.Chat.ID]
 	if !exists {
@@ -182,7 +557,7 @@ func handleDateColumn(api *tgbotapi.BotAPI, update tgbotapi.Update, columnName s
 			"• Всего записей: %d\n"+
 			"• Уникальных дат: %d\n"+
 			"• Период: с %s по %s\n",
-		strings.Split(columnName[5:], "__")[0],
+		columnLabel(tableName, baseField),
 		int(sum(yValues)),
 		len(dateCounts),
 		dateCounts[0].Date,
@@ -192,7 +567,7 @@ func handleDateColumn(api *tgbotapi.BotAPI, update tgbotapi.Update, columnName s
 	msg := tgbotapi.NewMessage(update.Message.Chat.ID, statsMsg)
 	api.Send(msg)
 	sumFirstColumnDate(db, dateTruncExpr, string(tableName), baseField, columnName, update, api, timeUnit)
-	sendGraphVisualization(graphData, "timeseries", columnName, gr.GetNameGraph(), update.Message.Chat.ID, api, timeUnit)
+	sendGraphVisualization(graphData, "timeseries", columnLabel(tableName, baseField), gr.GetNameGraph(), update.Message.Chat.ID, api, timeUnit)
 }
 
 // sum возвращает сумму всех значений в слайсе float64
@@ -229,7 +604,7 @@ func handleStringColumn(api *tgbotapi.BotAPI, update tgbotapi.Update, columnName
 		api.Send(msg)
 		return
 	}
-	sendGraphVisualization(statsMsg1, "AggregationPlot", columnName[5:], "", update.Message.Chat.ID, api)
+	sendGraphVisualization(statsMsg1, "AggregationPlot", columnLabel(tableName, columnName), "", update.Message.Chat.ID, api)
 }
 
 func GenerateHistogramForString(db *gorm.DB, tableName models.ClickhouseTableName, columnName string) ([]byte, error) {
@@ -443,7 +818,9 @@ func GenerateColumnHistogram(db *gorm.DB, tableName models.ClickhouseTableName,
 	// return generateSVGHistogram(histData, columnName), nil
 }
 
-func GenerateHistogram(db *gorm.DB, tableName models.ClickhouseTableName, columnName string) ([]byte, error, []byte) {
+// GenerateHistogram строит гистограмму и график плотности; если shape задан, на плотность накладывается
+// кривая лучше всего подходящего распределения
+func GenerateHistogram(db *gorm.DB, tableName models.ClickhouseTableName, columnName string, shape *distributionShape) ([]byte, error, []byte) {
 	// SQL запрос для получения гистограммы
 	histogramSQL := fmt.Sprintf(`
         WITH 
@@ -501,7 +878,27 @@ func GenerateHistogram(db *gorm.DB, tableName models.ClickhouseTableName, column
 	histBar := plot.NewDataRangeXValuesForGraph(xStart, xEnd, yValues, "", "", "")
 	// Генерируем гистограмму
 	hist, _ := plot.DrawPlotBar(histBar)
-	graph, _ := plot.DrawDensityPlot(xValues, yValues)
+
+	// Интервалы histogram() разной ширины, поэтому плотность — число значений на единицу ширины интервала;
+	// в тех же единицах считается и кривая распределения
+	var total float64
+	for _, y := range yValues {
+		total += y
+	}
+	densityX := []float64{}
+	densityY := []float64{}
+	for i := range yValues {
+		if width := xEnd[i] - xStart[i]; width > 0 && total > 0 {
+			densityX = append(densityX, xValues[i])
+			densityY = append(densityY, yValues[i]/(total*width))
+		}
+	}
+	var fit *plot.FittedCurve
+	if best := shape.Best(); best != nil && len(histData) > 0 {
+		fitX, fitY := best.FittedCurve(xStart[0], xEnd[len(xEnd)-1], fittedCurvePoints)
+		fit = &plot.FittedCurve{Name: best.Distribution.Name(), XValues: fitX, YValues: fitY}
+	}
+	graph, _ := plot.DrawDensityPlotWithFit(densityX, densityY, fit)
 	return hist, nil, graph
 }
 func handleNumericColumn(api *tgbotapi.BotAPI, update tgbotapi.Update, columnName string) {
@@ -555,10 +952,14 @@ func handleNumericColumn(api *tgbotapi.BotAPI, update tgbotapi.Update, columnNam
 		return
 	}
 
-	// Рассчитываем IQR и границы выбросов
-	iqr := stats.Q3 - stats.Q1
-	lowerBound := stats.Q1 - 1.5*iqr
-	upperBound := stats.Q3 + 1.5*iqr
+	// Границы выбросов по методу по умолчанию, другие методы — в /outliers
+	lowerBound, upperBound, err := defaultOutlierDetector.Bounds(newClickhouseValues(db, tableName, columnName))
+	if err != nil {
+		log.Printf("Error getting outlier bounds: %v", err)
+		msg := tgbotapi.NewMessage(update.Message.Chat.ID, "Ошибка получения статистики по выбросам")
+		api.Send(msg)
+		return
+	}
 
 	// SQL для подсчета выбросов
 	outlierSQL := fmt.Sprintf(`
@@ -643,7 +1044,13 @@ func handleNumericColumn(api *tgbotapi.BotAPI, update tgbotapi.Update, columnNam
 		yValues[i] = float64(rangeCount.Count)
 	}
 
-	pngData, err, pngData2 := GenerateHistogram(db, tableName, columnName)
+	// Форма распределения не обязательна для остальной статистики: при ошибке график строится без кривой
+	shape, err := computeDistributionShape(db, tableName, columnName)
+	if err != nil {
+		log.Printf("Error fitting distributions: %v", err)
+	}
+
+	pngData, err, pngData2 := GenerateHistogram(db, tableName, columnName, shape)
 	if err != nil {
 		log.Printf("Error generating plot: %v", err)
 		msg := tgbotapi.NewMessage(update.Message.Chat.ID, "Ошибка генерации графика")
@@ -678,23 +1085,29 @@ func handleNumericColumn(api *tgbotapi.BotAPI, update tgbotapi.Update, columnNam
 			"• 90%% (P90): %.2f\n"+
 			"• 95%% (P95): %.2f\n"+
 			"• 99%% (P99): %.2f\n\n"+
-			"Анализ выбросов:\n"+
+			"Анализ выбросов (%s):\n"+
 			"• Количество выбросов: %d\n"+
-			"• Диапазон выбросов: %.2f - %.2f",
-		columnName,
+			"• Диапазон выбросов: %.2f - %.2f\n"+
+			"Другие методы и строки с выбросами: /outliers <колонка> <метод>",
+		columnLabel(tableName, columnName),
 		stats.MinValue, stats.MaxValue, stats.AvgValue, stats.MedianValue, stats.TotalCount,
 		quantileValues[0], quantileValues[1], quantileValues[2],
 		quantileValues[3], quantileValues[4], quantileValues[5],
 		quantileValues[6], quantileValues[7], quantileValues[8],
+		defaultOutlierDetector.Name(),
 		outlierStats.OutliersCount,
 		outlierStats.MinOutlier, outlierStats.MaxOutlier)
 
 	msg := tgbotapi.NewMessage(update.Message.Chat.ID, statsMsg)
 	api.Send(msg)
 
+	if shape != nil {
+		api.Send(tgbotapi.NewMessage(update.Message.Chat.ID, formatDistributionShape(tableName, columnName, shape)))
+	}
+
 	// Отправляем график
-	sendGraphVisualization(pngData, "histogram", columnName[5:], "частотное распределения категориальных данных", update.Message.Chat.ID, api)
-	sendGraphVisualization(pngData2, "density", columnName[5:], "суммирование числовых данных по категориям", update.Message.Chat.ID, api)
+	sendGraphVisualization(pngData, "histogram", columnLabel(tableName, columnName), "частотное распределения категориальных данных", update.Message.Chat.ID, api)
+	sendGraphVisualization(pngData2, "density", columnLabel(tableName, columnName), "суммирование числовых данных по категориям", update.Message.Chat.ID, api)
 }
 
 func handleStartCommand(api *tgbotapi.BotAPI, update tgbotapi.Update) {
@@ -718,7 +1131,7 @@ func sumFirstColumnDate(db *gorm.DB, dateTruncExpr, tableName, baseField, column
 	SELECT name
 	FROM system.columns 
 	WHERE table = '%s' 
-	AND type IN ('Int8', 'Int16', 'Int32', 'Int64', 'Float32', 'Float64', 'Decimal') 
+	AND (type IN ('Int8', 'Int16', 'Int32', 'Int64', 'Float32', 'Float64') OR startsWith(type, 'Decimal')) 
 	LIMIT 1`, tableName)
 	err := db.Raw(numericColSQL).Scan(&numericColumn).Error
 	if err != nil {
@@ -731,7 +1144,7 @@ func sumFirstColumnDate(db *gorm.DB, dateTruncExpr, tableName, baseField, column
 			SELECT 
 				toString(%s) as date,
 				count(*) as count,
-				sum(%s) as sum_value
+				toFloat64(sum(%s)) as sum_value
 			FROM %s 
 			WHERE %s IS NOT NULL 
 			GROUP BY %s 
@@ -783,7 +1196,9 @@ func sumFirstColumnDate(db *gorm.DB, dateTruncExpr, tableName, baseField, column
 		yValues = append(yValues, float64(dc.SumValue))
 	}
 	// созадем структуру для реализации функции
-	gr := plot.NewDataDateForGraph(xValues, yValues, columnName, fmt.Sprintf("Суммарное значение столбца %s группировка по времени", numericColumn[5:]), timeUnit)
+	label := columnLabel(models.ClickhouseTableName(tableName), baseField)
+	gr := plot.NewDataDateForGraph(xValues, yValues, label, fmt.Sprintf("Суммарное значение столбца %s группировка по времени",
+		columnLabel(models.ClickhouseTableName(tableName), numericColumn)), timeUnit)
 	graphData, err := plot.DrawPlotBar(gr)
 
 	if err != nil {
@@ -795,5 +1210,5 @@ func sumFirstColumnDate(db *gorm.DB, dateTruncExpr, tableName, baseField, column
 
 	// Send statistics message
 
-	sendGraphVisualization(graphData, "timeseries", columnName, gr.GetNameGraph(), update.Message.Chat.ID, api)
+	sendGraphVisualization(graphData, "timeseries", label, gr.GetNameGraph(), update.Message.Chat.ID, api)
 }
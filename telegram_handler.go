@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -10,6 +11,7 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/pivolan/stats_analyzer/config"
@@ -30,10 +32,102 @@ var toDelete = map[string]time.Time{}
 
 var toDeleteTable = map[models.ClickhouseTableName]time.Time{}
 
+// chatTables хранит все таблицы последней загрузки чата, если файл дал больше одной таблицы.
+// Загрузка идет в отдельной горутине, а команды читают список параллельно, поэтому под мьютексом
+var chatTables = struct {
+	sync.RWMutex
+	chats map[int64][]models.ImportedTable
+}{chats: map[int64][]models.ImportedTable{}}
+
+// setChatTables запоминает таблицы загрузки; пустой список удаляет запись чата
+func setChatTables(chatId int64, tables []models.ImportedTable) {
+	chatTables.Lock()
+	defer chatTables.Unlock()
+	if len(tables) > 1 {
+		chatTables.chats[chatId] = append([]models.ImportedTable(nil), tables...)
+	} else {
+		delete(chatTables.chats, chatId)
+	}
+}
+
+// getChatTables возвращает копию списка, ее можно менять без мьютекса
+func getChatTables(chatId int64) ([]models.ImportedTable, bool) {
+	chatTables.RLock()
+	defer chatTables.RUnlock()
+	tables, ok := chatTables.chats[chatId]
+	return append([]models.ImportedTable(nil), tables...), ok
+}
+
+// archiveAllMembers — чаты, в которых из архива импортируются все файлы, а не только самый большой.
+// Команда и загрузка файла работают в разных горутинах, поэтому под мьютексом
+var archiveAllMembers = struct {
+	sync.RWMutex
+	chats map[int64]bool
+}{chats: map[int64]bool{}}
+
+func setArchiveAllMembers(chatId int64, enabled bool) {
+	archiveAllMembers.Lock()
+	defer archiveAllMembers.Unlock()
+	if enabled {
+		archiveAllMembers.chats[chatId] = true
+	} else {
+		delete(archiveAllMembers.chats, chatId)
+	}
+}
+
+func isArchiveAllMembers(chatId int64) bool {
+	archiveAllMembers.RLock()
+	defer archiveAllMembers.RUnlock()
+	return archiveAllMembers.chats[chatId]
+}
+
+// pendingSQLite — базы SQLite, из которых пользователь еще выбирает таблицы; загрузка идет в отдельной горутине
+var pendingSQLite = struct {
+	sync.Mutex
+	files map[int64]*sqliteSelectionError
+}{files: map[int64]*sqliteSelectionError{}}
+
+// tableMeta хранит сведения об исходном файле каждой загруженной таблицы. Импорт, команды и удаление
+// устаревших таблиц работают в разных горутинах, поэтому под мьютексом
+var tableMeta = struct {
+	sync.RWMutex
+	tables map[models.ClickhouseTableName]models.TableMeta
+}{tables: map[models.ClickhouseTableName]models.TableMeta{}}
+
+func setTableMeta(tableName models.ClickhouseTableName, meta models.TableMeta) {
+	tableMeta.Lock()
+	defer tableMeta.Unlock()
+	tableMeta.tables[tableName] = meta
+}
+
+func getTableMeta(tableName models.ClickhouseTableName) models.TableMeta {
+	tableMeta.RLock()
+	defer tableMeta.RUnlock()
+	return tableMeta.tables[tableName]
+}
+
+func deleteTableMeta(tableName models.ClickhouseTableName) {
+	tableMeta.Lock()
+	defer tableMeta.Unlock()
+	delete(tableMeta.tables, tableName)
+}
+
 func handleText(bot *tgbotapi.BotAPI, update tgbotapi.Update) {
 	message := update.Message
 	text := message.Text
 
+	// Ссылка на файл скачивается и загружается как отправленный документ
+	if rawURL := findURL(text); rawURL != "" {
+		go importFromURL(bot, message.Chat.ID, message.From.ID, rawURL)
+		return
+	}
+
+	// Таблица, вставленная из Excel или Google Sheets, загружается как CSV файл, а не разбирается на числа
+	if _, ok := detectPastedTable(text); ok {
+		go importPastedTable(bot, message.Chat.ID, message.From.ID, text)
+		return
+	}
+
 	// Проверяем, есть ли числа в сообщении
 	numbers := ExtractNumbers(text)
 	if len(numbers) > 0 {
@@ -103,22 +197,168 @@ func handleDocument(bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
 
 	// Unpack archive if necessary
 	go func(filePath string, chatId int64) {
-		table, err := handleFile(filePath)
-		if err != nil {
-			msg := tgbotapi.NewMessage(chatId, "Some error on processing file:"+err.Error())
-			bot.Send(msg)
-			return
-		}
-		fmt.Println("import finished", table)
-		currentTable[chatId] = table
-		stat := analyzeStatistics(table)
-		fmt.Println("analyze finished", stat)
-		sendStats(chatId, stat, bot)
-		toDeleteTable[table] = time.Now().Add(time.Hour)
+		status := sendProgressMessage(bot, chatId, "⏳ Файл получен, начинаю импорт")
+		progress := newImportProgress()
+		stopProgress := status.Watch(progress)
+		importChatFile(bot, chatId, filePath, status, progress, stopProgress)
 		//files with dates
 	}(filePath, message.Chat.ID)
 }
 
+// importFromURL скачивает файл по ссылке из сообщения и загружает его так же, как отправленный документ
+func importFromURL(bot *tgbotapi.BotAPI, chatId int64, userId int, rawURL string) {
+	status := sendProgressMessage(bot, chatId, "⏳ Скачиваю файл по ссылке")
+	progress := newImportProgress()
+	stopProgress := status.Watch(progress)
+	filePath, err := downloadURL(rawURL, filepath.Join(".", strconv.Itoa(userId)), urlDownloadLimits, progress)
+	if err != nil {
+		stopProgress()
+		log.Printf("Error downloading %s: %v", rawURL, err)
+		status.Update("❌ Не удалось скачать файл")
+		bot.Send(tgbotapi.NewMessage(chatId, "Error downloading file: "+err.Error()))
+		return
+	}
+	importChatFile(bot, chatId, filePath, status, progress, stopProgress)
+}
+
+// importPastedTable загружает таблицу из текста сообщения так же, как отправленный документ
+func importPastedTable(bot *tgbotapi.BotAPI, chatId int64, userId int, text string) {
+	status := sendProgressMessage(bot, chatId, "⏳ Вижу таблицу в сообщении, начинаю импорт")
+	filePath, err := savePastedTable(text, filepath.Join(".", strconv.Itoa(userId)))
+	if err != nil {
+		log.Printf("Error saving pasted table: %v", err)
+		status.Update("❌ Импорт не удался")
+		return
+	}
+	progress := newImportProgress()
+	stopProgress := status.Watch(progress)
+	importChatFile(bot, chatId, filePath, status, progress, stopProgress)
+}
+
+// importChatFile загружает файл в ClickHouse и присылает статистику; stopProgress останавливает показ прогресса
+func importChatFile(bot *tgbotapi.BotAPI, chatId int64, filePath string, status *progressMessage, progress *importProgress, stopProgress func()) {
+	tables, err := handleFile(filePath, chatImportOptions(bot, chatId, progress))
+	stopProgress()
+	if offerSQLiteTables(bot, chatId, status, err) {
+		return
+	}
+	if err != nil {
+		status.Update("❌ Импорт не удался")
+		msg := tgbotapi.NewMessage(chatId, "Some error on processing file:"+err.Error())
+		bot.Send(msg)
+		return
+	}
+	fmt.Println("import finished", tables)
+	activateImportedTables(chatId, tables, bot, status)
+}
+
+// offerSQLiteTables присылает список таблиц базы SQLite, если импорт ждет выбора таблиц; false — ошибка другая
+func offerSQLiteTables(bot *tgbotapi.BotAPI, chatId int64, status *progressMessage, err error) bool {
+	var selection *sqliteSelectionError
+	if !errors.As(err, &selection) {
+		return false
+	}
+	pendingSQLite.Lock()
+	pendingSQLite.files[chatId] = selection
+	pendingSQLite.Unlock()
+	status.Update("🗄 Выберите таблицы базы")
+	bot.Send(tgbotapi.NewMessage(chatId, formatSQLiteTables(selection.Tables)))
+	return true
+}
+
+// formatSQLiteTables — таблицы базы SQLite с командами для загрузки
+func formatSQLiteTables(tables []sqliteTableInfo) string {
+	var result strings.Builder
+	result.WriteString(fmt.Sprintf("🗄 В базе SQLite %d таблиц. Какую загрузить?\n\n", len(tables)))
+	for i, table := range tables {
+		result.WriteString(fmt.Sprintf("%d. %s (%d строк) /sqlite_%d\n", i+1, table.Name, table.Rows, i+1))
+	}
+	result.WriteString("\nЗагрузить все таблицы: /sqlite_all")
+	return result.String()
+}
+
+// importSQLiteSelection загружает выбранные таблицы базы, которую прислали последней; choice — номер таблицы или all
+func importSQLiteSelection(bot *tgbotapi.BotAPI, chatId int64, choice string) {
+	pendingSQLite.Lock()
+	selection := pendingSQLite.files[chatId]
+	pendingSQLite.Unlock()
+	if selection == nil {
+		bot.Send(tgbotapi.NewMessage(chatId, "Сначала пришлите базу SQLite"))
+		return
+	}
+	names := []string{}
+	if choice == "all" {
+		for _, table := range selection.Tables {
+			names = append(names, table.Name)
+		}
+	} else if n, err := strconv.Atoi(choice); err == nil && n >= 1 && n <= len(selection.Tables) {
+		names = append(names, selection.Tables[n-1].Name)
+	} else {
+		bot.Send(tgbotapi.NewMessage(chatId, formatSQLiteTables(selection.Tables)))
+		return
+	}
+
+	status := sendProgressMessage(bot, chatId, "⏳ Загружаю таблицы базы")
+	progress := newImportProgress()
+	stopProgress := status.Watch(progress)
+	opts := chatImportOptions(bot, chatId, progress)
+	opts.SQLiteTables = names
+	tables, err := handleFile(selection.FilePath, opts)
+	stopProgress()
+	if err != nil {
+		status.Update("❌ Импорт не удался")
+		bot.Send(tgbotapi.NewMessage(chatId, "Some error on processing file:"+err.Error()))
+		return
+	}
+	activateImportedTables(chatId, tables, bot, status)
+}
+
+// activateImportedTables делает первую таблицу текущей, присылает список остальных и статистику
+// status — сообщение о ходе загрузки, в нем показывается этап анализа; может быть nil
+func activateImportedTables(chatId int64, tables []models.ImportedTable, bot *tgbotapi.BotAPI, status *progressMessage) {
+	for _, table := range tables {
+		toDeleteTable[table.Name] = time.Now().Add(time.Hour)
+		toDeleteTable[models.ClickhouseTableName(rejectedTableName(string(table.Name)))] = time.Now().Add(time.Hour)
+		setTableMeta(table.Name, table.Meta)
+	}
+	currentTable[chatId] = tables[0].Name
+	followCurrentTable(chatId, tables[0].Name)
+	if skipped := tables[0].Meta.SkippedFiles; len(skipped) > 0 {
+		bot.Send(tgbotapi.NewMessage(chatId, "⚠️ Не удалось загрузить файлы из архива:\n• "+strings.Join(skipped, "\n• ")))
+	}
+	var inferred []string
+	for _, table := range tables {
+		inferred = append(inferred, table.Meta.InferredColumns...)
+	}
+	if len(inferred) > 0 {
+		bot.Send(tgbotapi.NewMessage(chatId, "⚠️ Тип колонок базы не совпал с объявленным:\n• "+strings.Join(inferred, "\n• ")))
+	}
+	setChatTables(chatId, tables)
+	if len(tables) > 1 {
+		msg := tgbotapi.NewMessage(chatId, formatTablesList(tables, tables[0].Name))
+		bot.Send(msg)
+	}
+	status.Update("🔎 Файл загружен, анализирую…")
+	stat := analyzeStatistics(tables[0].Name)
+	fmt.Println("analyze finished", stat)
+	status.Update("✅ Анализ готов")
+	sendStats(chatId, stat, bot)
+}
+
+// formatTablesList формирует список таблиц с командами для переключения
+func formatTablesList(tables []models.ImportedTable, current models.ClickhouseTableName) string {
+	var result strings.Builder
+	result.WriteString(fmt.Sprintf("📚 Файл содержит %d таблиц:\n\n", len(tables)))
+	for i, table := range tables {
+		marker := ""
+		if table.Name == current {
+			marker = " ✅"
+		}
+		result.WriteString(fmt.Sprintf("%d. %s /table_%d%s\n", i+1, table.Source, i+1, marker))
+	}
+	return result.String()
+}
+
 // splitMessage splits a long message into parts at logical breaks
 func splitMessage(text string, maxLength int) []string {
 	if len(text) <= maxLength {
@@ -193,12 +433,10 @@ func sendStats(chatId int64, stat map[string]CommonStat, bot *tgbotapi.BotAPI) {
 	// Формируем сообщение со списком колонок
 	columnMsg := "📊 Columns in your table:\n\n"
 	for i, col := range columns {
-		// Убираем первые 5 символов из имени колонки, если длина позволяет
-		colName := col.Name
-		if len(colName) > 5 {
-			colName = colName[5:]
-		}
-		columnMsg += fmt.Sprintf("%d. %s (%s)\n", i+1, colName, col.Type)
+		columnMsg += fmt.Sprintf("%d. %s (%s)\n", i+1, columnLabel(tableName, col.Name), col.Type)
+	}
+	if encoding := getTableMeta(tableName).Encoding; encoding != "" {
+		columnMsg += fmt.Sprintf("\n🔤 Кодировка файла: %s\n", encoding)
 	}
 
 	// Отправляем информацию о колонках
@@ -208,6 +446,8 @@ func sendStats(chatId int64, stat map[string]CommonStat, bot *tgbotapi.BotAPI) {
 		log.Printf("Error sending column info: %v", err)
 	}
 
+	sendRejectedRows(chatId, db, tableName, bot)
+
 	// Продолжаем с основной статистикой
 	formattedText := GenerateCommonInfoMsg(stat)
 	// Split long messages
@@ -224,6 +464,11 @@ func sendStats(chatId int64, stat map[string]CommonStat, bot *tgbotapi.BotAPI) {
 		}
 	}
 
+	sendMissingValues(chatId, db, tableName, columns, bot)
+	sendDistributionShapes(chatId, db, tableName, columns, bot)
+	sendCorrelations(chatId, db, tableName, columns, bot)
+	sendAssociations(chatId, db, tableName, columns, stat, bot)
+
 	// Отправляем файлы с общей информацией
 	fileName := "stats" + time.Now().Format("20060102-150405") + ".txt"
 	data := tgbotapi.FileBytes{
@@ -258,7 +503,7 @@ func sendStats(chatId int64, stat map[string]CommonStat, bot *tgbotapi.BotAPI) {
 	if len(timeSeriesData) > 0 {
 
 		// Генерируем CSV файлы для временных рядов
-		csvFiles := GenerateCSVByDates(stat)
+		csvFiles := GenerateCSVByDates(stat, tableName)
 		zipData := ZipArchive(csvFiles)
 		if zipData != nil {
 			fileName := "time_series_data_" + time.Now().Format("20060102-150405") + ".zip"
@@ -278,6 +523,116 @@ func sendStats(chatId int64, stat map[string]CommonStat, bot *tgbotapi.BotAPI) {
 
 }
 
+// sendRejectedRows присылает сводку по строкам, которые не попали в таблицу, и файл с ними
+func sendRejectedRows(chatId int64, db *gorm.DB, tableName models.ClickhouseTableName, bot *tgbotapi.BotAPI) {
+	reasons, err := loadRejectedReasons(db, tableName)
+	if err != nil {
+		log.Printf("Error loading rejected rows: %v", err)
+		return
+	}
+	summary := formatRejectedSummary(reasons)
+	if summary == "" {
+		return
+	}
+	data, err := exportRejectedRows(db, tableName)
+	if err != nil {
+		log.Printf("Error exporting rejected rows: %v", err)
+		bot.Send(tgbotapi.NewMessage(chatId, "⚠️ "+summary))
+		return
+	}
+	fileName := "rejected_rows_" + time.Now().Format("20060102-150405") + ".csv"
+	msg := tgbotapi.NewDocumentUpload(chatId, tgbotapi.FileBytes{Name: fileName, Bytes: data})
+	msg.Caption = "⚠️ " + summary
+	if _, err := bot.Send(msg); err != nil {
+		log.Printf("Error sending rejected rows: %v", err)
+	}
+}
+
+// sendMissingValues присылает пропуски по колонкам, их частые сочетания и график доли пропусков
+func sendMissingValues(chatId int64, db *gorm.DB, tableName models.ClickhouseTableName, columns []models.ColumnInfo, bot *tgbotapi.BotAPI) {
+	profile, err := computeMissingProfile(db, tableName, columns)
+	if err != nil {
+		log.Printf("Error computing missing values: %v", err)
+		return
+	}
+	text := formatMissingProfile(tableName, profile)
+	if text == "" {
+		return
+	}
+	for _, part := range splitMessage(text, 4000) {
+		if _, err := bot.Send(tgbotapi.NewMessage(chatId, part)); err != nil {
+			log.Printf("Error sending missing values: %v", err)
+			return
+		}
+	}
+
+	labels, shares := []string{}, []float64{}
+	for _, column := range profile.WithMissing() {
+		labels = append(labels, columnLabel(tableName, column))
+		shares = append(shares, profile.Share(column)*100)
+	}
+	graph, err := plot.DrawPlotBar(plot.NewDataXStringsForGraph(labels, shares, "% пропусков", "Доля пропусков по колонкам, %", ""))
+	if err != nil {
+		log.Printf("Error generating missing values chart: %v", err)
+		return
+	}
+	sendGraphVisualization(graph, "missing", "пропуски", "", chatId, bot)
+}
+
+// sendCorrelations присылает самые сильные связи между числовыми колонками, подробности — в /corr
+func sendCorrelations(chatId int64, db *gorm.DB, tableName models.ClickhouseTableName, columns []models.ColumnInfo, bot *tgbotapi.BotAPI) {
+	matrix, err := computeCorrelations(db, tableName, columns)
+	if err != nil {
+		log.Printf("Error computing correlations: %v", err)
+		return
+	}
+	if matrix == nil {
+		return
+	}
+	text := formatCorrelations(tableName, matrix, reportCorrelationsLimit)
+	if text == "" {
+		return
+	}
+	if _, err := bot.Send(tgbotapi.NewMessage(chatId, text+"\nТепловая карта и все пары: /corr")); err != nil {
+		log.Printf("Error sending correlations: %v", err)
+	}
+}
+
+// sendDistributionShapes присылает лучшее распределение и форму каждой числовой колонки, подробности — по /graph_<колонка>
+func sendDistributionShapes(chatId int64, db *gorm.DB, tableName models.ClickhouseTableName, columns []models.ColumnInfo, bot *tgbotapi.BotAPI) {
+	numeric, shapes, err := computeDistributionShapes(db, tableName, columns)
+	if err != nil {
+		log.Printf("Error fitting distributions: %v", err)
+		return
+	}
+	text := formatDistributionShapes(tableName, numeric, shapes)
+	if text == "" {
+		return
+	}
+	for _, part := range splitMessage(text, 4000) {
+		if _, err := bot.Send(tgbotapi.NewMessage(chatId, part)); err != nil {
+			log.Printf("Error sending distribution shapes: %v", err)
+			return
+		}
+	}
+}
+
+// sendAssociations присылает значимые связи между категориальными колонками, таблица по паре — в /crosstab
+func sendAssociations(chatId int64, db *gorm.DB, tableName models.ClickhouseTableName, columns []models.ColumnInfo, stat map[string]CommonStat, bot *tgbotapi.BotAPI) {
+	pairs, err := computeAssociations(db, tableName, columns, stat)
+	if err != nil {
+		log.Printf("Error computing associations: %v", err)
+		return
+	}
+	text := formatAssociations(tableName, pairs, reportAssociationsLimit)
+	if text == "" {
+		return
+	}
+	if _, err := bot.Send(tgbotapi.NewMessage(chatId, text+"\nТаблица сопряженности пары: /crosstab <колонка> <колонка>")); err != nil {
+		log.Printf("Error sending associations: %v", err)
+	}
+}
+
 // WriteArtifact создает артефакт с указанным ID и содержимым
 func WriteArtifact(id string, artifactType string, content string) error {
 	artifactPath := fmt.Sprintf("artifacts/%s", id)
@@ -301,33 +656,88 @@ func marshalJSON(v interface{}) string {
 	}
 	return string(b)
 }
-func handleFile(filePath string) (models.ClickhouseTableName, error) {
-	// Unpack archive if necessary
-	unpackedFilePath, err := unpackArchive(filePath)
-	if err != nil {
-		log.Printf("Error unpacking file: %v", err)
-		return "", fmt.Errorf("handleFile>unpackArchive err: %s", err)
+
+// chatImportOptions собирает настройки импорта чата: режим архивов, исправленные типы и дописывание в текущую таблицу.
+// Если дописать некуда, файл загружается в новую таблицу, а дописывание выключается и пользователь об этом узнает
+func chatImportOptions(bot *tgbotapi.BotAPI, chatId int64, progress *importProgress) importOptions {
+	opts := importOptions{AllArchiveMembers: isArchiveAllMembers(chatId), Progress: progress, Schemas: chatSchemas(chatId)}
+	if tableName := appendTable(chatId); tableName != "" {
+		cfg := config.GetConfig()
+		db, err := gorm.Open(mysql.Open(cfg.DatabaseDSN), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+		var target *appendTarget
+		if err == nil {
+			target, err = loadAppendTarget(db, tableName)
+		}
+		if err != nil {
+			log.Printf("Error loading append target %s: %v", tableName, err)
+			setAppendMode(chatId, "")
+			bot.Send(tgbotapi.NewMessage(chatId, "⚠️ Не удалось дописать в текущую таблицу ("+err.Error()+"), файл загружается в новую таблицу. Дописывание выключено, включить для новой таблицы: /append"))
+			return opts
+		}
+		opts.Append = target
 	}
-	if unpackedFilePath != "" {
-		filePath = unpackedFilePath
+	return opts
+}
+
+// withSourcePath запоминает загруженный файл у таблиц, чтобы /cast мог пересобрать их с другими типами
+func withSourcePath(tables []models.ImportedTable, filePath string) []models.ImportedTable {
+	for i := range tables {
+		tables[i].Meta.SourcePath = filePath
 	}
+	return tables
+}
 
-	// Import data into ClickHouse
+func handleFile(filePath string, opts importOptions) ([]models.ImportedTable, error) {
 	// Подключаемся к базе данных
 	cfg := config.GetConfig()
 	db, err := gorm.Open(mysql.Open(cfg.DatabaseDSN), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
 	if err != nil {
 		log.Println("error on connect to clickhouse", err)
-		return "", fmt.Errorf("handleFile>gorm.Open err: %s", err)
+		return nil, fmt.Errorf("handleFile>gorm.Open err: %s", err)
+	}
+
+	uploadPath := filePath
+	if opts.Append != nil {
+		// Дописанную таблицу собрали несколько загрузок, из одного файла ее не пересобрать
+		uploadPath = ""
+	}
+	archive := isArchiveFile(filePath)
+	if archive {
+		opts.Progress.SetStage("распаковка архива")
+	}
+	if opts.AllArchiveMembers && archive {
+		paths, err := unpackArchiveAll(filePath)
+		if err != nil {
+			log.Printf("Error unpacking file: %v", err)
+			return nil, fmt.Errorf("handleFile>unpackArchiveAll err: %s", err)
+		}
+		tables, err := importArchiveMembers(paths, db, opts)
+		if err != nil {
+			log.Printf("Error importing data into ClickHouse: %v", err)
+			return nil, fmt.Errorf("handleFile>importArchiveMembers err: %s", err)
+		}
+		return withSourcePath(tables, uploadPath), nil
 	}
 
-	tableName, err := importDataIntoClickHouse(filePath, db)
+	// Unpack archive if necessary
+	unpackedFilePath, err := unpackArchive(filePath)
+	if err != nil {
+		log.Printf("Error unpacking file: %v", err)
+		return nil, fmt.Errorf("handleFile>unpackArchive err: %s", err)
+	}
+	if unpackedFilePath != "" {
+		filePath = unpackedFilePath
+	}
+	opts.Progress.SetStage(filepath.Base(filePath))
+
+	// Import data into ClickHouse
+	tables, err := importFileIntoClickHouse(filePath, db, opts)
 	if err != nil {
 		log.Printf("Error importing data into ClickHouse: %v", err)
-		return "", fmt.Errorf("handleFile>importDataIntoClickHouse err: %s", err)
+		return nil, fmt.Errorf("handleFile>importFileIntoClickHouse err: %s", err)
 	}
-	fmt.Print(tableName)
-	return tableName, nil
+	fmt.Print(tables)
+	return withSourcePath(tables, uploadPath), nil
 }
 
 func Select(stat map[string]CommonStat, chatID int64, bot *tgbotapi.BotAPI) {
@@ -370,7 +780,7 @@ func Select(stat map[string]CommonStat, chatID int64, bot *tgbotapi.BotAPI) {
 					timeStamp := float64(t.Unix())
 					x = append(x, timeStamp)
 					z = append(z, float64(point["cnt"].(int64)))
-					y = append(y, float64(point["sum_value"].(int64)))
+					y = append(y, toFloat64(point["sum_value"]))
 				}
 
 				// Если точек больше maxPoints, переходим к следующему интервалу
@@ -0,0 +1,72 @@
+// telegram_progress.go
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// Как часто обновляется сообщение о прогрессе: Telegram ограничивает частоту редактирования
+const progressUpdateInterval = 3 * time.Second
+
+// progressMessage — одно сообщение в чате, которое редактируется по ходу загрузки и анализа
+type progressMessage struct {
+	mu        sync.Mutex
+	bot       *tgbotapi.BotAPI
+	chatId    int64
+	messageId int
+	lastText  string
+}
+
+// sendProgressMessage отправляет сообщение, которое потом будет редактироваться; при ошибке отправки вернет nil
+func sendProgressMessage(bot *tgbotapi.BotAPI, chatId int64, text string) *progressMessage {
+	sent, err := bot.Send(tgbotapi.NewMessage(chatId, text))
+	if err != nil {
+		log.Printf("Error sending progress message: %v", err)
+		return nil
+	}
+	return &progressMessage{bot: bot, chatId: chatId, messageId: sent.MessageID, lastText: text}
+}
+
+// Update заменяет текст сообщения, если он изменился
+func (m *progressMessage) Update(text string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if text == m.lastText {
+		return
+	}
+	if _, err := m.bot.Send(tgbotapi.NewEditMessageText(m.chatId, m.messageId, text)); err != nil {
+		log.Printf("Error editing progress message: %v", err)
+		return
+	}
+	m.lastText = text
+}
+
+// Watch показывает прогресс импорта, пока не будет вызвана возвращенная функция остановки
+func (m *progressMessage) Watch(progress *importProgress) (stop func()) {
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		ticker := time.NewTicker(progressUpdateInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				m.Update(formatProgress(progress.Snapshot()))
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-finished
+	}
+}
@@ -3,7 +3,6 @@ package main
 import (
 	"fmt"
 	"log"
-	"strings"
 	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
@@ -13,7 +12,7 @@ import (
 // Параметры:
 //   - graph: байтовый массив с данными изображения
 //   - visualType: тип визуализации (histogram, timeseries, density)
-//   - columnName: имя анализируемой колонки
+//   - columnName: название анализируемой колонки для подписи, см. columnLabel
 //   - chatID: ID чата для отправки
 //   - api: экземпляр Telegram API для отправки сообщений
 //   - timeUnit: единица измерения времени (опционально, для временных рядов)
@@ -21,7 +20,7 @@ func sendGraphVisualization(graph []byte, visualType string, columnName string,
 	// Формируем имя файла с учетом типа визуализации и временной метки
 	fileName := fmt.Sprintf("%s_%s_%s.png",
 		visualType,
-		columnName,
+		replaceSpecialSymbols(columnName),
 		time.Now().Format("20060102-150405"))
 
 	// Подготавливаем файл для отправки
@@ -71,12 +70,6 @@ func sendGraphVisualization(graph []byte, visualType string, columnName string,
 }
 
 func generateVizualDescription(description, columnName string, nameGraph string, timeUnit ...string) string {
-	if len(columnName) > 5 {
-		columnName = columnName[5:]
-		if strings.Contains(columnName, "__") {
-			columnName = strings.Split(columnName, "__")[0]
-		}
-	}
 	var caption string
 	switch description {
 	case "histogram":
@@ -85,7 +78,8 @@ func generateVizualDescription(description, columnName string, nameGraph string,
 			columnName)
 	case "density":
 		caption = fmt.Sprintf("График плотности распределения: %s\n"+
-			"Отображает непрерывное распределение вероятностей значений.",
+			"Отображает непрерывное распределение вероятностей значений. "+
+			"Пунктир — лучше всего подходящее распределение.",
 			columnName)
 	case "timeseries":
 		timeUnitStr := ""
@@ -95,6 +89,16 @@ func generateVizualDescription(description, columnName string, nameGraph string,
 		caption = fmt.Sprintf("Временной ряд: %s%s\n"+
 			"Показывает %s.",
 			columnName, timeUnitStr, nameGraph)
+	case "heatmap":
+		caption = fmt.Sprintf("Тепловая карта корреляций (%s) между числовыми колонками\n"+
+			"Красный — значения растут вместе, синий — одно растет, другое падает, белый — связи нет.",
+			columnName)
+	case "crosstab":
+		caption = fmt.Sprintf("Доли значений %s внутри каждого значения первой колонки\n"+
+			"Если столбцы похожи, колонки независимы.",
+			nameGraph)
+	case "missing":
+		caption = "Доля пропусков (NULL, пустых строк и строк из пробелов) в каждой колонке, %"
 	case "FrequencyPlot":
 		caption = fmt.Sprintf("Визуализация частоты встречаемости строковых значений ")
 	case "AggregationPlot":
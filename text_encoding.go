@@ -0,0 +1,155 @@
+// text_encoding.go
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// Сколько байт файла анализируем для определения кодировки
+const encodingSampleSize = 64 * 1024
+
+// textEncoding — определенная кодировка текстового файла
+type textEncoding struct {
+	Name     string
+	Encoding encoding.Encoding // nil, если файл уже в UTF-8
+}
+
+var utf8Encoding = textEncoding{Name: "UTF-8"}
+
+// Однобайтовые кириллические кодировки, которые встречаются в выгрузках 1С и старых версий Excel
+var cyrillicCandidates = []textEncoding{
+	{Name: "Windows-1251", Encoding: charmap.Windows1251},
+	{Name: "KOI8-R", Encoding: charmap.KOI8R},
+	{Name: "CP866", Encoding: charmap.CodePage866},
+}
+
+// detectTextEncoding определяет кодировку по началу файла:
+// BOM, нулевые байты UTF-16, валидность UTF-8 и частоты кириллических букв
+func detectTextEncoding(sample []byte) textEncoding {
+	switch {
+	case bytes.HasPrefix(sample, []byte{0xEF, 0xBB, 0xBF}):
+		return utf8Encoding
+	case bytes.HasPrefix(sample, []byte{0xFF, 0xFE}):
+		return textEncoding{Name: "UTF-16LE", Encoding: unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM)}
+	case bytes.HasPrefix(sample, []byte{0xFE, 0xFF}):
+		return textEncoding{Name: "UTF-16BE", Encoding: unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM)}
+	}
+
+	// UTF-16 без BOM: у латиницы и цифр каждый второй байт нулевой
+	if len(sample) >= 4 {
+		var evenZeros, oddZeros int
+		for i, b := range sample {
+			if b == 0 {
+				if i%2 == 0 {
+					evenZeros++
+				} else {
+					oddZeros++
+				}
+			}
+		}
+		half := len(sample) / 2
+		if oddZeros > half*3/10 && evenZeros < oddZeros/10 {
+			return textEncoding{Name: "UTF-16LE", Encoding: unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM)}
+		}
+		if evenZeros > half*3/10 && oddZeros < evenZeros/10 {
+			return textEncoding{Name: "UTF-16BE", Encoding: unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM)}
+		}
+	}
+
+	if isValidUTF8Prefix(sample) {
+		return utf8Encoding
+	}
+
+	// Выбираем однобайтовую кодировку, в которой текст больше всего похож на русский
+	best := textEncoding{Name: "Windows-1252", Encoding: charmap.Windows1252}
+	bestScore := 0
+	for _, candidate := range cyrillicCandidates {
+		decoded, err := candidate.Encoding.NewDecoder().Bytes(sample)
+		if err != nil {
+			continue
+		}
+		if score := cyrillicScore(string(decoded)); score > bestScore {
+			best, bestScore = candidate, score
+		}
+	}
+	return best
+}
+
+// isValidUTF8Prefix проверяет UTF-8, допуская обрезанный на границе выборки последний символ
+func isValidUTF8Prefix(sample []byte) bool {
+	for i := 0; i < len(sample); {
+		r, size := utf8.DecodeRune(sample[i:])
+		if r == utf8.RuneError && size <= 1 {
+			return len(sample)-i < utf8.UTFMax && !utf8.FullRune(sample[i:])
+		}
+		i += size
+	}
+	return true
+}
+
+// cyrillicScore: в русском тексте преобладают строчные буквы, а неверная кодировка
+// дает заглавные буквы, псевдографику и кириллицу вперемешку с латиницей внутри слова
+func cyrillicScore(text string) int {
+	score := 0
+	prevLatin, prevCyrillic := false, false
+	for _, r := range text {
+		isLatin := (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+		isCyrillic := (r >= 'А' && r <= 'я') || r == 'ё' || r == 'Ё'
+		switch {
+		case r < 0x80:
+		case (r >= 'а' && r <= 'я') || r == 'ё':
+			score++
+		case isCyrillic:
+		default:
+			score--
+		}
+		if (isCyrillic && prevLatin) || (isLatin && prevCyrillic) {
+			score -= 2
+		}
+		prevLatin, prevCyrillic = isLatin, isCyrillic
+	}
+	return score
+}
+
+// detectFileEncoding определяет кодировку файла по первым encodingSampleSize байтам
+func detectFileEncoding(filePath string) textEncoding {
+	return detectTextEncoding(readMagic(filePath, encodingSampleSize))
+}
+
+// decodedFile читает файл с перекодировкой в UTF-8 на лету
+type decodedFile struct {
+	io.Reader
+	file    *os.File
+	counter *countingReader
+}
+
+func (d *decodedFile) Close() error {
+	return d.file.Close()
+}
+
+// BytesRead возвращает, сколько байт исходного файла уже прочитано
+func (d *decodedFile) BytesRead() int64 {
+	return d.counter.BytesRead()
+}
+
+// openTextFile открывает текстовый файл и прозрачно перекодирует его содержимое в UTF-8
+func openTextFile(filePath string) (*decodedFile, textEncoding, error) {
+	enc := detectFileEncoding(filePath)
+	f, err := os.OpenFile(filePath, os.O_RDONLY, 0655)
+	if err != nil {
+		return nil, enc, err
+	}
+	counter := &countingReader{reader: f}
+	if enc.Encoding == nil {
+		return &decodedFile{Reader: counter, file: f, counter: counter}, enc, nil
+	}
+	return &decodedFile{Reader: transform.NewReader(counter, enc.Encoding.NewDecoder()), file: f, counter: counter}, enc, nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+	"gorm.io/gorm"
+)
+
+const russianCSV = "Название;Цена;Город\nМолоко;89.5;Москва\nХлеб;45;Санкт-Петербург"
+
+func encodeString(t *testing.T, enc encoding.Encoding, s string) []byte {
+	encoded, err := enc.NewEncoder().Bytes([]byte(s))
+	assert.NoError(t, err)
+	return encoded
+}
+
+func TestDetectTextEncoding(t *testing.T) {
+	testCases := []struct {
+		name     string
+		sample   []byte
+		expected string
+	}{
+		{"utf-8", []byte(russianCSV), "UTF-8"},
+		{"utf-8 bom", append([]byte{0xEF, 0xBB, 0xBF}, russianCSV...), "UTF-8"},
+		{"utf-8 cut in the middle of rune", []byte(russianCSV)[:3], "UTF-8"},
+		{"windows-1251", encodeString(t, charmap.Windows1251, russianCSV), "Windows-1251"},
+		{"koi8-r", encodeString(t, charmap.KOI8R, russianCSV), "KOI8-R"},
+		{"cp866", encodeString(t, charmap.CodePage866, russianCSV), "CP866"},
+		{"windows-1252", encodeString(t, charmap.Windows1252, "name;city\nJosé;Zürich\n"), "Windows-1252"},
+		{"utf-16le bom", encodeString(t, unicode.UTF16(unicode.LittleEndian, unicode.UseBOM), russianCSV), "UTF-16LE"},
+		{"utf-16be bom", encodeString(t, unicode.UTF16(unicode.BigEndian, unicode.UseBOM), russianCSV), "UTF-16BE"},
+		{"utf-16le no bom", encodeString(t, unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM), "id,value\n1,2\n"), "UTF-16LE"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, detectTextEncoding(tc.sample).Name)
+		})
+	}
+}
+
+func TestImportNonUTF8CSV(t *testing.T) {
+	original := getMD5String
+	getMD5String = func(input string) string {
+		return "123456"
+	}
+	defer func() {
+		getMD5String = original
+	}()
+
+	testCases := []struct {
+		name     string
+		content  []byte
+		encoding string
+	}{
+		{"windows-1251", encodeString(t, charmap.Windows1251, russianCSV), "Windows-1251"},
+		{"utf-16le bom", encodeString(t, unicode.UTF16(unicode.LittleEndian, unicode.UseBOM), russianCSV), "UTF-16LE"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			filePath := filepath.Join(t.TempDir(), "export.csv")
+			assert.NoError(t, os.WriteFile(filePath, tc.content, 0644))
+
+			delimiter, err := detectDelimiter(filePath)
+			assert.NoError(t, err)
+			assert.Equal(t, ';', delimiter)
+
+			mockDB := NewMockDB()
+			mockDB.On("Exec", mock.Anything, mock.Anything).Return(&gorm.DB{})
+			tables, err := importFileIntoClickHouse(filePath, mockDB, importOptions{})
+			assert.NoError(t, err)
+			assert.Len(t, tables, 1)
+			assert.Equal(t, tc.encoding, tables[0].Meta.Encoding)
+
+			createSQL := ""
+			for _, call := range mockDB.Calls {
+				if query := call.Arguments.String(0); strings.HasPrefix(query, "CREATE TABLE") {
+					createSQL = query
+				}
+			}
+			assert.Contains(t, createSQL, "0001_nazvanie String")
+			assert.Contains(t, createSQL, "0002_tsena Float64")
+			assert.Contains(t, mockDB.lastQuery, "1,Молоко,89.5,Москва\n2,Хлеб,45,Санкт-Петербург\n")
+		})
+	}
+}
@@ -0,0 +1,425 @@
+// type_inference.go
+package main
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	inferSampleRows = 50000 // сколько строк просматривается при определении типов
+
+	decimalPrecision = 18
+	decimalMinScale  = 2 // Decimal выбирается для сумм с копейками, а не для любых дробей вроде 1.5
+	decimalMaxScale  = 4
+
+	dictionaryMinRows     = 100   // на маленьких таблицах словарные типы ничего не дают
+	lowCardinalityMaxUniq = 10000 // рекомендация ClickHouse для LowCardinality
+	enumMaxValues         = 16
+	enumMaxValueLength    = 64
+
+	// Немного текста среди чисел или дат считается ошибками в данных: колонка сохраняет тип,
+	// а такие строки при импорте уходят в таблицу отклоненных строк
+	strayMinValues  = 100 // на меньшей выборке любое текстовое значение делает колонку текстовой
+	strayMaxPercent = 1
+)
+
+// typesWeight — лестница типов: при смешении значений колонка получает более общий тип.
+// Bool, UUID и IP в лестницу не входят и при смешении с чем-то другим становятся String
+var typesWeight = []string{"", "DateTime64", "Date", "Int64", "Decimal", "Float64", "String"}
+
+var (
+	uuidPattern    = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	decimalPattern = regexp.MustCompile(`^[-+]?(\d+)\.(\d+)$`)
+	boolValues     = map[string]bool{
+		"true": true, "false": false, "yes": true, "no": false, "y": true, "n": false,
+		"on": true, "off": false, "да": true, "нет": false, "1": true, "0": false,
+	}
+)
+
+// columnFormat — как записаны значения колонки в файле; по нему значения приводятся к виду ClickHouse при вставке
+type columnFormat struct {
+	DecimalComma bool     // "1 234,56": запятая отделяет дробную часть, точка и пробелы — разряды
+	Unit         string   // валюта или %, срезанные со значений
+	DateLayouts  []string // форматы дат колонки в порядке голосов
+	Epoch        string   // целые числа похожи на Unix время: EPOCH_SECONDS или EPOCH_MILLISECONDS
+	BoolAsNumber bool     // булевы значения дописываются в числовую колонку как 1 и 0
+}
+
+// columnInference накапливает сведения о значениях одной колонки
+type columnInference struct {
+	kind      string
+	scale     int  // знаков после точки у Decimal
+	intDigits int  // максимум цифр в целой части чисел
+	mixed     bool // у дробных значений разное число знаков, Decimal не подходит
+	values    int
+	uniq      map[string]struct{} // nil, когда различных значений слишком много для словаря
+	enumSafe  bool                // значения короткие и без пробелов по краям
+	strays    int                 // текстовые значения в колонке, которая иначе не текстовая
+
+	// Числа в местной записи: голоса за десятичную запятую и точку, срезанные единицы,
+	// и неоднозначные значения "1,234", прочитанные обоими способами до подсчета голосов
+	commaVotes, pointVotes int
+	units                  map[string]int
+	ambiguousComma         *columnInference
+	ambiguousPoint         *columnInference
+
+	dateVotes map[string]int // сколько значений подошло под каждый формат даты
+	epochs    map[string]int // сколько целых значений похоже на Unix время в секундах и миллисекундах
+}
+
+func newColumnInference() *columnInference {
+	return &columnInference{uniq: map[string]struct{}{}, enumSafe: true, units: map[string]int{}, dateVotes: map[string]int{}, epochs: map[string]int{}}
+}
+
+// inferColumnTypes определяет типы колонок по первым 50000 строкам, а также запись значений:
+// десятичную запятую, срезанную валюту или %, форматы дат и Unix время
+func inferColumnTypes(r rowReader, width int) ([]string, []string, []columnFormat) {
+	columns := make([]*columnInference, width)
+	for n := range columns {
+		columns[n] = newColumnInference()
+	}
+	nullables := make([]string, width)
+
+	// Enum допустим, только если просмотрены все строки: иначе в остатке файла может встретиться новое значение.
+	// Строки с другим числом полей пропускаются, поэтому после них просмотренными все строки не считаются
+	reachedEnd, wrongWidth := false, false
+	for i := 0; i < inferSampleRows; i++ {
+		values, err := r.Read()
+		if err != nil {
+			reachedEnd = true
+			break
+		}
+		// Строки с другим числом полей не влияют на типы: при импорте они уйдут в таблицу отклоненных строк
+		if len(values) != width {
+			wrongWidth = true
+			continue
+		}
+		for n, value := range values {
+			// Remove UTF-8 BOM (Byte Order Mark) if present. BOM is a sequence of bytes (0xEF,0xBB,0xBF)
+			// that some text editors (especially on Windows) add at the beginning of UTF-8 files
+			value = strings.TrimPrefix(value, "\uFEFF")
+			if value == "" || value == "\\N" {
+				nullables[n] = " NULL "
+				continue
+			}
+			columns[n].add(value)
+		}
+	}
+
+	types := make([]string, width)
+	formats := make([]columnFormat, width)
+	for n, column := range columns {
+		formats[n] = column.resolveFormat()
+		types[n] = column.columnType(reachedEnd && !wrongWidth)
+	}
+	return types, nullables, formats
+}
+
+// classifyValue возвращает тип одного значения, кроме дат; для чисел также число знаков после точки и цифр целой части
+func classifyValue(value string) (kind string, scale, intDigits int) {
+	if _, err := strconv.ParseUint(value, 10, 64); err == nil {
+		return "Int64", 0, len(strings.TrimLeft(value, "+-"))
+	}
+	if _, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return "Int64", 0, len(strings.TrimLeft(value, "+-"))
+	}
+	if _, err := strconv.ParseFloat(value, 64); err == nil {
+		if m := decimalPattern.FindStringSubmatch(value); m != nil && len(m[2]) >= decimalMinScale && len(m[2]) <= decimalMaxScale {
+			return "Decimal", len(m[2]), len(m[1])
+		}
+		return "Float64", 0, 0
+	}
+	if _, ok := boolValues[strings.ToLower(strings.TrimSpace(value))]; ok {
+		return "Bool", 0, 0
+	}
+	if uuidPattern.MatchString(value) {
+		return "UUID", 0, 0
+	}
+	if ip := net.ParseIP(value); ip != nil {
+		if strings.Contains(value, ":") {
+			return "IPv6", 0, 0
+		}
+		return "IPv4", 0, 0
+	}
+	return "String", 0, 0
+}
+
+func (c *columnInference) add(value string) {
+	c.values++
+	if c.uniq != nil {
+		c.uniq[value] = struct{}{}
+		if len(c.uniq) > lowCardinalityMaxUniq {
+			c.uniq = nil
+		}
+	}
+	if len(value) > enumMaxValueLength || strings.TrimSpace(value) != value {
+		c.enumSafe = false
+	}
+
+	// Даты проверяются, только пока колонка может оказаться датой: после чисел и текста голоса ничего не решают
+	if c.kind == "" || c.kind == "Date" || c.kind == "DateTime64" {
+		if layouts := matchDateLayouts(value); len(layouts) > 0 {
+			for _, layout := range layouts {
+				c.dateVotes[layout]++
+			}
+			kind := "Date"
+			if isDateTimeLayout(layouts[0]) {
+				kind = "DateTime64"
+			}
+			c.addKind(kind, 0, 0)
+			return
+		}
+	}
+
+	kind, scale, intDigits := classifyValue(value)
+	if kind == "Int64" {
+		if number, err := strconv.ParseInt(value, 10, 64); err == nil {
+			if epoch := epochKind(number); epoch != "" {
+				c.epochs[epoch]++
+			}
+		}
+	}
+	if kind == "String" {
+		if number, unit, separator, ok := sniffLocaleNumber(value); ok {
+			c.addLocaleNumber(value, number, unit, separator)
+			return
+		}
+		if c.kind != "String" {
+			c.strays++
+			// Явно текстовая колонка: дальше значения не проверяются на даты
+			if c.values >= strayMinValues && c.tooManyStrays() {
+				c.addKind("String", 0, 0)
+			}
+			return
+		}
+	}
+	c.addKind(kind, scale, intDigits)
+}
+
+func (c *columnInference) tooManyStrays() bool {
+	return c.strays > 0 && (c.values < strayMinValues || c.strays*100 > c.values*strayMaxPercent)
+}
+
+// addLocaleNumber учитывает число вида "1 234,56 ₽"; неоднозначные значения откладываются до подсчета голосов
+func (c *columnInference) addLocaleNumber(value, number, unit string, separator int) {
+	if unit != "" {
+		c.units[unit]++
+	}
+	switch separator {
+	case separatorComma:
+		c.commaVotes++
+	case separatorPoint:
+		c.pointVotes++
+	case separatorAmbiguous:
+		if c.ambiguousComma == nil {
+			c.ambiguousComma, c.ambiguousPoint = newColumnInference(), newColumnInference()
+		}
+		asComma, _ := parseLocaleNumber(value, true)
+		c.ambiguousComma.addKind(classifyValue(asComma))
+		c.ambiguousPoint.addKind(classifyValue(number))
+		return
+	}
+	c.addKind(classifyValue(number))
+}
+
+// resolveFormat подводит итоги голосований: формат дат, десятичный разделитель (с дописыванием
+// неоднозначных значений) и Unix время. Разные валюты в одной колонке делают ее текстовой
+func (c *columnInference) resolveFormat() columnFormat {
+	if c.tooManyStrays() {
+		c.addKind("String", 0, 0)
+	}
+	format := columnFormat{DecimalComma: c.commaVotes > c.pointVotes}
+	if ambiguous := c.ambiguousPoint; ambiguous != nil {
+		if format.DecimalComma {
+			ambiguous = c.ambiguousComma
+		}
+		c.mixed = c.mixed || ambiguous.mixed
+		c.addKind(ambiguous.kind, ambiguous.scale, ambiguous.intDigits)
+	}
+	if len(c.units) > 1 {
+		c.kind = "String"
+	}
+	if c.kind == "Date" || c.kind == "DateTime64" {
+		// Тип определяет победивший формат: несколько дат без времени среди дат со временем не обрезают время
+		layouts := rankDateLayouts(c.dateVotes)
+		if len(layouts) == 0 {
+			// Без голосов за формат значения не разобрать, колонка остается текстом
+			c.kind = "String"
+			return columnFormat{}
+		}
+		c.kind = "Date"
+		if isDateTimeLayout(layouts[0]) {
+			c.kind = "DateTime64"
+		}
+		return columnFormat{DateLayouts: layouts}
+	}
+	if !IsNumericType(c.kind) {
+		return columnFormat{}
+	}
+	for unit := range c.units {
+		format.Unit = unit
+	}
+	// Unix время: все значения целые из 2000–2100 годов в одних единицах и не одинаковые
+	if c.kind == "Int64" && len(c.epochs) == 1 && (c.uniq == nil || len(c.uniq) > 1) {
+		for epoch, count := range c.epochs {
+			if count == c.values-c.strays {
+				format.Epoch = epoch
+			}
+		}
+	}
+	return format
+}
+
+func (c *columnInference) addKind(kind string, scale, intDigits int) {
+	if kind == "" {
+		return
+	}
+	current, next := SearchStrings(typesWeight, c.kind), SearchStrings(typesWeight, kind)
+	switch {
+	case c.kind == kind:
+	case c.kind == "":
+		c.kind = kind
+	case (c.kind == "IPv4" && kind == "IPv6") || (c.kind == "IPv6" && kind == "IPv4"):
+		// IPv4 адреса хранятся в IPv6 колонке как ::ffff:a.b.c.d
+		c.kind = "IPv6"
+	case current >= 0 && next >= 0:
+		if next > current {
+			c.kind = kind
+		}
+	default:
+		c.kind = "String"
+	}
+
+	if kind == "Decimal" {
+		if c.scale != 0 && c.scale != scale {
+			c.mixed = true
+		}
+		c.scale = scale
+	}
+	if intDigits > c.intDigits {
+		c.intDigits = intDigits
+	}
+	if c.kind == "Decimal" && (c.mixed || c.intDigits+c.scale > decimalPrecision) {
+		c.kind = "Float64"
+	}
+}
+
+// columnType возвращает тип колонки ClickHouse. Текст с повторяющимися значениями хранится словарем:
+// Enum8, если все значения известны, иначе LowCardinality(String)
+func (c *columnInference) columnType(complete bool) string {
+	switch c.kind {
+	case "":
+		return ""
+	case "Decimal":
+		return fmt.Sprintf("Decimal(%d, %d)", decimalPrecision, c.scale)
+	case "String":
+		if c.uniq == nil || c.values < dictionaryMinRows || len(c.uniq)*4 > c.values {
+			return "String"
+		}
+		if complete && c.enumSafe && len(c.uniq) <= enumMaxValues {
+			return enumType(c.uniq)
+		}
+		return "LowCardinality(String)"
+	}
+	return c.kind
+}
+
+func enumType(values map[string]struct{}) string {
+	names := make([]string, 0, len(values))
+	for value := range values {
+		names = append(names, value)
+	}
+	sort.Strings(names)
+	items := make([]string, len(names))
+	for i, name := range names {
+		escaped := strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(name)
+		items[i] = fmt.Sprintf("'%s' = %d", escaped, i+1)
+	}
+	return "Enum8(" + strings.Join(items, ", ") + ")"
+}
+
+// columnDefinition собирает описание колонки для CREATE TABLE. LowCardinality не может быть внутри Nullable,
+// поэтому Nullable переносится внутрь словаря. comment — комментарий колонки из columnComment
+func columnDefinition(name, columnType, nullable, comment string) string {
+	definition := fmt.Sprintf("%s %s %s", name, columnType, nullable)
+	if strings.TrimSpace(nullable) != "" && strings.HasPrefix(columnType, "LowCardinality(") {
+		inner := strings.TrimSuffix(strings.TrimPrefix(columnType, "LowCardinality("), ")")
+		definition = fmt.Sprintf("%s LowCardinality(Nullable(%s)) ", name, inner)
+	}
+	if comment != "" {
+		definition += fmt.Sprintf("COMMENT '%s'", sqlStringEscaper.Replace(comment))
+	}
+	return definition
+}
+
+// normalizeValue приводит значение к виду, который ClickHouse разбирает для колонки этого типа без настроек
+func normalizeValue(columnType string, format columnFormat, v string) string {
+	if v == "" {
+		return v
+	}
+	switch {
+	case IsNumericType(columnType) && format.BoolAsNumber:
+		if b, ok := boolValues[strings.ToLower(strings.TrimSpace(v))]; ok {
+			if b {
+				return "1"
+			}
+			return "0"
+		}
+	case IsNumericType(columnType):
+		// Обычная запись с точкой разбирается и так; "1 234,56", "12,5%" и "₽1 200" переводятся в нее
+		if _, err := strconv.ParseFloat(v, 64); err == nil && !format.DecimalComma {
+			return strings.TrimPrefix(v, "+")
+		}
+		if number, ok := parseLocaleNumber(v, format.DecimalComma); ok {
+			return number
+		}
+	case columnType == "Date" || columnType == "DateTime64":
+		if t, ok := parseColumnDate(v, format.DateLayouts); ok {
+			if columnType == "Date" {
+				return t.Format("2006-01-02")
+			}
+			// Время с часовым поясом приводится к UTC, колонка хранит время без пояса
+			return t.UTC().Format("2006-01-02 15:04:05.999999")
+		}
+	case columnType == "Bool":
+		if b, ok := boolValues[strings.ToLower(strings.TrimSpace(v))]; ok {
+			return strconv.FormatBool(b)
+		}
+	case columnType == "IPv6":
+		if !strings.Contains(v, ":") {
+			return "::ffff:" + v
+		}
+	}
+	return v
+}
+
+func unwrapNullable(columnType string) string {
+	if strings.HasPrefix(columnType, "Nullable(") {
+		return strings.TrimSuffix(strings.TrimPrefix(columnType, "Nullable("), ")")
+	}
+	return columnType
+}
+
+func IsBoolType(_type string) bool {
+	return unwrapNullable(_type) == "Bool"
+}
+
+func IsIPType(_type string) bool {
+	t := unwrapNullable(_type)
+	return t == "IPv4" || t == "IPv6"
+}
+
+func IsDecimalType(_type string) bool {
+	return strings.HasPrefix(unwrapNullable(_type), "Decimal")
+}
+
+// IsCategoryType — текстовые колонки, по которым строятся частоты значений
+func IsCategoryType(_type string) bool {
+	t := unwrapNullable(_type)
+	return t == "String" || strings.HasPrefix(t, "LowCardinality(") || strings.HasPrefix(t, "Enum8(") || strings.HasPrefix(t, "Enum16(")
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/pivolan/stats_analyzer/domain/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// repeatRows повторяет значения по кругу, чтобы получилась колонка нужной длины
+func repeatRows(count int, values ...string) [][]string {
+	rows := make([][]string, count)
+	for i := range rows {
+		rows[i] = []string{values[i%len(values)]}
+	}
+	return rows
+}
+
+func TestInferColumnTypes(t *testing.T) {
+	cities := make([]string, 20)
+	for i := range cities {
+		cities[i] = fmt.Sprintf("city %d", i)
+	}
+	names := make([]string, 200)
+	for i := range names {
+		names[i] = fmt.Sprintf("customer %d", i)
+	}
+
+	testCases := []struct {
+		name     string
+		rows     [][]string
+		expected string
+		nullable string
+	}{
+		{"bool", repeatRows(3, "true", "FALSE", "Yes"), "Bool", ""},
+		{"zero and one stay integers", repeatRows(3, "0", "1"), "Int64", ""},
+		{"bool mixed with text", repeatRows(3, "yes", "maybe"), "String", ""},
+		{"uuid", repeatRows(2, "6ba7b810-9dad-11d1-80b4-00c04fd430c8", "6BA7B811-9DAD-11D1-80B4-00C04FD430C8"), "UUID", ""},
+		{"ipv4", repeatRows(2, "192.168.0.1", "10.0.0.254"), "IPv4", ""},
+		{"ipv4 and ipv6", repeatRows(2, "192.168.0.1", "2001:db8::1"), "IPv6", ""},
+		{"money", repeatRows(3, "10.50", "1200", "-3.99"), "Decimal(18, 2)", ""},
+		{"different scales", repeatRows(2, "10.50", "1.125"), "Float64", ""},
+		{"one decimal place", repeatRows(2, "1.5", "2"), "Float64", ""},
+		{"too many digits for decimal", repeatRows(2, "12345678901234567.50", "1.00"), "Float64", ""},
+		{"dates", repeatRows(2, "2024-01-01", "02.01.2024"), "Date", ""},
+		{"nullable int", repeatRows(3, "1", "", "\\N"), "Int64", " NULL "},
+		{"few rows of text", repeatRows(10, "a", "b"), "String", ""},
+		{"enum", repeatRows(200, "new", "paid", "shipped"), "Enum8('new' = 1, 'paid' = 2, 'shipped' = 3)", ""},
+		{"enum escapes quotes", repeatRows(200, "it's", "ok"), `Enum8('it\'s' = 1, 'ok' = 2)`, ""},
+		{"low cardinality", repeatRows(200, cities...), "LowCardinality(String)", ""},
+		{"unique text", repeatRows(200, names...), "String", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			types, nullables, _ := inferColumnTypes(&sliceRowReader{rows: tc.rows}, 1)
+			assert.Equal(t, tc.expected, types[0])
+			assert.Equal(t, tc.nullable, nullables[0])
+		})
+	}
+}
+
+func TestInferColumnTypesEnumNeedsWholeFile(t *testing.T) {
+	rows := repeatRows(inferSampleRows+1, "new", "paid")
+	types, _, _ := inferColumnTypes(&sliceRowReader{rows: rows}, 1)
+	assert.Equal(t, "LowCardinality(String)", types[0])
+
+	// Строка с лишним полем пропущена при разборе, значит, видны не все значения колонки
+	rows = append(repeatRows(200, "new", "paid"), []string{"refunded", "extra"})
+	types, _, _ = inferColumnTypes(&sliceRowReader{rows: rows}, 1)
+	assert.Equal(t, "LowCardinality(String)", types[0])
+}
+
+func TestColumnDefinition(t *testing.T) {
+	assert.Equal(t, "0001_city LowCardinality(Nullable(String)) ", columnDefinition("0001_city", "LowCardinality(String)", " NULL ", ""))
+	assert.Equal(t, "0001_city LowCardinality(String) ", columnDefinition("0001_city", "LowCardinality(String)", "", ""))
+	assert.Equal(t, "0002_paid Bool  NULL ", columnDefinition("0002_paid", "Bool", " NULL ", ""))
+}
+
+func TestNormalizeValue(t *testing.T) {
+	testCases := []struct {
+		columnType string
+		value      string
+		expected   string
+	}{
+		{"Bool", "Yes", "true"},
+		{"Bool", "нет", "false"},
+		{"IPv6", "10.0.0.1", "::ffff:10.0.0.1"},
+		{"IPv6", "2001:db8::1", "2001:db8::1"},
+		{"Decimal(18, 2)", "+10.50", "10.50"},
+		{"Date", "02.01.2024", "2024-01-02"},
+		{"String", "+10.50", "+10.50"},
+		{"Bool", "", ""},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.expected, normalizeValue(tc.columnType, columnFormat{}, tc.value), tc.columnType+" "+tc.value)
+	}
+}
+
+func TestAnalyzersUnderstandNewTypes(t *testing.T) {
+	columns := []models.ColumnInfo{
+		{Name: "0001_amount", Type: "Decimal(18, 2)"},
+		{Name: "0002_paid", Type: "Nullable(Bool)"},
+		{Name: "0003_ip", Type: "IPv4"},
+		{Name: "0004_status", Type: "Enum8('new' = 1, 'paid' = 2)"},
+	}
+	table := models.ClickhouseTableName("orders")
+
+	assert.True(t, IsNumericType("Decimal(18, 2)"))
+	assert.True(t, IsNumericType("Nullable(Decimal(18, 2))"))
+	assert.False(t, IsNumericType("Bool"))
+
+	sql := generateSqlForNumericColumnsStats(columns, table)
+	assert.Contains(t, sql, "toString(sum(0001_amount)) as sum__0001_amount")
+	assert.Contains(t, sql, "avg(toUInt8(0002_paid)) as rate__0002_paid")
+	assert.NotContains(t, sql, "median(0002_paid)")
+
+	stats := parseNumericResults(map[string]interface{}{
+		"sum__0001_amount": "1234567.89",
+		"avg__0001_amount": 12.5,
+		"rate__0002_paid":  0.25,
+	})
+	assert.Equal(t, "1234567.89", stats["0001_amount"].Sum)
+	assert.True(t, stats["0001_amount"].IsNumeric)
+	assert.Equal(t, 0.25, stats["0002_paid"].Rate)
+	assert.True(t, stats["0002_paid"].IsBool)
+	assert.False(t, stats["0002_paid"].IsNumeric)
+
+	uniq := map[string]CommonStat{"0003_ip": {Uniq: 5000}, "0004_status": {Uniq: 2}}
+	sqls := generateSqlForGroups(columns, uniq, table)
+	keys := []string{}
+	for _, line := range sqls {
+		keys = append(keys, strings.Split(line, "//")[0])
+	}
+	assert.Equal(t, []string{"0003_ip_subnets", "0004_status", "0004_status_rare"}, keys)
+	assert.Contains(t, sqls[0], "IPv4NumToStringClassC(toUInt32(0003_ip))")
+}
@@ -1,29 +1,163 @@
 package main
 
 import (
+	"archive/tar"
 	"archive/zip"
+	"bytes"
+	"compress/bzip2"
 	"compress/gzip"
 	"fmt"
-	"github.com/pierrec/lz4"
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4"
+	"github.com/ulikunitz/xz"
+)
+
+const (
+	ARCHIVE_NONE  = ""
+	ARCHIVE_ZIP   = "zip"
+	ARCHIVE_TAR   = "tar"
+	ARCHIVE_GZIP  = "gzip"
+	ARCHIVE_BZIP2 = "bzip2"
+	ARCHIVE_XZ    = "xz"
+	ARCHIVE_ZSTD  = "zstd"
+	ARCHIVE_LZ4   = "lz4"
 )
 
+// Вложенные архивы (zip с gz внутри, tar.gz и т.п.) распаковываются не глубже этого уровня
+const maxArchiveDepth = 5
+
+// Сколько байт всего можно распаковать из одного загруженного архива: защита от zip-бомб
+var maxUnpackedBytes int64 = 4 << 30
+
+// unpackBudget считает распакованные байты по всем файлам и уровням вложенности архива
+type unpackBudget struct {
+	remaining int64
+}
+
+func newUnpackBudget() *unpackBudget {
+	return &unpackBudget{remaining: maxUnpackedBytes}
+}
+
+var archiveMagics = []struct {
+	kind  string
+	magic []byte
+}{
+	{ARCHIVE_GZIP, []byte{0x1F, 0x8B}},
+	{ARCHIVE_BZIP2, []byte("BZh")},
+	{ARCHIVE_XZ, []byte{0xFD, '7', 'z', 'X', 'Z', 0x00}},
+	{ARCHIVE_ZSTD, []byte{0x28, 0xB5, 0x2F, 0xFD}},
+	{ARCHIVE_LZ4, []byte{0x04, 0x22, 0x4D, 0x18}},
+	{ARCHIVE_ZIP, []byte("PK\x03\x04")},
+}
+
+// Расширения, которые срезаются с имени файла после распаковки сжатого потока
+var compressedExtensions = map[string]string{
+	".gz": "", ".tgz": ".tar", ".bz2": "", ".tbz2": ".tar", ".xz": "", ".txz": ".tar",
+	".zst": "", ".zstd": "", ".lz4": "",
+}
+
+// detectArchiveKind определяет тип архива по сигнатуре, а не по расширению:
+// Telegram часто переименовывает файлы. Книги Excel тоже zip, но архивом не считаются
+func detectArchiveKind(filePath string) string {
+	header := readMagic(filePath, 512)
+	for _, m := range archiveMagics {
+		if bytes.HasPrefix(header, m.magic) {
+			if m.kind == ARCHIVE_ZIP && isXLSXFile(filePath) {
+				return ARCHIVE_NONE
+			}
+			return m.kind
+		}
+	}
+	if len(header) >= 262 && bytes.Equal(header[257:262], []byte("ustar")) {
+		return ARCHIVE_TAR
+	}
+	if strings.ToLower(filepath.Ext(filePath)) == ".tar" {
+		return ARCHIVE_TAR
+	}
+	return ARCHIVE_NONE
+}
+
+func isArchiveFile(filePath string) bool {
+	return detectArchiveKind(filePath) != ARCHIVE_NONE
+}
+
+// unpackArchive распаковывает архив, из zip и tar берет только самый большой файл.
+// Возвращает пустую строку, если файл не архив
 func unpackArchive(filePath string) (string, error) {
-	ext := filepath.Ext(filePath)
-	if ext == ".zip" {
-		return unpackZipArchive(filePath)
-	} else if ext == ".gz" {
-		return unpackGzipArchive(filePath)
-	} else if ext == ".lz4" {
-		return unpackLZ4Archive(filePath)
+	budget := newUnpackBudget()
+	result := ""
+	for depth := 0; depth < maxArchiveDepth; depth++ {
+		var unpacked string
+		var err error
+		switch detectArchiveKind(filePath) {
+		case ARCHIVE_NONE:
+			return result, nil
+		case ARCHIVE_ZIP:
+			unpacked, err = unpackZipArchive(filePath, budget)
+		case ARCHIVE_TAR:
+			unpacked, err = unpackTarArchive(filePath, budget)
+		default:
+			unpacked, err = unpackCompressedStream(filePath, budget)
+		}
+		if err != nil {
+			return result, err
+		}
+		filePath, result = unpacked, unpacked
+	}
+	if isArchiveFile(result) {
+		return "", fmt.Errorf("archive nesting is deeper than %d levels", maxArchiveDepth)
 	}
-	return "", nil
+	return result, nil
+}
+
+// unpackArchiveAll рекурсивно распаковывает все файлы архива, включая вложенные архивы.
+// Для файла, который не является архивом, возвращает его самого
+func unpackArchiveAll(filePath string) ([]string, error) {
+	return unpackArchiveAllDepth(filePath, 0, newUnpackBudget())
 }
 
-func unpackZipArchive(filePath string) (string, error) {
+func unpackArchiveAllDepth(filePath string, depth int, budget *unpackBudget) ([]string, error) {
+	kind := detectArchiveKind(filePath)
+	if kind == ARCHIVE_NONE {
+		return []string{filePath}, nil
+	}
+	if depth >= maxArchiveDepth {
+		return nil, fmt.Errorf("archive nesting is deeper than %d levels: %s", maxArchiveDepth, filepath.Base(filePath))
+	}
+	var members []string
+	var err error
+	switch kind {
+	case ARCHIVE_ZIP:
+		members, err = unpackZipArchiveAll(filePath, budget)
+	case ARCHIVE_TAR:
+		members, err = unpackTarArchiveAll(filePath, budget)
+	default:
+		var unpacked string
+		unpacked, err = unpackCompressedStream(filePath, budget)
+		members = []string{unpacked}
+	}
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, member := range members {
+		nested, err := unpackArchiveAllDepth(member, depth+1, budget)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, nested...)
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+func unpackZipArchive(filePath string, budget *unpackBudget) (string, error) {
 	// Open zip archive
 	r, err := zip.OpenReader(filePath)
 	if err != nil {
@@ -35,7 +169,7 @@ func unpackZipArchive(filePath string) (string, error) {
 	var largestFile *zip.File
 	var largestSize uint64
 	for _, f := range r.File {
-		if f.FileInfo().IsDir() {
+		if f.FileInfo().IsDir() || isJunkArchiveMember(f.Name) {
 			continue
 		}
 		if f.UncompressedSize64 > largestSize {
@@ -44,27 +178,16 @@ func unpackZipArchive(filePath string) (string, error) {
 		}
 	}
 	if largestFile == nil {
-		return "", nil
+		return "", fmt.Errorf("no files in zip archive")
 	}
 
 	// Extract largest file to same directory
-	destPath := filepath.Join(filepath.Dir(filePath), largestFile.Name)
-	os.MkdirAll(filepath.Dir(destPath), 0755)
-	outFile, err := os.Create(destPath)
-	if err != nil {
-		fmt.Println("create1", destPath)
-		return "", err
-	}
-	defer outFile.Close()
-	rc, err := largestFile.Open()
-	if err != nil {
-		fmt.Println("open1")
-		return "", err
+	name, ok := safeArchiveMemberName(largestFile.Name)
+	if !ok {
+		return "", fmt.Errorf("unsafe file name in archive: %s", largestFile.Name)
 	}
-	defer rc.Close()
-	_, err = io.Copy(outFile, rc)
-	if err != nil {
-		fmt.Println("copy1")
+	destPath := filepath.Join(filepath.Dir(filePath), name)
+	if err := extractZipFile(largestFile, destPath, budget); err != nil {
 		return "", err
 	}
 
@@ -77,61 +200,177 @@ func unpackZipArchive(filePath string) (string, error) {
 	return destPath, nil
 }
 
-func unpackGzipArchive(filePath string) (string, error) {
-	// Open gzip archive
-	file, err := os.Open(filePath)
+// unpackZipArchiveAll распаковывает все файлы архива в отдельную папку рядом с архивом
+// и возвращает их пути; служебные файлы (__MACOSX, скрытые) пропускаются
+func unpackZipArchiveAll(filePath string, budget *unpackBudget) ([]string, error) {
+	r, err := zip.OpenReader(filePath)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	defer file.Close()
-	gr, err := gzip.NewReader(file)
+	defer r.Close()
+
+	destDir := archiveMembersDir(filePath)
+	var paths []string
+	for _, f := range r.File {
+		if f.FileInfo().IsDir() || isJunkArchiveMember(f.Name) {
+			continue
+		}
+		name, ok := safeArchiveMemberName(f.Name)
+		if !ok {
+			continue
+		}
+		destPath := filepath.Join(destDir, name)
+		if err := extractZipFile(f, destPath, budget); err != nil {
+			return nil, err
+		}
+		paths = append(paths, destPath)
+	}
+
+	// Remove original archive
+	if err := os.Remove(filePath); err != nil {
+		return nil, err
+	}
+	return paths, nil
+}
+
+func extractZipFile(f *zip.File, destPath string, budget *unpackBudget) error {
+	rc, err := f.Open()
 	if err != nil {
-		return "", err
+		return err
 	}
-	defer gr.Close()
+	defer rc.Close()
+	return budget.writeFile(destPath, rc)
+}
 
-	// Create output file
-	destPath := strings.TrimSuffix(filePath, ".gz")
-	outFile, err := os.Create(destPath)
+// unpackTarArchive извлекает самый большой файл tar архива
+func unpackTarArchive(filePath string, budget *unpackBudget) (string, error) {
+	var largestName string
+	var largestSize int64 = -1
+	err := walkTar(filePath, func(header *tar.Header, _ io.Reader) error {
+		if header.Size > largestSize {
+			largestName, largestSize = header.Name, header.Size
+		}
+		return nil
+	})
 	if err != nil {
 		return "", err
 	}
-	defer outFile.Close()
+	if largestName == "" {
+		return "", fmt.Errorf("no files in tar archive")
+	}
 
-	// Uncompress gzip to output file
-	_, err = io.Copy(outFile, gr)
+	var destPath string
+	err = walkTar(filePath, func(header *tar.Header, r io.Reader) error {
+		if header.Name != largestName || destPath != "" {
+			return nil
+		}
+		name, _ := safeArchiveMemberName(header.Name)
+		destPath = filepath.Join(filepath.Dir(filePath), name)
+		return budget.writeFile(destPath, r)
+	})
 	if err != nil {
 		return "", err
 	}
 
 	// Remove original archive
-	err = os.Remove(filePath)
-	if err != nil {
+	if err := os.Remove(filePath); err != nil {
 		return "", err
 	}
-
 	return destPath, nil
 }
 
-func unpackLZ4Archive(filePath string) (string, error) {
-	// Open LZ4 archive
+// unpackTarArchiveAll извлекает все файлы tar архива в отдельную папку
+func unpackTarArchiveAll(filePath string, budget *unpackBudget) ([]string, error) {
+	destDir := archiveMembersDir(filePath)
+	var paths []string
+	err := walkTar(filePath, func(header *tar.Header, r io.Reader) error {
+		name, _ := safeArchiveMemberName(header.Name)
+		destPath := filepath.Join(destDir, name)
+		if err := budget.writeFile(destPath, r); err != nil {
+			return err
+		}
+		paths = append(paths, destPath)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Remove original archive
+	if err := os.Remove(filePath); err != nil {
+		return nil, err
+	}
+	return paths, nil
+}
+
+// walkTar вызывает fn для каждого обычного файла архива с безопасным именем
+func walkTar(filePath string, fn func(header *tar.Header, r io.Reader) error) error {
 	file, err := os.Open(filePath)
 	if err != nil {
-		return "", err
+		return err
 	}
 	defer file.Close()
+	tr := tar.NewReader(file)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg || isJunkArchiveMember(header.Name) {
+			continue
+		}
+		if _, ok := safeArchiveMemberName(header.Name); !ok {
+			continue
+		}
+		if err := fn(header, tr); err != nil {
+			return err
+		}
+	}
+}
 
-	// Create output file
-	destPath := strings.TrimSuffix(filePath, ".lz4")
-	outFile, err := os.Create(destPath)
+// unpackCompressedStream распаковывает однофайловое сжатие: gzip, bzip2, xz, zstd, lz4
+func unpackCompressedStream(filePath string, budget *unpackBudget) (string, error) {
+	file, err := os.Open(filePath)
 	if err != nil {
 		return "", err
 	}
-	defer outFile.Close()
+	defer file.Close()
 
-	// Uncompress LZ4 to output file
-	_, err = io.Copy(outFile, lz4.NewReader(file))
-	if err != nil {
+	var r io.Reader
+	switch detectArchiveKind(filePath) {
+	case ARCHIVE_GZIP:
+		gr, err := gzip.NewReader(file)
+		if err != nil {
+			return "", err
+		}
+		defer gr.Close()
+		r = gr
+	case ARCHIVE_BZIP2:
+		r = bzip2.NewReader(file)
+	case ARCHIVE_XZ:
+		r, err = xz.NewReader(file)
+		if err != nil {
+			return "", err
+		}
+	case ARCHIVE_ZSTD:
+		zr, err := zstd.NewReader(file)
+		if err != nil {
+			return "", err
+		}
+		defer zr.Close()
+		r = zr
+	case ARCHIVE_LZ4:
+		r = lz4.NewReader(file)
+	default:
+		return "", fmt.Errorf("unknown compression: %s", filePath)
+	}
+
+	// Create output file
+	destPath := decompressedFileName(filePath)
+	if err := budget.writeFile(destPath, r); err != nil {
 		return "", err
 	}
 
@@ -143,3 +382,51 @@ func unpackLZ4Archive(filePath string) (string, error) {
 
 	return destPath, nil
 }
+
+// decompressedFileName срезает расширение сжатия: data.csv.gz -> data.csv, logs.tgz -> logs.tar
+func decompressedFileName(filePath string) string {
+	ext := filepath.Ext(filePath)
+	if replacement, ok := compressedExtensions[strings.ToLower(ext)]; ok {
+		return strings.TrimSuffix(filePath, ext) + replacement
+	}
+	// Расширение потеряно при пересылке, формат результата определится по содержимому
+	return filePath + ".unpacked"
+}
+
+func archiveMembersDir(filePath string) string {
+	return strings.TrimSuffix(filePath, filepath.Ext(filePath)) + "_files"
+}
+
+// safeArchiveMemberName защищает от выхода за пределы папки через ../ и абсолютные пути в именах файлов
+func safeArchiveMemberName(name string) (string, bool) {
+	cleaned := filepath.Clean(filepath.FromSlash(name))
+	if filepath.IsAbs(cleaned) || cleaned == ".." || strings.HasPrefix(cleaned, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return cleaned, true
+}
+
+// writeFile пишет распакованные данные и списывает их из бюджета;
+// при превышении бюджета распаковка прерывается, не дожидаясь конца потока
+func (b *unpackBudget) writeFile(destPath string, r io.Reader) error {
+	os.MkdirAll(filepath.Dir(destPath), 0755)
+	outFile, err := os.Create(destPath)
+	if err != nil {
+		return err
+	}
+	defer outFile.Close()
+	written, err := io.Copy(outFile, io.LimitReader(r, b.remaining+1))
+	b.remaining -= written
+	if err != nil {
+		return err
+	}
+	if b.remaining < 0 {
+		return fmt.Errorf("archive unpacks to more than %d bytes", maxUnpackedBytes)
+	}
+	return nil
+}
+
+func isJunkArchiveMember(name string) bool {
+	base := filepath.Base(name)
+	return strings.HasPrefix(name, "__MACOSX/") || strings.HasPrefix(base, ".") || base == "Thumbs.db" || base == "desktop.ini"
+}
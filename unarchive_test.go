@@ -0,0 +1,180 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/ulikunitz/xz"
+	"github.com/xuri/excelize/v2"
+)
+
+func gzipBytes(t *testing.T, data []byte) []byte {
+	var buffer bytes.Buffer
+	w := gzip.NewWriter(&buffer)
+	w.Write(data)
+	assert.NoError(t, w.Close())
+	return buffer.Bytes()
+}
+
+func tarBytes(t *testing.T, files map[string]string) []byte {
+	var buffer bytes.Buffer
+	w := tar.NewWriter(&buffer)
+	for name, content := range files {
+		assert.NoError(t, w.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}))
+		w.Write([]byte(content))
+	}
+	assert.NoError(t, w.Close())
+	return buffer.Bytes()
+}
+
+func zipBytes(t *testing.T, files map[string][]byte) []byte {
+	var buffer bytes.Buffer
+	w := zip.NewWriter(&buffer)
+	for name, content := range files {
+		f, err := w.Create(name)
+		assert.NoError(t, err)
+		f.Write(content)
+	}
+	assert.NoError(t, w.Close())
+	return buffer.Bytes()
+}
+
+func compressWith(t *testing.T, data []byte, newWriter func(io.Writer) (io.WriteCloser, error)) []byte {
+	var buffer bytes.Buffer
+	w, err := newWriter(&buffer)
+	assert.NoError(t, err)
+	w.Write(data)
+	assert.NoError(t, w.Close())
+	return buffer.Bytes()
+}
+
+func TestUnpackArchive(t *testing.T) {
+	csvData := "a,b\n1,2\n"
+	testCases := []struct {
+		name string
+		file string
+		data []byte
+		kind string
+	}{
+		{"tar.gz renamed by telegram", "file_42.bin", gzipBytes(t, tarBytes(t, map[string]string{"small.csv": "x\n", "logs/big.csv": csvData})), ARCHIVE_GZIP},
+		{"tgz", "logs.tgz", gzipBytes(t, tarBytes(t, map[string]string{"big.csv": csvData})), ARCHIVE_GZIP},
+		{"plain tar", "logs.tar", tarBytes(t, map[string]string{"big.csv": csvData}), ARCHIVE_TAR},
+		{"xz", "data.csv.xz", compressWith(t, []byte(csvData), func(w io.Writer) (io.WriteCloser, error) { return xz.NewWriter(w) }), ARCHIVE_XZ},
+		{"zstd", "data.csv.zst", compressWith(t, []byte(csvData), func(w io.Writer) (io.WriteCloser, error) { return zstd.NewWriter(w) }), ARCHIVE_ZSTD},
+		{"zip of gz", "data.zip", zipBytes(t, map[string][]byte{"data.csv.gz": gzipBytes(t, []byte(csvData))}), ARCHIVE_ZIP},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			filePath := filepath.Join(t.TempDir(), tc.file)
+			assert.NoError(t, os.WriteFile(filePath, tc.data, 0644))
+			assert.Equal(t, tc.kind, detectArchiveKind(filePath))
+
+			unpacked, err := unpackArchive(filePath)
+			assert.NoError(t, err)
+			content, err := os.ReadFile(unpacked)
+			assert.NoError(t, err)
+			assert.Equal(t, csvData, string(content))
+			assert.Equal(t, ARCHIVE_NONE, detectArchiveKind(unpacked))
+		})
+	}
+}
+
+func TestUnpackArchiveAllNested(t *testing.T) {
+	dir := t.TempDir()
+	archive := zipBytes(t, map[string][]byte{
+		"day1.csv":        []byte("a\n1\n"),
+		"day2.csv.gz":     gzipBytes(t, []byte("a\n2\n")),
+		"more/logs.tgz":   gzipBytes(t, tarBytes(t, map[string]string{"day3.csv": "a\n3\n", "../escape.csv": "a\n4\n"})),
+		"__MACOSX/._junk": []byte("junk"),
+	})
+	filePath := filepath.Join(dir, "month.zip")
+	assert.NoError(t, os.WriteFile(filePath, archive, 0644))
+
+	paths, err := unpackArchiveAll(filePath)
+	assert.NoError(t, err)
+	var names []string
+	for _, path := range paths {
+		names = append(names, filepath.Base(path))
+		assert.True(t, filepath.HasPrefix(path, dir))
+	}
+	assert.ElementsMatch(t, []string{"day1.csv", "day2.csv", "day3.csv"}, names)
+}
+
+func TestDetectArchiveKindSkipsWorkbooks(t *testing.T) {
+	book := excelize.NewFile()
+	dir := t.TempDir()
+	assert.NoError(t, book.SaveAs(filepath.Join(dir, "book.xlsx")))
+	// Telegram мог переименовать книгу, по сигнатуре это обычный zip
+	filePath := filepath.Join(dir, "book.zip")
+	assert.NoError(t, os.Rename(filepath.Join(dir, "book.xlsx"), filePath))
+	assert.Equal(t, ARCHIVE_NONE, detectArchiveKind(filePath))
+
+	unpacked, err := unpackArchive(filePath)
+	assert.NoError(t, err)
+	assert.Empty(t, unpacked)
+}
+
+func TestUnpackArchiveRejectsBrokenArchives(t *testing.T) {
+	csvData := []byte("a,b\n1,2\n")
+	nested := csvData
+	for i := 0; i <= maxArchiveDepth; i++ {
+		nested = gzipBytes(t, nested)
+	}
+	testCases := []struct {
+		name      string
+		file      string
+		data      []byte
+		allFailed bool
+	}{
+		{"empty tar", "empty.tar", tarBytes(t, map[string]string{}), false},
+		{"empty zip", "empty.zip", zipBytes(t, map[string][]byte{"__MACOSX/._junk": []byte("junk")}), false},
+		{"too deep", "deep.gz", nested, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			filePath := filepath.Join(t.TempDir(), tc.file)
+			assert.NoError(t, os.WriteFile(filePath, tc.data, 0644))
+			_, err := unpackArchive(filePath)
+			assert.Error(t, err)
+
+			assert.NoError(t, os.WriteFile(filePath, tc.data, 0644))
+			// Пустой архив среди прочих файлов не ошибка, его просто нечего импортировать
+			_, err = unpackArchiveAll(filePath)
+			assert.Equal(t, tc.allFailed, err != nil)
+		})
+	}
+}
+
+func TestUnpackArchiveBudget(t *testing.T) {
+	saved := maxUnpackedBytes
+	maxUnpackedBytes = 1000
+	defer func() { maxUnpackedBytes = saved }()
+
+	dir := t.TempDir()
+	bomb := zipBytes(t, map[string][]byte{
+		"part1.csv": bytes.Repeat([]byte("0"), 600),
+		"part2.csv": bytes.Repeat([]byte("0"), 600),
+	})
+	filePath := filepath.Join(dir, "bomb.zip")
+	assert.NoError(t, os.WriteFile(filePath, bomb, 0644))
+	_, err := unpackArchiveAll(filePath)
+	assert.Error(t, err)
+
+	filePath = filepath.Join(dir, "bomb.csv.gz")
+	assert.NoError(t, os.WriteFile(filePath, gzipBytes(t, bytes.Repeat([]byte("0"), 5000)), 0644))
+	_, err = unpackArchive(filePath)
+	assert.Error(t, err)
+
+	filePath = filepath.Join(dir, "small.csv.gz")
+	assert.NoError(t, os.WriteFile(filePath, gzipBytes(t, []byte("a,b\n1,2\n")), 0644))
+	_, err = unpackArchive(filePath)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,173 @@
+// url_import.go
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// downloadLimits — ограничения на скачивание файла по ссылке из чата
+type downloadLimits struct {
+	MaxBytes     int64
+	Timeout      time.Duration
+	MaxRedirects int
+	// Адреса локальной сети и localhost закрыты, иначе ссылкой можно достучаться до ClickHouse и других
+	// внутренних сервисов бота. В тестах разрешаются для локального HTTP сервера
+	AllowPrivate bool
+}
+
+var urlDownloadLimits = downloadLimits{
+	MaxBytes:     2 * 1024 * 1024 * 1024,
+	Timeout:      30 * time.Minute,
+	MaxRedirects: 5,
+}
+
+var urlPattern = regexp.MustCompile(`^https?://\S+$`)
+
+// Расширения для файлов, у которых в ссылке нет имени с расширением
+var contentTypeExtensions = map[string]string{
+	"text/csv":                  ".csv",
+	"text/plain":                ".csv",
+	"text/tab-separated-values": ".tsv",
+	"application/json":          ".json",
+	"application/x-ndjson":      ".jsonl",
+	"application/zip":           ".zip",
+	"application/gzip":          ".gz",
+	"application/x-gzip":        ".gz",
+	"application/x-tar":         ".tar",
+	"application/x-bzip2":       ".bz2",
+	"application/x-xz":          ".xz",
+	"application/zstd":          ".zst",
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet": ".xlsx",
+}
+
+// findURL возвращает ссылку, если сообщение состоит из одной http(s) ссылки
+func findURL(text string) string {
+	text = strings.TrimSpace(text)
+	if !urlPattern.MatchString(text) {
+		return ""
+	}
+	if u, err := url.Parse(text); err != nil || u.Host == "" {
+		return ""
+	}
+	return text
+}
+
+// downloadURL скачивает файл в dir и возвращает путь к нему. Размер, время и число редиректов ограничены limits
+func downloadURL(rawURL, dir string, limits downloadLimits, progress *importProgress) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return "", fmt.Errorf("unsupported url: %s", rawURL)
+	}
+
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+	if !limits.AllowPrivate {
+		dialer.Control = rejectPrivateAddress
+	}
+	transport := &http.Transport{
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   30 * time.Second,
+		ResponseHeaderTimeout: time.Minute,
+	}
+	client := &http.Client{
+		Timeout:   limits.Timeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > limits.MaxRedirects {
+				return fmt.Errorf("too many redirects")
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return fmt.Errorf("redirect to unsupported url: %s", req.URL)
+			}
+			return nil
+		},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), limits.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("server returned %s", resp.Status)
+	}
+	if resp.ContentLength > limits.MaxBytes {
+		return "", fmt.Errorf("file is larger than %d MB", limits.MaxBytes/1024/1024)
+	}
+
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return "", err
+	}
+	name := downloadFileName(resp)
+	filePath := filepath.Join(dir, name)
+	file, err := os.Create(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	progress.SetStage("скачивание " + name)
+	body := &countingReader{reader: resp.Body}
+	progress.Track(resp.ContentLength, body.BytesRead)
+	written, err := io.Copy(file, io.LimitReader(body, limits.MaxBytes+1))
+	if err == nil && written > limits.MaxBytes {
+		err = fmt.Errorf("file is larger than %d MB", limits.MaxBytes/1024/1024)
+	}
+	if err != nil {
+		file.Close()
+		os.Remove(filePath)
+		return "", err
+	}
+	return filePath, nil
+}
+
+// downloadFileName берет имя из Content-Disposition или из пути ссылки после редиректов;
+// без расширения оно подбирается по Content-Type, чтобы handleFile узнал формат
+func downloadFileName(resp *http.Response) string {
+	name := ""
+	if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil {
+		name = params["filename"]
+	}
+	if name == "" {
+		name = path.Base(resp.Request.URL.Path)
+	}
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	if name == "." || name == "/" || name == "" {
+		name = "download"
+	}
+	if filepath.Ext(name) == "" {
+		mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+		name += contentTypeExtensions[mediaType]
+	}
+	return name
+}
+
+// rejectPrivateAddress не дает подключиться к localhost и адресам локальной сети, в том числе после DNS и редиректов
+func rejectPrivateAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified() {
+		return fmt.Errorf("address %s is not allowed", host)
+	}
+	return nil
+}
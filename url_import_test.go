@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/gorm"
+)
+
+var testDownloadLimits = downloadLimits{MaxBytes: 1024, Timeout: 5 * time.Second, MaxRedirects: 2, AllowPrivate: true}
+
+func TestFindURL(t *testing.T) {
+	testCases := []struct {
+		text     string
+		expected string
+	}{
+		{"https://example.com/data.csv", "https://example.com/data.csv"},
+		{"  http://example.com/export?format=csv \n", "http://example.com/export?format=csv"},
+		{"ftp://example.com/data.csv", ""},
+		{"посмотри https://example.com/data.csv", ""},
+		{"https://", ""},
+		{"1 2 3", ""},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.expected, findURL(tc.text), tc.text)
+	}
+}
+
+func TestDownloadURL(t *testing.T) {
+	content := "name,amount\nfirst,1\nsecond,2\n"
+	mux := http.NewServeMux()
+	mux.HandleFunc("/files/orders.csv", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, content)
+	})
+	mux.HandleFunc("/export", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Disposition", `attachment; filename="report.json"`)
+		fmt.Fprint(w, `[{"a":1}]`)
+	})
+	mux.HandleFunc("/data", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		fmt.Fprint(w, content)
+	})
+	mux.HandleFunc("/moved", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/files/orders.csv", http.StatusFound)
+	})
+	mux.HandleFunc("/loop", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop", http.StatusFound)
+	})
+	mux.HandleFunc("/big", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "4096")
+		fmt.Fprint(w, strings.Repeat("x", 4096))
+	})
+	mux.HandleFunc("/stream", func(w http.ResponseWriter, r *http.Request) {
+		// Без Content-Length размер известен только после чтения
+		for i := 0; i < 4; i++ {
+			fmt.Fprint(w, strings.Repeat("x", 512))
+			w.(http.Flusher).Flush()
+		}
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	testCases := []struct {
+		path     string
+		fileName string
+		err      string
+	}{
+		{"/files/orders.csv", "orders.csv", ""},
+		{"/export", "report.json", ""},
+		{"/data", "data.csv", ""},
+		{"/moved", "orders.csv", ""},
+		{"/loop", "", "too many redirects"},
+		{"/missing", "", "404"},
+		{"/big", "", "file is larger"},
+		{"/stream", "", "file is larger"},
+	}
+	for _, tc := range testCases {
+		dir := t.TempDir()
+		progress := newImportProgress()
+		filePath, err := downloadURL(server.URL+tc.path, dir, testDownloadLimits, progress)
+		if tc.err != "" {
+			assert.ErrorContains(t, err, tc.err, tc.path)
+			entries, _ := os.ReadDir(dir)
+			assert.Empty(t, entries, tc.path)
+			continue
+		}
+		assert.NoError(t, err, tc.path)
+		assert.Equal(t, filepath.Join(dir, tc.fileName), filePath)
+		assert.Contains(t, progress.Snapshot().Stage, tc.fileName)
+	}
+}
+
+func TestDownloadURLRejectsPrivateAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "a,b\n1,2\n")
+	}))
+	defer server.Close()
+
+	limits := testDownloadLimits
+	limits.AllowPrivate = false
+	_, err := downloadURL(server.URL+"/data.csv", t.TempDir(), limits, newImportProgress())
+	assert.ErrorContains(t, err, "is not allowed")
+}
+
+func TestImportFromDownloadedURL(t *testing.T) {
+	original := getMD5String
+	getMD5String = func(input string) string {
+		return "123456"
+	}
+	defer func() {
+		getMD5String = original
+	}()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/csv")
+		fmt.Fprint(w, "name,amount\nfirst,1\nsecond,2\n")
+	}))
+	defer server.Close()
+
+	progress := newImportProgress()
+	filePath, err := downloadURL(server.URL+"/export", t.TempDir(), testDownloadLimits, progress)
+	assert.NoError(t, err)
+
+	mockDB := NewMockDB()
+	mockDB.On("Exec", mock.Anything, mock.Anything).Return(&gorm.DB{})
+	tables, err := importFileIntoClickHouse(filePath, mockDB, importOptions{Progress: progress})
+	assert.NoError(t, err)
+	assert.Equal(t, "0001_name_0002_amount_123456", string(tables[0].Name))
+	assert.Contains(t, mockDB.lastQuery, "1,first,1\n2,second,2\n")
+}
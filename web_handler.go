@@ -6,7 +6,6 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
-	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
 )
@@ -47,24 +46,32 @@ func handleUpload(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Error saving file", http.StatusInternalServerError)
 		return
 	}
+	// Это сообщение дальше редактируется: прогресс импорта, затем этап анализа
+	var status *progressMessage
 	if chatId, ok := users[uuid]; ok {
-		msg := tgbotapi.NewMessage(chatId, "Your file uploaded, wait for first results")
-		bot.Send(msg)
+		status = sendProgressMessage(bot, chatId, "Your file uploaded, wait for first results")
 	}
 
 	go func(uuid string, filePath string) {
-		table, err := handleFile(filePath)
-		fmt.Println("import finished", table)
+		opts := importOptions{Progress: newImportProgress()}
 		if chatId, ok := users[uuid]; ok {
+			opts = chatImportOptions(bot, chatId, opts.Progress)
+		}
+		stopProgress := status.Watch(opts.Progress)
+		tables, err := handleFile(filePath, opts)
+		stopProgress()
+		fmt.Println("import finished", tables)
+		if chatId, ok := users[uuid]; ok {
+			if offerSQLiteTables(bot, chatId, status, err) {
+				return
+			}
 			if err != nil {
+				status.Update("❌ Импорт не удался")
 				msg := tgbotapi.NewMessage(chatId, "Some error on processing file:"+err.Error())
 				bot.Send(msg)
 				return
 			}
-			currentTable[chatId] = table
-			stat := analyzeStatistics(table)
-			sendStats(chatId, stat, bot)
-			toDeleteTable[table] = time.Now().Add(time.Hour)
+			activateImportedTables(chatId, tables, bot, status)
 		}
 	}(uuid, filePath)
 
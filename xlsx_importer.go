@@ -0,0 +1,236 @@
+// xlsx_importer.go
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pivolan/stats_analyzer/domain/models"
+	"github.com/xuri/excelize/v2"
+)
+
+// xlsxRowReader построчно читает лист Excel, дополняя строки до ширины таблицы
+// и превращая даты, сохраненные Excel как порядковые номера, в строки дат
+type xlsxRowReader struct {
+	rows     *excelize.Rows
+	rowNum   int
+	width    int
+	dateCols map[int]bool
+	date1904 bool
+}
+
+func newXLSXRowReader(f *excelize.File, sheet string, width int, dateCols map[int]bool, date1904 bool) (*xlsxRowReader, error) {
+	rows, err := f.Rows(sheet)
+	if err != nil {
+		return nil, err
+	}
+	return &xlsxRowReader{rows: rows, width: width, dateCols: dateCols, date1904: date1904}, nil
+}
+
+// Read пропускает полностью пустые строки и возвращает io.EOF в конце листа
+func (r *xlsxRowReader) Read() ([]string, error) {
+	for r.rows.Next() {
+		r.rowNum++
+		cells, err := r.rows.Columns(excelize.Options{RawCellValue: true})
+		if err != nil {
+			return nil, err
+		}
+		if isEmptyRow(cells) {
+			continue
+		}
+		width := r.width
+		if width == 0 {
+			width = len(cells)
+		}
+		row := make([]string, width)
+		for i := 0; i < width && i < len(cells); i++ {
+			row[i] = strings.TrimSpace(cells[i])
+			if r.dateCols[i] {
+				row[i] = excelSerialToDate(row[i], r.date1904)
+			}
+		}
+		return row, nil
+	}
+	if err := r.rows.Error(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+// Position возвращает номер строки листа; исходного текста у ячеек нет
+func (r *xlsxRowReader) Position() (int64, string) {
+	return int64(r.rowNum), ""
+}
+
+func (r *xlsxRowReader) Close() error {
+	return r.rows.Close()
+}
+
+func isEmptyRow(cells []string) bool {
+	for _, cell := range cells {
+		if strings.TrimSpace(cell) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// excelSerialToDate переводит порядковый номер даты Excel в Date или DateTime строку
+func excelSerialToDate(value string, date1904 bool) string {
+	serial, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return value
+	}
+	t, err := excelize.ExcelDateToTime(serial, date1904)
+	if err != nil {
+		return value
+	}
+	if serial == math.Trunc(serial) {
+		return t.Format("2006-01-02")
+	}
+	return t.Format("2006-01-02 15:04:05")
+}
+
+var excelDateFormatLiterals = regexp.MustCompile(`"[^"]*"|\[[^\]]*\]|\\.`)
+
+// isExcelDateFormat проверяет, является ли числовой формат ячейки форматом даты или времени
+func isExcelDateFormat(style *excelize.Style) bool {
+	if style == nil {
+		return false
+	}
+	// Встроенные форматы дат: 14-22, 27-36, 45-47, 50-58
+	switch id := style.NumFmt; {
+	case id >= 14 && id <= 22, id >= 27 && id <= 36, id >= 45 && id <= 47, id >= 50 && id <= 58:
+		return true
+	}
+	if style.CustomNumFmt == nil {
+		return false
+	}
+	format := strings.ToLower(excelDateFormatLiterals.ReplaceAllString(*style.CustomNumFmt, ""))
+	return strings.ContainsAny(format, "ydhms")
+}
+
+// detectXLSXDateColumns находит колонки, ячейки которых отформатированы как даты
+func detectXLSXDateColumns(f *excelize.File, sheet string, width int) (map[int]bool, error) {
+	reader, err := newXLSXRowReader(f, sheet, width, nil, false)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	dateCols := map[int]bool{}
+	styleIsDate := map[int]bool{}
+	for i := 0; i < 20; i++ {
+		row, err := reader.Read()
+		if err != nil {
+			break
+		}
+		for col, value := range row {
+			if _, err := strconv.ParseFloat(value, 64); err != nil {
+				continue
+			}
+			cell, err := excelize.CoordinatesToCellName(col+1, reader.rowNum)
+			if err != nil {
+				continue
+			}
+			styleID, err := f.GetCellStyle(sheet, cell)
+			if err != nil {
+				continue
+			}
+			isDate, ok := styleIsDate[styleID]
+			if !ok {
+				style, _ := f.GetStyle(styleID)
+				isDate = isExcelDateFormat(style)
+				styleIsDate[styleID] = isDate
+			}
+			if isDate {
+				dateCols[col] = true
+			}
+		}
+	}
+	return dateCols, nil
+}
+
+// importXLSXIntoClickHouse создает отдельную таблицу для каждого непустого листа книги
+func importXLSXIntoClickHouse(filePath string, db DBInterface, opts importOptions) ([]models.ImportedTable, error) {
+	f, err := excelize.OpenFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open xlsx file: %v", err)
+	}
+	defer f.Close()
+
+	date1904 := false
+	if props, err := f.GetWorkbookProps(); err == nil && props.Date1904 != nil {
+		date1904 = *props.Date1904
+	}
+
+	var tables []models.ImportedTable
+	for _, sheet := range f.GetSheetList() {
+		tableName, err := importXLSXSheet(f, sheet, filePath, date1904, db, opts)
+		if err == io.EOF {
+			log.Printf("skip empty sheet %s", sheet)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("sheet %s: %v", sheet, err)
+		}
+		tables = append(tables, models.ImportedTable{Name: tableName, Source: sheet})
+	}
+	if len(tables) == 0 {
+		return nil, fmt.Errorf("empty xlsx file")
+	}
+	return tables, nil
+}
+
+func importXLSXSheet(f *excelize.File, sheet, filePath string, date1904 bool, db DBInterface, opts importOptions) (models.ClickhouseTableName, error) {
+	// Первая непустая строка листа — заголовки или первая строка данных
+	reader, err := newXLSXRowReader(f, sheet, 0, nil, date1904)
+	if err != nil {
+		return "", err
+	}
+	firstRow, err := reader.Read()
+	reader.Close()
+	if err != nil {
+		return "", err
+	}
+
+	headerAnalysis := AnalyzeHeaders(firstRow)
+	if headerAnalysis == nil {
+		return "", io.EOF
+	}
+	headers := addNumberPrefix(ValidateHeaders(headerAnalysis.Headers))
+	width := len(headers)
+
+	dateCols, err := detectXLSXDateColumns(f, sheet, width)
+	if err != nil {
+		return "", err
+	}
+
+	// Первый проход — определение типов
+	reader, err = newXLSXRowReader(f, sheet, width, dateCols, date1904)
+	if err != nil {
+		return "", err
+	}
+	if !headerAnalysis.FirstRowIsData {
+		reader.Read()
+	}
+	types, nullables, formats := inferColumnTypes(reader, width)
+	reader.Close()
+
+	// Второй проход — загрузка данных
+	reader, err = newXLSXRowReader(f, sheet, width, dateCols, date1904)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+	if !headerAnalysis.FirstRowIsData {
+		reader.Read()
+	}
+	opts.Progress.Track(0, nil)
+	return importRows(db, filePath+"#"+sheet, headers, headerAnalysis.Labels, types, nullables, formats, opts.Progress.CountRows(reader), opts)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/xuri/excelize/v2"
+	"gorm.io/gorm"
+)
+
+func TestIsExcelDateFormat(t *testing.T) {
+	custom := func(s string) *string { return &s }
+	testCases := []struct {
+		name     string
+		style    *excelize.Style
+		expected bool
+	}{
+		{"builtin date", &excelize.Style{NumFmt: 14}, true},
+		{"builtin datetime", &excelize.Style{NumFmt: 22}, true},
+		{"builtin number", &excelize.Style{NumFmt: 2}, false},
+		{"custom date", &excelize.Style{CustomNumFmt: custom("dd.mm.yyyy")}, true},
+		{"custom money", &excelize.Style{CustomNumFmt: custom(`#,##0.00 "руб"`)}, false},
+		{"custom color", &excelize.Style{CustomNumFmt: custom("[Red]0.00")}, false},
+		{"nil style", nil, false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, isExcelDateFormat(tc.style))
+		})
+	}
+}
+
+func TestImportXLSXIntoClickHouse(t *testing.T) {
+	original := getMD5String
+	getMD5String = func(input string) string {
+		return "123456"
+	}
+	defer func() {
+		getMD5String = original
+	}()
+
+	// Книга с двумя листами данных и одним пустым
+	book := excelize.NewFile()
+	book.SetSheetName("Sheet1", "Sales")
+	book.SetSheetRow("Sales", "A1", &[]interface{}{"Product", "Amount", "Sold at"})
+	book.SetSheetRow("Sales", "A2", &[]interface{}{"Apple", 10, 45292})
+	book.SetSheetRow("Sales", "A3", &[]interface{}{"Pear", 12.5, 45293})
+	dateStyle, err := book.NewStyle(&excelize.Style{NumFmt: 14})
+	assert.NoError(t, err)
+	assert.NoError(t, book.SetCellStyle("Sales", "C2", "C3", dateStyle))
+	book.NewSheet("Empty")
+	book.NewSheet("Users")
+	book.SetSheetRow("Users", "A1", &[]interface{}{"Name", "Age"})
+	book.SetSheetRow("Users", "A2", &[]interface{}{"John", 30})
+
+	filePath := filepath.Join(t.TempDir(), "book.xlsx")
+	assert.NoError(t, book.SaveAs(filePath))
+	assert.Equal(t, FORMAT_XLSX, detectFileFormat(filePath))
+
+	mockDB := NewMockDB()
+	mockDB.On("Exec", mock.Anything, mock.Anything).Return(&gorm.DB{})
+
+	tables, err := importFileIntoClickHouse(filePath, mockDB, importOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, tables, 2)
+	assert.Equal(t, "Sales", tables[0].Source)
+	assert.Equal(t, "Users", tables[1].Source)
+
+	var creates, inserts []string
+	for _, call := range mockDB.Calls {
+		query := call.Arguments.String(0)
+		if strings.HasPrefix(query, "CREATE TABLE") {
+			creates = append(creates, query)
+		}
+		if strings.HasPrefix(query, "INSERT INTO") {
+			inserts = append(inserts, query)
+		}
+	}
+	assert.Len(t, creates, 2)
+	assert.Contains(t, creates[0], "0002_amount Float64")
+	assert.Contains(t, creates[0], "0003_sold_at Date")
+	assert.Contains(t, inserts[0], "1,Apple,10,2024-01-01\n2,Pear,12.5,2024-01-02\n")
+	assert.Contains(t, creates[1], "0002_age Int64")
+}